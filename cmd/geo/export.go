@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/ai-zelenin/geo-host/pkg/style"
+	"github.com/ai-zelenin/geo-host/pkg/tilestore"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// runExportTiles renders tiles of layers into MBTiles or PMTiles archive chosen by extension of output
+func runExportTiles(ctx context.Context, ds geo.DataSource, gs *geo.GeographicSystem, layers []string, args []string) error {
+	fs := flag.NewFlagSet("export-tiles", flag.ExitOnError)
+	output := fs.String("o", "", "path of .mbtiles or .pmtiles archive to create")
+	minZoom := fs.Int64("min-zoom", 0, "first exported zoom")
+	maxZoom := fs.Int64("max-zoom", 14, "last exported zoom")
+	bbox := fs.String("bbox", "", "exported area as minLat,minLon,maxLat,maxLon, whole world if empty")
+	clusterDepth := fs.Int64("cluster-depth", 1, "cluster depth of tiles")
+	layerNames := fs.String("layers", strings.Join(layers, ","), "comma separated layers put into tiles")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return fmt.Errorf("export-tiles requires -o")
+	}
+	if *minZoom < gs.QuadKeySystem.MinZoom() || *maxZoom > gs.QuadKeySystem.MaxZoom() || *minZoom > *maxZoom {
+		return fmt.Errorf("zooms must be within %d..%d", gs.QuadKeySystem.MinZoom(), gs.QuadKeySystem.MaxZoom())
+	}
+	if *clusterDepth < 0 || *clusterDepth > 4 {
+		return fmt.Errorf("cluster depth must be within 0..4")
+	}
+	bounds, err := geo.NewBBox(*bbox)
+	if err != nil {
+		return err
+	}
+	opts := &tilestore.ExportOptions{
+		MinZoom:      *minZoom,
+		MaxZoom:      *maxZoom,
+		Bounds:       bounds,
+		ClusterDepth: *clusterDepth,
+		Layers:       geo.ParseLayers(*layerNames),
+	}
+	name := strings.TrimSuffix(filepath.Base(*output), filepath.Ext(*output))
+	w, err := tilestore.Create(*output, opts.Metadata(name, gs))
+	if err != nil {
+		return err
+	}
+	stats, err := tilestore.Export(ctx, ds, gs, w, opts)
+	if err != nil {
+		// incomplete archive is not kept
+		_ = w.Close()
+		_ = os.Remove(*output)
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("exported %d tiles with %d features to %s\n", stats.Tiles, stats.Features, *output)
+	return nil
+}
+
+// styleLayers returns sorted names of styled layers and default layer
+func styleLayers(styles map[string]*style.Style) []string {
+	layers := []string{geo.DefaultLayer}
+	for name := range styles {
+		if name != geo.DefaultLayer {
+			layers = append(layers, name)
+		}
+	}
+	sort.Strings(layers[1:])
+	return layers
+}
+
+// openArchive opens tile archive for serving
+func openArchive(path string, gs *geo.GeographicSystem) (*tilestore.ArchiveDataSource, error) {
+	r, err := tilestore.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	ads, err := tilestore.NewArchiveDataSource(r, gs)
+	if err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	return ads, nil
+}
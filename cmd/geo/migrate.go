@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/ai-zelenin/geo-host/pkg/pgds"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runMigrate applies pending migrations, reverts migrations of scope or prints status
+func runMigrate(ctx context.Context, ds *pgds.PostGISDataSource, args []string) error {
+	command := "up"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("migrate "+command, flag.ExitOnError)
+	scope := fs.String("scope", "", "scope of migrations to revert: postgis or table of layer")
+	to := fs.Int64("to", -1, "version to revert to, 0 reverts all migrations of scope")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	switch command {
+	case "up":
+		err = ds.Migrate(ctx)
+	case "down":
+		if *scope == "" || *to < 0 {
+			return fmt.Errorf("migrate down requires -scope and -to")
+		}
+		err = ds.Rollback(ctx, *scope, *to)
+	case "status":
+	default:
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+	if err != nil {
+		return err
+	}
+	return printMigrationStatus(ctx, ds)
+}
+
+func printMigrationStatus(ctx context.Context, ds *pgds.PostGISDataSource) error {
+	status, err := ds.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "SCOPE\tVERSION\tNAME\tAPPLIED")
+	for _, m := range status {
+		applied := "pending"
+		if m.Applied() {
+			applied = m.AppliedAt.Format(time.RFC3339)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", m.Scope, m.Version, m.Name, applied)
+	}
+	return w.Flush()
+}
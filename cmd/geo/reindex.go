@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/ai-zelenin/geo-host/pkg/pgds"
+)
+
+// runReindex recomputes quad keys of one or all layers and rebuilds pyramids of reindexed layers
+func runReindex(ctx context.Context, ds *pgds.PostGISDataSource, pyramids []string, args []string) error {
+	fs := flag.NewFlagSet("reindex", flag.ExitOnError)
+	layerName := fs.String("layer", "", "layer to reindex, all layers if empty")
+	batch := fs.Int("batch", pgds.DefaultReindexBatch, "number of objects updated at once")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	layers := ds.LayerNames()
+	if *layerName != "" {
+		layers = []string{*layerName}
+	}
+	for _, name := range layers {
+		err = ds.Reindex(ctx, name, *batch)
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range pyramids {
+		if *layerName != "" && name != *layerName {
+			continue
+		}
+		err = ds.BuildPyramid(ctx, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
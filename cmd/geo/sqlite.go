@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/ai-zelenin/geo-host/pkg/sqlds"
+	"github.com/ai-zelenin/geo-host/pkg/style"
+)
+
+// openSQLite opens embedded database and registers layer of every style.
+// Features of layers which need PostGIS are refused rather than ignored.
+func openSQLite(ctx context.Context, path string, gs *geo.GeographicSystem, styles map[string]*style.Style, layers map[string]*style.LayerConfig) (*sqlds.SQLDataSource, error) {
+	for name, cfg := range layers {
+		if len(cfg.Aggregations) > 0 || cfg.Placement != nil || cfg.Pyramid {
+			return nil, fmt.Errorf("layer %s: aggregations, placement and pyramid require PostGIS", name)
+		}
+	}
+	defaultStyle, ok := styles[geo.DefaultLayer]
+	if !ok {
+		defaultStyle = style.MustNewStyle(style.DefaultLayerConfig)
+	}
+	ds, err := sqlds.OpenSQLite(ctx, path, gs, style.NewMapper[*sqlds.Cluster](defaultStyle))
+	if err != nil {
+		return nil, err
+	}
+	for name, layerStyle := range styles {
+		if name == geo.DefaultLayer {
+			continue
+		}
+		_, err = ds.RegisterLayer(ctx, name, style.NewMapper[*sqlds.Cluster](layerStyle))
+		if err != nil {
+			_ = ds.Close()
+			return nil, err
+		}
+	}
+	return ds, nil
+}
@@ -3,14 +3,27 @@ ymaps.ready(['projection.wgs84Mercator', 'projection.sphericalMercator']).then(f
     const params = new URLSearchParams(url.search);
     let debug = params.get("debug");
     let clusterDepth = params.get("clusterDepth");
+    let within = params.get("within");
+    let filter = params.get("filter");
+    let layer = params.get("layer");
     if (!debug){
         debug = "false"
     }
     if (!clusterDepth){
         clusterDepth = "1"
     }
+    let romUrl = `/api/v1/yandex?tiles=%t&zoom=%z&debug=${debug}&clusterDepth=${clusterDepth}`;
+    if (within) {
+        romUrl += `&within=${encodeURIComponent(within)}`
+    }
+    if (filter) {
+        romUrl += `&filter=${encodeURIComponent(filter)}`
+    }
+    if (layer) {
+        romUrl += `&layer=${encodeURIComponent(layer)}`
+    }
     console.log(window.location);
-    const remoteObjectManager = new ymaps.RemoteObjectManager(`/api/v1/yandex?tiles=%t&zoom=%z&debug=${debug}&clusterDepth=${clusterDepth}`, {
+    const remoteObjectManager = new ymaps.RemoteObjectManager(romUrl, {
         "paddingTemplate": "cb_%t_%z"
     });
     remoteObjectManager.setFilter(function (object) {
@@ -32,6 +45,19 @@ ymaps.ready(['projection.wgs84Mercator', 'projection.sphericalMercator']).then(f
     // }
     const map = new ymaps.Map('map', mapSettings);
     map.geoObjects.add(remoteObjectManager);
+    remoteObjectManager.objects.events.add('dblclick', function (e) {
+        const object = remoteObjectManager.objects.getById(e.get('objectId'));
+        if (!object || !object.properties.bounds) {
+            return
+        }
+        e.preventDefault();
+        map.setBounds(object.properties.bounds, {checkZoomRange: true}).then(function () {
+            const expandZoom = object.properties.expandZoom;
+            if (expandZoom && map.getZoom() < expandZoom) {
+                map.setZoom(expandZoom, {checkZoomRange: true});
+            }
+        });
+    });
     map.controls.get('zoomControl').options.set({size: 'small'});
 
 });
@@ -0,0 +1,153 @@
+package geo
+
+import (
+	"fmt"
+	"sort"
+)
+
+type AggregateFunc string
+
+const (
+	AggregateSum AggregateFunc = "sum"
+	AggregateAvg AggregateFunc = "avg"
+	AggregateMin AggregateFunc = "min"
+	AggregateMax AggregateFunc = "max"
+	// AggregateTop returns the most frequent values with their counts
+	AggregateTop AggregateFunc = "top"
+)
+
+const DefaultTopK = 5
+
+// Aggregation describes value computed over properties of cluster members.
+// Numeric functions skip members whose property is missing or not a number.
+type Aggregation struct {
+	Name     string        `json:"name" yaml:"name"`
+	Property string        `json:"property" yaml:"property"`
+	Func     AggregateFunc `json:"func" yaml:"func"`
+	// K is number of values returned by top, DefaultTopK if not set
+	K int64 `json:"k,omitempty" yaml:"k,omitempty"`
+}
+
+func (a *Aggregation) Validate() error {
+	if a.Name == "" {
+		return fmt.Errorf("aggregation name expected")
+	}
+	if a.Property == "" {
+		return fmt.Errorf("aggregation %s: property expected", a.Name)
+	}
+	switch a.Func {
+	case AggregateSum, AggregateAvg, AggregateMin, AggregateMax, AggregateTop:
+	default:
+		return fmt.Errorf("aggregation %s: unknown func %q", a.Name, a.Func)
+	}
+	if a.K < 0 {
+		return fmt.Errorf("aggregation %s: k must not be negative", a.Name)
+	}
+	return nil
+}
+
+func (a *Aggregation) TopK() int64 {
+	if a.K == 0 {
+		return DefaultTopK
+	}
+	return a.K
+}
+
+// TopValue is an item of top aggregation
+type TopValue struct {
+	Value interface{} `json:"value"`
+	Count int64       `json:"count"`
+}
+
+// Aggregator computes aggregations over properties of objects added one by one
+type Aggregator struct {
+	aggregations []*Aggregation
+	count        []int64
+	values       []float64
+	frequencies  []map[interface{}]int64
+}
+
+func NewAggregator(aggregations []*Aggregation) *Aggregator {
+	a := &Aggregator{
+		aggregations: aggregations,
+		count:        make([]int64, len(aggregations)),
+		values:       make([]float64, len(aggregations)),
+		frequencies:  make([]map[interface{}]int64, len(aggregations)),
+	}
+	for i, agg := range aggregations {
+		if agg.Func == AggregateTop {
+			a.frequencies[i] = make(map[interface{}]int64)
+		}
+	}
+	return a
+}
+
+func (a *Aggregator) Add(props map[string]interface{}) {
+	for i, agg := range a.aggregations {
+		value, ok := props[agg.Property]
+		if !ok || value == nil {
+			continue
+		}
+		if agg.Func == AggregateTop {
+			switch value.(type) {
+			case map[string]interface{}, []interface{}:
+				// not comparable, so can not be counted
+				continue
+			}
+			a.frequencies[i][value]++
+			continue
+		}
+		f, ok := NumericValue(value)
+		if !ok {
+			continue
+		}
+		switch {
+		case a.count[i] == 0:
+			a.values[i] = f
+		case agg.Func == AggregateSum || agg.Func == AggregateAvg:
+			a.values[i] += f
+		case agg.Func == AggregateMin && f < a.values[i]:
+			a.values[i] = f
+		case agg.Func == AggregateMax && f > a.values[i]:
+			a.values[i] = f
+		}
+		a.count[i]++
+	}
+}
+
+// Result returns aggregated values by names of aggregations,
+// numeric aggregation without values is nil.
+func (a *Aggregator) Result() map[string]interface{} {
+	result := make(map[string]interface{}, len(a.aggregations))
+	for i, agg := range a.aggregations {
+		switch {
+		case agg.Func == AggregateTop:
+			result[agg.Name] = topValues(a.frequencies[i], agg.TopK())
+		case a.count[i] == 0:
+			result[agg.Name] = nil
+		case agg.Func == AggregateAvg:
+			result[agg.Name] = a.values[i] / float64(a.count[i])
+		default:
+			result[agg.Name] = a.values[i]
+		}
+	}
+	return result
+}
+
+// topValues orders values by count descending and then by text
+func topValues(frequencies map[interface{}]int64, k int64) []TopValue {
+	top := make([]TopValue, 0, len(frequencies))
+	for value, count := range frequencies {
+		top = append(top, TopValue{Value: value, Count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count == top[j].Count {
+			return FilterValueText(top[i].Value) < FilterValueText(top[j].Value)
+		}
+		return top[i].Count > top[j].Count
+	})
+	if int64(len(top)) > k {
+		top = top[:k]
+	}
+	return top
+}
@@ -0,0 +1,99 @@
+package geo
+
+import (
+	"fmt"
+	"github.com/twpayne/go-geom/encoding/wkt"
+	"math"
+	"strings"
+)
+
+// ParseArea parses polygon from WKT (POLYGON or MULTIPOLYGON) or from encoded polyline.
+// Coordinates are expected in lat,lon order as everywhere in the package.
+func ParseArea(s string) (Primitive, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	if strings.HasPrefix(upper, "POLYGON") || strings.HasPrefix(upper, "MULTIPOLYGON") {
+		gt, err := wkt.Unmarshal(s)
+		if err != nil {
+			return nil, fmt.Errorf("wkt parse error [%v]", err)
+		}
+		return FromGeom(gt)
+	}
+	points, err := DecodePolyline(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(points) > 0 && !samePoint(points[0], points[len(points)-1]) {
+		points = append(points, &GeographicPoint{
+			Latitude:  points[0].Latitude,
+			Longitude: points[0].Longitude,
+		})
+	}
+	if len(points) < 4 {
+		return nil, fmt.Errorf("polygon must have at least 3 points")
+	}
+	return &GeographicPolygon{Points: points}, nil
+}
+
+// DecodePolyline decodes points from encoded polyline with precision 5
+// https://developers.google.com/maps/documentation/utilities/polylinealgorithm
+func DecodePolyline(s string) ([]*GeographicPoint, error) {
+	points := make([]*GeographicPoint, 0, len(s)/4)
+	var lat, lon int64
+	for i := 0; i < len(s); {
+		var deltas [2]int64
+		for j := range deltas {
+			var result int64
+			var shift uint
+			for {
+				if i >= len(s) {
+					return nil, fmt.Errorf("polyline is truncated")
+				}
+				b := int64(s[i]) - 63
+				i++
+				if b < 0 || b > 63 {
+					return nil, fmt.Errorf("invalid polyline character %q", s[i-1])
+				}
+				result |= (b & 0x1f) << shift
+				shift += 5
+				if b < 0x20 {
+					break
+				}
+			}
+			if result&1 != 0 {
+				deltas[j] = ^(result >> 1)
+			} else {
+				deltas[j] = result >> 1
+			}
+		}
+		lat += deltas[0]
+		lon += deltas[1]
+		points = append(points, &GeographicPoint{
+			Latitude:  float64(lat) / 1e5,
+			Longitude: float64(lon) / 1e5,
+		})
+	}
+	return points, nil
+}
+
+// EncodePolyline encodes points to polyline with precision 5
+func EncodePolyline(points []*GeographicPoint) string {
+	var sb strings.Builder
+	var prevLat, prevLon int64
+	for _, point := range points {
+		lat := int64(math.Round(point.Latitude * 1e5))
+		lon := int64(math.Round(point.Longitude * 1e5))
+		for _, delta := range []int64{lat - prevLat, lon - prevLon} {
+			v := delta << 1
+			if delta < 0 {
+				v = ^v
+			}
+			for v >= 0x20 {
+				sb.WriteByte(byte((0x20 | (v & 0x1f)) + 63))
+				v >>= 5
+			}
+			sb.WriteByte(byte(v + 63))
+		}
+		prevLat, prevLon = lat, lon
+	}
+	return sb.String()
+}
@@ -0,0 +1,87 @@
+package geo
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	DefaultClusterMembersLimit = 20
+	MaxClusterMembersLimit     = 100
+)
+
+// ClusterMembersRequest describes page of objects of the cluster.
+// Cluster is a tile with TileID at Zoom, which is zoom of map plus cluster depth.
+type ClusterMembersRequest struct {
+	TileID     int64
+	Zoom       int64
+	Offset     int64
+	Limit      int64
+	Layer      string
+	CallbackID string
+	Within     Primitive
+	Filter     PropertyFilter
+}
+
+// ParseClusterMembersRequest from query strings
+func ParseClusterMembersRequest(tileIDStr, zoomStr, offsetStr, limitStr, layerStr, callbackID, withinStr, filterStr string) (*ClusterMembersRequest, error) {
+	tileID, err := strconv.ParseInt(tileIDStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("tile quad key parse error [%v]", err)
+	}
+	zoom, err := strconv.ParseUint(zoomStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("zoom parse error [%v]", err)
+	}
+	if zoom > MaxQuadKeyZoom {
+		return nil, fmt.Errorf("zoom cannot be greater then %d", MaxQuadKeyZoom)
+	}
+	if tileID < 0 || tileID >= 1<<(2*zoom) {
+		return nil, fmt.Errorf("tile quad key must be within 0..%d at zoom %d", int64(1)<<(2*zoom)-1, zoom)
+	}
+	var offset int64
+	if offsetStr != "" {
+		offset, err = strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("offset parse error [%v]", err)
+		}
+		if offset < 0 {
+			return nil, fmt.Errorf("offset cannot be negative")
+		}
+	}
+	var limit int64 = DefaultClusterMembersLimit
+	if limitStr != "" {
+		limit, err = strconv.ParseInt(limitStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("limit parse error [%v]", err)
+		}
+		if limit <= 0 || limit > MaxClusterMembersLimit {
+			return nil, fmt.Errorf("limit must be in range (0,%d]", MaxClusterMembersLimit)
+		}
+	}
+	layer := layerStr
+	if layer == "" {
+		layer = DefaultLayer
+	}
+	var within Primitive
+	if withinStr != "" {
+		within, err = ParseArea(withinStr)
+		if err != nil {
+			return nil, fmt.Errorf("within parse error [%v]", err)
+		}
+	}
+	filter, err := ParsePropertyFilter(filterStr)
+	if err != nil {
+		return nil, fmt.Errorf("filter parse error [%v]", err)
+	}
+	return &ClusterMembersRequest{
+		TileID:     tileID,
+		Zoom:       int64(zoom),
+		Offset:     offset,
+		Limit:      limit,
+		Layer:      layer,
+		CallbackID: callbackID,
+		Within:     within,
+		Filter:     filter,
+	}, nil
+}
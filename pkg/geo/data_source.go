@@ -1,8 +1,23 @@
 package geo
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// ErrUnsupportedRequest is returned for valid requests which data source can not serve
+var ErrUnsupportedRequest = errors.New("request is not supported by data source")
 
 type DataSource interface {
 	LoadMapView(ctx context.Context, mr *MapRequest, fc *FeatureCollection) error
+	LoadNearby(ctx context.Context, nr *NearbyRequest, fc *FeatureCollection) error
+	// LoadClusterMembers puts requested page of cluster objects to fc and returns total number of them
+	LoadClusterMembers(ctx context.Context, cr *ClusterMembersRequest, fc *FeatureCollection) (int64, error)
 	StoreGeoData(ctx context.Context, d interface{}) error
 }
+
+// HealthChecker is optionally implemented by data sources depending on external storage
+type HealthChecker interface {
+	// CheckHealth returns error if data source cannot serve requests
+	CheckHealth(ctx context.Context) error
+}
@@ -0,0 +1,98 @@
+package geo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DebugInfo collects details of map request processing shown in debug mode.
+// Methods are safe for concurrent use and do nothing on nil DebugInfo,
+// so data sources record details without checking whether debug is on.
+type DebugInfo struct {
+	mu       sync.Mutex
+	Queries  []*DebugQuery
+	Clusters []*DebugCluster
+	// Loads are durations of loading by request tile id
+	Loads map[int64]time.Duration
+}
+
+type DebugQuery struct {
+	SQL      string
+	Duration time.Duration
+}
+
+// DebugCluster is cluster of layer with id of its tile at zoom
+type DebugCluster struct {
+	Layer  string
+	TileID int64
+	Zoom   int64
+	Count  int64
+}
+
+func NewDebugInfo() *DebugInfo {
+	return &DebugInfo{
+		Queries:  make([]*DebugQuery, 0),
+		Clusters: make([]*DebugCluster, 0),
+		Loads:    make(map[int64]time.Duration),
+	}
+}
+
+func (d *DebugInfo) AddQuery(sql string, duration time.Duration) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Queries = append(d.Queries, &DebugQuery{SQL: sql, Duration: duration})
+}
+
+func (d *DebugInfo) AddCluster(layer string, tileID, zoom, count int64) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Clusters = append(d.Clusters, &DebugCluster{Layer: layer, TileID: tileID, Zoom: zoom, Count: count})
+}
+
+// AddLoad adds duration of loading to every tile loaded at once
+func (d *DebugInfo) AddLoad(tileIDs []int64, duration time.Duration) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, tileID := range tileIDs {
+		d.Loads[tileID] += duration
+	}
+}
+
+// TileCounts sums objects of clusters by their tiles at zoom
+func (d *DebugInfo) TileCounts(zoom int64) map[int64]int64 {
+	counts := make(map[int64]int64)
+	if d == nil {
+		return counts
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, c := range d.Clusters {
+		if c.Zoom >= zoom {
+			counts[c.TileID>>(2*(c.Zoom-zoom))] += c.Count
+		}
+	}
+	return counts
+}
+
+type debugInfoKey struct{}
+
+// ContextWithDebugInfo makes DebugInfo available to code which has only context, like query hooks
+func ContextWithDebugInfo(ctx context.Context, info *DebugInfo) context.Context {
+	return context.WithValue(ctx, debugInfoKey{}, info)
+}
+
+// DebugInfoFromContext returns DebugInfo of context or nil
+func DebugInfoFromContext(ctx context.Context) *DebugInfo {
+	info, _ := ctx.Value(debugInfoKey{}).(*DebugInfo)
+	return info
+}
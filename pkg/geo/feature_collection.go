@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"github.com/twpayne/go-geom"
 	"github.com/twpayne/go-geom/encoding/geojson"
+	"sync"
 )
 
+// FeatureCollection is safe for concurrent Add and Append
 type FeatureCollection struct {
+	mu sync.Mutex
 	geojson.FeatureCollection
 }
 
@@ -41,10 +44,22 @@ func (f *FeatureCollection) Add(id interface{}, geo interface{}, properties map[
 	if feature == nil {
 		return fmt.Errorf("bad type %T", geo)
 	}
+	f.mu.Lock()
 	f.Features = append(f.Features, feature)
+	f.mu.Unlock()
 	return nil
 }
 
+// Append adds features of other collection keeping their order
+func (f *FeatureCollection) Append(other *FeatureCollection) {
+	other.mu.Lock()
+	features := other.Features
+	other.mu.Unlock()
+	f.mu.Lock()
+	f.Features = append(f.Features, features...)
+	f.mu.Unlock()
+}
+
 func (f *FeatureCollection) MarshalToJSONP(callbackID string) ([]byte, error) {
 	data, err := f.MarshalJSON()
 	if err != nil {
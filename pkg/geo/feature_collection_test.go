@@ -2,6 +2,7 @@ package geo
 
 import (
 	"github.com/stretchr/testify/suite"
+	"sync"
 	"testing"
 )
 
@@ -41,3 +42,22 @@ func (s *FeatureCollectionSuite) TestFeatureCollection() {
 		return
 	}
 }
+
+func (s *FeatureCollectionSuite) TestConcurrentAdd() {
+	fc := NewFeatureCollection()
+	other := NewFeatureCollection()
+	s.Require().Nil(other.Add("other", &GeographicPoint{Latitude: 2, Longitude: 2}, nil))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.Nil(fc.Add(i*100+j, &GeographicPoint{Latitude: 1, Longitude: 1}, nil))
+			}
+			fc.Append(other)
+		}(i)
+	}
+	wg.Wait()
+	s.Len(fc.Features, 808)
+}
@@ -30,30 +30,59 @@ func (p *GeographicPolygon) FromGeom(t geom.T) error {
 	return nil
 }
 
+// ToGeom makes ring of polygon for every ring of points, so holes stay holes
 func (p *GeographicPolygon) ToGeom() (geom.T, error) {
 	srid := DefaultSRID(p.SRID)
-	coords := make([]geom.Coord, len(p.Points))
-	for i, point := range p.Points {
-		tp, err := point.ToGeom()
+	polygon := geom.NewPolygon(geom.XY)
+	for _, ring := range splitRings(p.Points) {
+		coords := make([]geom.Coord, len(ring))
+		for i, point := range ring {
+			tp, err := point.ToGeom()
+			if err != nil {
+				return nil, err
+			}
+			coords[i] = tp.FlatCoords()
+		}
+		lr, err := geom.NewLinearRing(geom.XY).SetCoords(coords)
+		if err != nil {
+			return nil, err
+		}
+		lr.SetSRID(int(srid))
+		err = polygon.Push(lr)
 		if err != nil {
 			return nil, err
 		}
-		coords[i] = tp.FlatCoords()
-	}
-	lr, err := geom.NewLinearRing(geom.XY).SetCoords(coords)
-	if err != nil {
-		return nil, err
-	}
-	lr.SetSRID(int(srid))
-	polygon := geom.NewPolygon(geom.XY)
-	err = polygon.Push(lr)
-	if err != nil {
-		return nil, err
 	}
 	polygon.SetSRID(int(srid))
 	return polygon, nil
 }
 
+// Area returns area of polygon without its holes in square meters
+func (p *GeographicPolygon) Area() float64 {
+	var area float64
+	for i, ring := range splitRings(p.Points) {
+		if i == 0 {
+			area = SphericalRingArea(ring)
+		} else {
+			area -= SphericalRingArea(ring)
+		}
+	}
+	return area
+}
+
+// Perimeter returns great-circle length of borders of polygon and its holes in meters
+func (p *GeographicPolygon) Perimeter() float64 {
+	var perimeter float64
+	for _, ring := range splitRings(p.Points) {
+		for i := range ring {
+			p1 := ring[i]
+			p2 := ring[(i+1)%len(ring)]
+			perimeter += HaversineDistance(p1.Latitude, p1.Longitude, p2.Latitude, p2.Longitude)
+		}
+	}
+	return perimeter
+}
+
 func (p *GeographicPolygon) Scan(input interface{}) error {
 	gt, err := ewkbhex.Decode(string(input.([]byte)))
 	if err != nil {
@@ -1,6 +1,12 @@
 package geo
 
-import "fmt"
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+	"time"
+)
 
 type GeographicSystem struct {
 	TileSystem    *TileSystem
@@ -25,6 +31,10 @@ func NewGeographicSystem(cfg *Config) *GeographicSystem {
 	}
 }
 
+func (g *GeographicSystem) Config() *Config {
+	return g.cfg
+}
+
 func (g *GeographicSystem) CoordinatesToQuadKey(lat, long float64) QuadKey {
 	gpx, gpy := g.Projection.ToGlobalPixels(lat, long, g.cfg.MaxZoom)
 	tx, ty := g.TileSystem.GlobalPixelsToTileXY(gpx, gpy)
@@ -40,25 +50,168 @@ func (g *GeographicSystem) DrawROMBBox(mr *MapRequest, fc *FeatureCollection) er
 	return fc.Add("lat-lon-polygon", mr.AsPolygon(), props)
 }
 
+func (g *GeographicSystem) DrawROMWithin(mr *MapRequest, fc *FeatureCollection) error {
+	props := map[string]interface{}{
+		"options": map[string]interface{}{
+			"fillColor": fmt.Sprintf("rgba(125, 27, 27, 0.1)"),
+		},
+	}
+	return fc.Add("within-polygon", mr.Within, props)
+}
+
+// DrawROMTiles draws request tiles with their cluster depths,
+// in adaptive mode the denser tile is the more opaque it is.
 func (g *GeographicSystem) DrawROMTiles(mr *MapRequest, fc *FeatureCollection) error {
+	_, fullDepth := g.QuadKeySystem.AdaptiveDepthRange(mr.Zoom)
+	counts := mr.DebugInfo.TileCounts(mr.Zoom)
 	return mr.IterateTiles(func(x, y int64) error {
 		tilePolygon := g.TileXYToPolygon(x, y, mr.Zoom)
 		id := fmt.Sprintf("tx:%d ty:%d", x, y)
 		qk := g.QuadKeySystem.TileXYToQuadKey(x, y, mr.Zoom)
 		minQk, maxQk := g.QuadKeySystem.QuadKeyRange(qk)
-		return fc.Add(id, tilePolygon, map[string]interface{}{
-			"hintContent":  id,
+		depth := mr.TileClusterDepth(qk.Int64())
+		opacity := 0.2
+		if mr.Adaptive && depth < fullDepth {
+			opacity = 0.2 + 0.4*float64(depth+1)/float64(MaxAdaptiveDepth+1)
+		}
+		props := map[string]interface{}{
+			"hintContent":  fmt.Sprintf("%s depth:%d", id, depth),
 			"quadKey":      qk.String(),
 			"leftQuadKey":  minQk.String(),
 			"rightQuadKey": maxQk.String(),
+			"clusterDepth": depth,
+			"options": map[string]interface{}{
+				"fillColor": fmt.Sprintf("rgba(27, 125, 27, %.2f)", opacity),
+			},
+		}
+		if mr.DebugInfo != nil {
+			loadMs := durationMs(mr.DebugInfo.Loads[qk.Int64()])
+			props["count"] = counts[qk.Int64()]
+			props["loadMs"] = loadMs
+			props["hintContent"] = fmt.Sprintf("%s depth:%d count:%d load:%.1fms", id, depth, counts[qk.Int64()], loadMs)
+		}
+		return fc.Add(id, tilePolygon, props)
+
+	})
+}
+
+// DrawROMClusterGrid draws tiles of clusters at Zoom+ClusterDepth, so it is seen which sub-tile every marker stands for.
+// Only non-empty sub-tiles are drawn to keep the grid of deep clustering small.
+func (g *GeographicSystem) DrawROMClusterGrid(mr *MapRequest, fc *FeatureCollection) error {
+	if mr.DebugInfo == nil {
+		return nil
+	}
+	mr.DebugInfo.mu.Lock()
+	clusters := make([]*DebugCluster, len(mr.DebugInfo.Clusters))
+	copy(clusters, mr.DebugInfo.Clusters)
+	mr.DebugInfo.mu.Unlock()
+	for _, c := range clusters {
+		tx, ty, err := g.QuadKeySystem.QuadKeyToTileXY(NewQuadKeyFromInt64(c.TileID))
+		if err != nil {
+			return err
+		}
+		id := fmt.Sprintf("grid %s z:%d tx:%d ty:%d", c.Layer, c.Zoom, tx, ty)
+		err = fc.Add(id, g.TileXYToPolygon(tx, ty, c.Zoom), map[string]interface{}{
+			"hintContent": fmt.Sprintf("%s count:%d", id, c.Count),
+			"count":       c.Count,
 			"options": map[string]interface{}{
-				"fillColor": fmt.Sprintf("rgba(27, 125, 27, 0.2)"),
+				"fillColor":   "rgba(27, 27, 125, 0.05)",
+				"strokeColor": "rgba(27, 27, 125, 0.5)",
 			},
 		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// DrawROMQueries draws area of requested tiles with executed queries and their timings
+func (g *GeographicSystem) DrawROMQueries(mr *MapRequest, fc *FeatureCollection) error {
+	if mr.DebugInfo == nil {
+		return nil
+	}
+	mr.DebugInfo.mu.Lock()
+	queries := make([]map[string]interface{}, 0, len(mr.DebugInfo.Queries))
+	var total time.Duration
+	var balloon strings.Builder
+	for _, q := range mr.DebugInfo.Queries {
+		total += q.Duration
+		queries = append(queries, map[string]interface{}{
+			"sql":        q.SQL,
+			"durationMs": durationMs(q.Duration),
+		})
+		balloon.WriteString(fmt.Sprintf("<b>%.1fms</b><br>\n<pre>%s</pre>\n", durationMs(q.Duration), html.EscapeString(q.SQL)))
+	}
+	mr.DebugInfo.mu.Unlock()
+	area := &GeographicPolygon{
+		Points: []*GeographicPoint{
+			g.TileXYToPoint(mr.TileXMin, mr.TileYMin, mr.Zoom),
+			g.TileXYToPoint(mr.TileXMin, mr.TileYMax+1, mr.Zoom),
+			g.TileXYToPoint(mr.TileXMax+1, mr.TileYMax+1, mr.Zoom),
+			g.TileXYToPoint(mr.TileXMax+1, mr.TileYMin, mr.Zoom),
+			g.TileXYToPoint(mr.TileXMin, mr.TileYMin, mr.Zoom),
+		},
+	}
+	return fc.Add("debug-queries", area, map[string]interface{}{
+		"hintContent":    fmt.Sprintf("queries:%d total:%.1fms", len(queries), durationMs(total)),
+		"balloonContent": balloon.String(),
+		"queries":        queries,
+		"options": map[string]interface{}{
+			"fillColor":   "rgba(0, 0, 0, 0)",
+			"strokeColor": "rgba(125, 27, 125, 0.8)",
+			"strokeWidth": 3,
+		},
 	})
 }
 
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// ValidateMapRequest checks that zoom is within zoom range of system, cluster depth is not negative
+// and requested tiles exist at zoom. maxTiles limits number of tiles, 0 means no limit.
+// Cluster zoom above max zoom is allowed, it is limited by ClusterZoom.
+func (g *GeographicSystem) ValidateMapRequest(mr *MapRequest, maxTiles int64) error {
+	if mr.Zoom < g.cfg.MinZoom || mr.Zoom > g.cfg.MaxZoom {
+		return fmt.Errorf("zoom must be within %d..%d", g.cfg.MinZoom, g.cfg.MaxZoom)
+	}
+	if mr.ClusterDepth < 0 {
+		return fmt.Errorf("clusterDepth cannot be negative")
+	}
+	size := int64(1) << mr.Zoom
+	if mr.TileXMin < 0 || mr.TileYMin < 0 || mr.TileXMax >= size || mr.TileYMax >= size {
+		return fmt.Errorf("tiles must be within 0..%d at zoom %d", size-1, mr.Zoom)
+	}
+	if mr.TileXMin > mr.TileXMax || mr.TileYMin > mr.TileYMax {
+		return fmt.Errorf("tile minimum cannot be greater then maximum")
+	}
+	if maxTiles > 0 && mr.TilesNumber() > maxTiles {
+		return fmt.Errorf("request has %d tiles, limit is %d", mr.TilesNumber(), maxTiles)
+	}
+	return nil
+}
+
+// ValidateClusterMembersRequest checks that cluster zoom is within zoom range of system and tile exists at it
+func (g *GeographicSystem) ValidateClusterMembersRequest(cr *ClusterMembersRequest) error {
+	if cr.Zoom < g.cfg.MinZoom || cr.Zoom > g.cfg.MaxZoom {
+		return fmt.Errorf("zoom must be within %d..%d", g.cfg.MinZoom, g.cfg.MaxZoom)
+	}
+	if cr.TileID < 0 || cr.TileID >= 1<<(2*cr.Zoom) {
+		return fmt.Errorf("tile quad key must be within 0..%d at zoom %d", int64(1)<<(2*cr.Zoom)-1, cr.Zoom)
+	}
+	return nil
+}
+
+// ClusterZoom is zoom of tiles grouped into clusters of request limited by max zoom
+func (g *GeographicSystem) ClusterZoom(mr *MapRequest) int64 {
+	zoom := mr.Zoom + mr.ClusterDepth
+	if zoom > g.cfg.MaxZoom {
+		zoom = g.cfg.MaxZoom
+	}
+	return zoom
+}
+
 func (g *GeographicSystem) MRToTiles(mr *MapRequest) (tiles map[int64]Tile) {
 	result := make(map[int64]Tile, mr.TilesNumber())
 	_ = mr.IterateTiles(func(x, y int64) error {
@@ -76,13 +229,98 @@ func (g *GeographicSystem) MRToTiles(mr *MapRequest) (tiles map[int64]Tile) {
 	return result
 }
 
-func (g *GeographicSystem) TileIDToCenterPoint(tileID int64) (*GeographicPoint, error) {
+// ClusterBoundsProperties returns bounds of cluster members in lat,lon order suitable for map.setBounds
+// and zoom of map at which cluster breaks into several markers.
+func (g *GeographicSystem) ClusterBoundsProperties(bbox BBox, minQk, maxQk int64, clusterDepth int64) map[string]interface{} {
+	props := map[string]interface{}{
+		"bounds": [][]float64{{bbox.XMin, bbox.YMin}, {bbox.XMax, bbox.YMax}},
+	}
+	if zoom, ok := g.QuadKeySystem.SplitZoom(minQk, maxQk); ok {
+		props["expandZoom"] = zoom - clusterDepth
+	}
+	return props
+}
+
+// CircleToTiles returns zoom and tiles which fully cover circle with radius in meters
+func (g *GeographicSystem) CircleToTiles(lat, lon, radius float64) (map[int64]Tile, int64) {
+	tileBBoxes, zoom := g.circleToTileBBoxes(lat, lon, radius)
+	tiles := make(map[int64]Tile)
+	for _, tileBBox := range tileBBoxes {
+		for id, tile := range g.MRToTiles(&MapRequest{TileBBox: tileBBox, Zoom: zoom}) {
+			tiles[id] = tile
+		}
+	}
+	return tiles, zoom
+}
+
+// circleToTileBBoxes returns zoom and tile bounds which fully cover circle with radius in meters.
+// Zoom is chosen so that tile is not smaller than radius, thus circle always lies
+// within the tile of the center and its nearest neighbors. Circle crossing antimeridian
+// is covered by two bounds, one at each side of it.
+func (g *GeographicSystem) circleToTileBBoxes(lat, lon, radius float64) ([]TileBBox, int64) {
+	// tiles are narrower closer to the pole, so measure them at the farthest latitude of the circle
+	edgeLat := math.Min(math.Abs(lat)+RadiansToDegrees(radius/MeanEarthRadius), EGS3857MaxLat)
+	rootTileWidth := Equator * math.Cos(DegreesToRadians(edgeLat)) * float64(g.cfg.TileSize) / 256
+	zoom := int64(math.Floor(math.Log2(rootTileWidth / radius)))
+	if zoom > g.cfg.MaxZoom {
+		zoom = g.cfg.MaxZoom
+	}
+	if zoom < g.cfg.MinZoom {
+		zoom = g.cfg.MinZoom
+	}
+	tileWidth := rootTileWidth / math.Pow(2, float64(zoom))
+	ring := int64(math.Ceil(radius / tileWidth))
+	gpx, gpy := g.Projection.ToGlobalPixels(lat, lon, zoom)
+	tx, ty := g.TileSystem.GlobalPixelsToTileXY(gpx, gpy)
+	size := int64(1) << zoom
+	tileBBox := TileBBox{
+		TileXMin: tx - ring,
+		TileXMax: tx + ring,
+		TileYMin: int64(Restrict(float64(ty-ring), 0, float64(size-1))),
+		TileYMax: int64(Restrict(float64(ty+ring), 0, float64(size-1))),
+	}
+	switch {
+	case tileBBox.TileXMax-tileBBox.TileXMin+1 >= size:
+		tileBBox.TileXMin, tileBBox.TileXMax = 0, size-1
+	case tileBBox.TileXMin < 0:
+		west := tileBBox
+		west.TileXMin, west.TileXMax = tileBBox.TileXMin+size, size-1
+		tileBBox.TileXMin = 0
+		return []TileBBox{west, tileBBox}, zoom
+	case tileBBox.TileXMax >= size:
+		east := tileBBox
+		east.TileXMin, east.TileXMax = 0, tileBBox.TileXMax-size
+		tileBBox.TileXMax = size - 1
+		return []TileBBox{tileBBox, east}, zoom
+	}
+	return []TileBBox{tileBBox}, zoom
+}
+
+// BBoxToTileBBox returns tiles of zoom covering bbox in lat,lon order
+func (g *GeographicSystem) BBoxToTileBBox(bbox BBox, zoom int64) TileBBox {
+	maxTile := float64(int64(1)<<zoom - 1)
+	// north-west corner has the least tile coordinates
+	gpx, gpy := g.Projection.ToGlobalPixels(Restrict(bbox.XMax, -EGS3857MaxLat, EGS3857MaxLat), bbox.YMin, zoom)
+	txMin, tyMin := g.TileSystem.GlobalPixelsToTileXY(gpx, gpy)
+	gpx, gpy = g.Projection.ToGlobalPixels(Restrict(bbox.XMin, -EGS3857MaxLat, EGS3857MaxLat), bbox.YMax, zoom)
+	txMax, tyMax := g.TileSystem.GlobalPixelsToTileXY(gpx, gpy)
+	return TileBBox{
+		TileXMin: int64(Restrict(float64(txMin), 0, maxTile)),
+		TileXMax: int64(Restrict(float64(txMax), 0, maxTile)),
+		TileYMin: int64(Restrict(float64(tyMin), 0, maxTile)),
+		TileYMax: int64(Restrict(float64(tyMax), 0, maxTile)),
+	}
+}
+
+// TileIDToCenterPoint returns center of tile with id of given zoom.
+// Zoom can not be derived from id, because base-4 form of id loses leading zeros.
+func (g *GeographicSystem) TileIDToCenterPoint(tileID int64, zoom int64) (*GeographicPoint, error) {
 	qk := NewQuadKeyFromInt64(tileID)
 	tx, ty, err := g.QuadKeySystem.QuadKeyToTileXY(qk)
 	if err != nil {
 		return nil, err
 	}
-	return g.TileXYToCenterPoint(tx, ty, qk.Len()), nil
+	return g.TileXYToCenterPoint(tx, ty, zoom), nil
 }
 
 func (g *GeographicSystem) TileXYToCenterPoint(tx, ty int64, z int64) *GeographicPoint {
@@ -1,5 +1,9 @@
 package geo
 
+import (
+	"fmt"
+)
+
 const (
 	DefaultTileSize = 256
 	DefaultMinZoom  = 0
@@ -19,3 +23,9 @@ type Config struct {
 	MaxZoom        int64 `json:"max_zoom" yaml:"max_zoom"`
 	ProjectionType SRID  `json:"projection_type" yaml:"projection_type"`
 }
+
+// Fingerprint identifies settings which quad keys depend on,
+// stored quad keys must be recomputed when it changes
+func (c *Config) Fingerprint() string {
+	return fmt.Sprintf("tile_size=%d,min_zoom=%d,max_zoom=%d,projection=%d", c.TileSize, c.MinZoom, c.MaxZoom, c.ProjectionType)
+}
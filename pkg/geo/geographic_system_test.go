@@ -65,3 +65,137 @@ func (s *GeoSystemSuite) Iterator(cb func(lat, lon float64, zoom int64) bool) {
 		}
 	}
 }
+
+func (s *GeoSystemSuite) TestSplitZoom() {
+	qs := s.gs.QuadKeySystem
+	points := [][2]float64{{55.69329, 37.534511}, {55.676549, 37.504584}, {55.757228, 37.615078}, {55.758808, 37.61768}, {-33.86, 151.2}}
+	for _, a := range points {
+		for _, b := range points {
+			qa := s.gs.CoordinatesToQuadKey(a[0], a[1]).Int64()
+			qb := s.gs.CoordinatesToQuadKey(b[0], b[1]).Int64()
+			zoom, ok := qs.SplitZoom(qa, qb)
+			if !s.Equal(qa != qb, ok) || !ok {
+				continue
+			}
+			s.NotEqual(qa>>qs.BitDelta(zoom), qb>>qs.BitDelta(zoom))
+			s.Equal(qa>>qs.BitDelta(zoom-1), qb>>qs.BitDelta(zoom-1))
+		}
+	}
+}
+
+func (s *GeoSystemSuite) TestTileIDToCenterPoint() {
+	lat, lon := 55.756363, 37.623270
+	for zoom := int64(1); zoom <= s.gs.QuadKeySystem.maxZoom; zoom++ {
+		gpx, gpy := s.gs.Projection.ToGlobalPixels(lat, lon, zoom)
+		tx, ty := s.gs.TileSystem.GlobalPixelsToTileXY(gpx, gpy)
+		tileID := s.gs.CoordinatesToQuadKey(lat, lon).Int64() >> s.gs.QuadKeySystem.BitDelta(zoom)
+		center, err := s.gs.TileIDToCenterPoint(tileID, zoom)
+		if !s.Nil(err) {
+			return
+		}
+		s.Equal(s.gs.TileXYToCenterPoint(tx, ty, zoom), center, zoom)
+	}
+}
+
+func (s *GeoSystemSuite) TestConfigFingerprint() {
+	s.Equal("tile_size=256,min_zoom=0,max_zoom=23,projection=4326", s.gs.Config().Fingerprint())
+	cfg := *DefaultGeoSystemConfig
+	cfg.MaxZoom = 20
+	s.NotEqual(DefaultGeoSystemConfig.Fingerprint(), cfg.Fingerprint())
+}
+
+func (s *GeoSystemSuite) TestBBoxToTileBBox() {
+	bbox := BBox{XMin: 55.5, XMax: 56, YMin: 37.3, YMax: 37.9}
+	for zoom := int64(0); zoom <= 12; zoom++ {
+		tb := s.gs.BBoxToTileBBox(bbox, zoom)
+		for _, corner := range []*GeographicPoint{{Latitude: bbox.XMin, Longitude: bbox.YMin}, {Latitude: bbox.XMax, Longitude: bbox.YMax}} {
+			gpx, gpy := s.gs.Projection.ToGlobalPixels(corner.Latitude, corner.Longitude, zoom)
+			tx, ty := s.gs.TileSystem.GlobalPixelsToTileXY(gpx, gpy)
+			s.True(tx >= tb.TileXMin && tx <= tb.TileXMax && ty >= tb.TileYMin && ty <= tb.TileYMax, zoom)
+		}
+	}
+	maxTile := int64(1)<<10 - 1
+	s.Equal(TileBBox{TileXMax: maxTile, TileYMax: maxTile}, s.gs.BBoxToTileBBox(BBox{XMin: MinLat, XMax: MaxLat, YMin: MinLon, YMax: MaxLon}, 10))
+}
+
+func (s *GeoSystemSuite) TestValidateMapRequest() {
+	cases := []struct {
+		tiles, zoom, clusterDepth string
+		valid                     bool
+	}{
+		{"308,159,311,162", "9", "2", true},
+		{"0,0,0,0", "0", "", true},
+		{"0,0,0,0", "24", "", false},
+		{"0,0,0,0", "22", "2", true},
+		{"0,0,0,0", "23", "4", true},
+		{"0,0,100000,100000", "9", "", false},
+		{"-1,0,0,0", "9", "", false},
+		{"0,0,511,511", "9", "", false},
+		{"0,0,15,15", "9", "", true},
+		{"0,0,15,16", "9", "", false},
+		{"5,0,4,0", "9", "", false},
+	}
+	for _, c := range cases {
+		mr, err := ParseMapRequest("", c.tiles, c.zoom, "", "", c.clusterDepth, "", "", "")
+		s.Require().Nil(err)
+		err = s.gs.ValidateMapRequest(mr, 256)
+		s.Equal(c.valid, err == nil, c, err)
+	}
+	mr, err := ParseMapRequest("", "0,0,511,511", "9", "", "", "", "", "", "")
+	s.Require().Nil(err)
+	s.Nil(s.gs.ValidateMapRequest(mr, 0))
+	mr.ClusterDepth = -1
+	s.Error(s.gs.ValidateMapRequest(mr, 0))
+	_, err = ParseMapRequest("", "0,0,0,0", "9", "", "", "-1", "", "", "")
+	s.Error(err)
+}
+
+func (s *GeoSystemSuite) TestValidateClusterMembersRequest() {
+	cases := []struct {
+		tileID, zoom int64
+		valid        bool
+	}{
+		{tileID: 0, zoom: 0, valid: true},
+		{tileID: 1, zoom: 0, valid: false},
+		{tileID: 15, zoom: 2, valid: true},
+		{tileID: 16, zoom: 2, valid: false},
+		{tileID: -1, zoom: 2, valid: false},
+		{tileID: 1<<46 - 1, zoom: 23, valid: true},
+		{tileID: 0, zoom: 24, valid: false},
+	}
+	for _, c := range cases {
+		err := s.gs.ValidateClusterMembersRequest(&ClusterMembersRequest{TileID: c.tileID, Zoom: c.zoom})
+		s.Equal(c.valid, err == nil, c, err)
+	}
+}
+
+func (s *GeoSystemSuite) TestClusterZoom() {
+	s.Equal(int64(12), s.gs.ClusterZoom(&MapRequest{Zoom: 10, ClusterDepth: 2}))
+	s.Equal(int64(23), s.gs.ClusterZoom(&MapRequest{Zoom: 21, ClusterDepth: 2}))
+	s.Equal(int64(23), s.gs.ClusterZoom(&MapRequest{Zoom: 22, ClusterDepth: 4}))
+}
+
+func (s *GeoSystemSuite) TestCircleToTiles() {
+	tileBBoxes, zoom := s.gs.circleToTileBBoxes(55.75, 37.61, 1000)
+	if s.Len(tileBBoxes, 1) {
+		s.Equal(int64(2), tileBBoxes[0].TileXMax-tileBBoxes[0].TileXMin)
+	}
+	for _, lon := range []float64{179.999, -179.999} {
+		tileBBoxes, zoom = s.gs.circleToTileBBoxes(0, lon, 1000)
+		if !s.Len(tileBBoxes, 2, lon) {
+			continue
+		}
+		s.Equal(int64(1)<<zoom-1, tileBBoxes[0].TileXMax, lon)
+		s.Equal(int64(0), tileBBoxes[1].TileXMin, lon)
+	}
+	tileBBoxes, zoom = s.gs.circleToTileBBoxes(0, 0, 1e7)
+	if s.Len(tileBBoxes, 1) {
+		s.Equal(int64(0), tileBBoxes[0].TileXMin)
+		s.Equal(int64(1)<<zoom-1, tileBBoxes[0].TileXMax)
+	}
+
+	tiles, zoom := s.gs.CircleToTiles(0, 179.999, 1000)
+	gpx, gpy := s.gs.Projection.ToGlobalPixels(0, -179.999, zoom)
+	tx, ty := s.gs.TileSystem.GlobalPixelsToTileXY(gpx, gpy)
+	s.Contains(tiles, s.gs.QuadKeySystem.TileXYToQuadKey(tx, ty, zoom).Int64())
+}
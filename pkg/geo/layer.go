@@ -0,0 +1,56 @@
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	DefaultLayer = "default"
+	// DefaultLayerTable is table of default layer, tables of other layers have name of layer as suffix
+	DefaultLayerTable = "geo_objects"
+)
+
+var ErrUnknownLayer = errors.New("unknown layer")
+
+var layerNameRegexp = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// LayerTable returns table of layer, name must be usable in identifiers
+func LayerTable(name string) (string, error) {
+	if name == DefaultLayer {
+		return DefaultLayerTable, nil
+	}
+	if !layerNameRegexp.MatchString(name) {
+		return "", fmt.Errorf("invalid layer name %q", name)
+	}
+	return DefaultLayerTable + "_" + name, nil
+}
+
+// ParseLayers parses comma separated list of layer names
+func ParseLayers(s string) []string {
+	if s == "" {
+		return nil
+	}
+	layers := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		layers = append(layers, name)
+	}
+	return layers
+}
+
+// LayerFeatureID makes feature id unique across layers.
+// Ids of default layer are kept as is.
+func LayerFeatureID(layer string, id interface{}) interface{} {
+	if layer == DefaultLayer || layer == "" {
+		return id
+	}
+	return fmt.Sprintf("%s:%v", layer, id)
+}
@@ -2,7 +2,19 @@ package geo
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
+)
+
+const (
+	// AdaptiveClusterDepth is value of clusterDepth parameter which makes data source choose depth of every tile
+	AdaptiveClusterDepth = "auto"
+	// DefaultMaxMarkers is number of markers per tile targeted by adaptive depth
+	DefaultMaxMarkers = 16
+	MaxMaxMarkers     = 256
+	// MaxAdaptiveDepth limits sub-tile depth of dense tiles
+	MaxAdaptiveDepth = 8
 )
 
 type MapRequest struct {
@@ -12,10 +24,24 @@ type MapRequest struct {
 	CallbackID   string
 	Debug        bool
 	ClusterDepth int64
+	// Adaptive depth makes data source choose cluster depth of every tile to keep number of markers
+	// of tile within MaxMarkers. Sparse tiles are not clustered at all.
+	Adaptive   bool
+	MaxMarkers int64
+	// ClusterDepths are depths chosen by data source in adaptive mode by tile id, the deepest among layers
+	ClusterDepths map[int64]int64
+	// Within restricts objects to polygon area, nil means no restriction
+	Within Primitive
+	// Filter restricts objects by their properties, nil means no restriction
+	Filter PropertyFilter
+	// Layers to load, empty means default layer
+	Layers []string
+	// DebugInfo is filled by data source when debug mode is allowed and requested
+	DebugInfo *DebugInfo
 }
 
 // ParseMapRequest from comma separated strings
-func ParseMapRequest(coordsStr, tileStr, zoomStr, callbackID, debugStr, clusterDepthStr string) (*MapRequest, error) {
+func ParseMapRequest(coordsStr, tileStr, zoomStr, callbackID, debugStr, clusterDepthStr, withinStr, filterStr, layerStr string) (*MapRequest, error) {
 	var err error
 	bbox, err := NewBBox(coordsStr)
 	if err != nil {
@@ -37,15 +63,40 @@ func ParseMapRequest(coordsStr, tileStr, zoomStr, callbackID, debugStr, clusterD
 		}
 	}
 	var cl int64
-	if clusterDepthStr != "" {
+	var adaptive bool
+	var maxMarkers int64
+	if clusterDepthStr == AdaptiveClusterDepth || strings.HasPrefix(clusterDepthStr, AdaptiveClusterDepth+":") {
+		adaptive = true
+		maxMarkers = DefaultMaxMarkers
+		if markersStr := strings.TrimPrefix(clusterDepthStr, AdaptiveClusterDepth); markersStr != "" {
+			maxMarkers, err = strconv.ParseInt(markersStr[1:], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("clusterDepth parse error [%v]", err)
+			}
+			if maxMarkers < 1 || maxMarkers > MaxMaxMarkers {
+				return nil, fmt.Errorf("max markers must be within 1..%d", MaxMaxMarkers)
+			}
+		}
+	} else if clusterDepthStr != "" {
 		cl, err = strconv.ParseInt(clusterDepthStr, 10, 64)
 		if err != nil {
 			return nil, fmt.Errorf("clusterDepth parse error [%v]", err)
 		}
-		if cl > 4 {
-			return nil, fmt.Errorf("clusterDepth cannot be greater then 4")
+		if cl < 0 || cl > 4 {
+			return nil, fmt.Errorf("clusterDepth must be within 0..4")
+		}
+	}
+	var within Primitive
+	if withinStr != "" {
+		within, err = ParseArea(withinStr)
+		if err != nil {
+			return nil, fmt.Errorf("within parse error [%v]", err)
 		}
 	}
+	filter, err := ParsePropertyFilter(filterStr)
+	if err != nil {
+		return nil, fmt.Errorf("filter parse error [%v]", err)
+	}
 	return &MapRequest{
 		BBox:         bbox,
 		TileBBox:     tileBBox,
@@ -53,5 +104,79 @@ func ParseMapRequest(coordsStr, tileStr, zoomStr, callbackID, debugStr, clusterD
 		CallbackID:   callbackID,
 		Debug:        debug,
 		ClusterDepth: cl,
+		Adaptive:     adaptive,
+		MaxMarkers:   maxMarkers,
+		Within:       within,
+		Filter:       filter,
+		Layers:       ParseLayers(layerStr),
 	}, nil
 }
+
+// LayerNames returns requested layers or default layer if none requested
+func (m *MapRequest) LayerNames() []string {
+	if len(m.Layers) == 0 {
+		return []string{DefaultLayer}
+	}
+	return m.Layers
+}
+
+// TileClusterDepth returns cluster depth of tile
+func (m *MapRequest) TileClusterDepth(tileID int64) int64 {
+	if depth, ok := m.ClusterDepths[tileID]; ok {
+		return depth
+	}
+	return m.ClusterDepth
+}
+
+// SetTileClusterDepth records depth chosen for tile in adaptive mode
+func (m *MapRequest) SetTileClusterDepth(tileID int64, depth int64) {
+	if m.ClusterDepths == nil {
+		m.ClusterDepths = make(map[int64]int64)
+	}
+	if old, ok := m.ClusterDepths[tileID]; !ok || depth > old {
+		m.ClusterDepths[tileID] = depth
+	}
+}
+
+// LoadByDepth records adaptive depths of tiles and calls load for every depth in ascending order
+// with copy of request clustered at it, tiles of the same depth are loaded at once.
+func (m *MapRequest) LoadByDepth(tileIDs []int64, depths map[int64]int64, load func(mr *MapRequest, tileIDs []int64) error) error {
+	byDepth := make(map[int64][]int64)
+	order := make([]int64, 0)
+	for _, tileID := range tileIDs {
+		depth := depths[tileID]
+		m.SetTileClusterDepth(tileID, depth)
+		if _, ok := byDepth[depth]; !ok {
+			order = append(order, depth)
+		}
+		byDepth[depth] = append(byDepth[depth], tileID)
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i] < order[j] })
+	for _, depth := range order {
+		dmr := *m
+		dmr.ClusterDepth = depth
+		err := load(&dmr, byDepth[depth])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChooseClusterDepth returns depth of tile with total objects in adaptive mode.
+// subTiles[i] is number of non-empty sub-tiles of depth i+1, it never decreases with depth,
+// so the deepest level which still fits into maxMarkers is chosen.
+// Tile with no more than maxMarkers objects gets fullDepth, so its objects are not clustered.
+func ChooseClusterDepth(total int64, subTiles []int64, maxMarkers int64, fullDepth int64) int64 {
+	if total <= maxMarkers {
+		return fullDepth
+	}
+	var depth int64
+	for i, n := range subTiles {
+		if n > maxMarkers {
+			break
+		}
+		depth = int64(i + 1)
+	}
+	return depth
+}
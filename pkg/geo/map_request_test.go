@@ -1,14 +1,15 @@
 package geo
 
 import (
+	"errors"
 	"github.com/stretchr/testify/suite"
 	"testing"
 )
 
 type MapRequestCase struct {
-	coordsStr, tileStr, zoomStr, callbackID, debugStr, clusterDepthStr string
-	Result                                                             *MapRequest
-	Error                                                              bool
+	coordsStr, tileStr, zoomStr, callbackID, debugStr, clusterDepthStr, withinStr, filterStr, layerStr string
+	Result                                                                                             *MapRequest
+	Error                                                                                              bool
 }
 
 var cases = []MapRequestCase{
@@ -63,6 +64,65 @@ var cases = []MapRequestCase{
 			CallbackID: "asd",
 		},
 	},
+	{
+		tileStr:  "1,2,3,4",
+		zoomStr:  "1",
+		layerStr: "metro, bus,metro,",
+		Result: &MapRequest{
+			TileBBox: TileBBox{
+				TileXMin: 1,
+				TileXMax: 3,
+				TileYMin: 2,
+				TileYMax: 4,
+			},
+			Zoom:   1,
+			Layers: []string{"metro", "bus"},
+		},
+	},
+	{
+		tileStr:         "1,2,3,4",
+		zoomStr:         "1",
+		clusterDepthStr: "auto",
+		Result: &MapRequest{
+			TileBBox: TileBBox{
+				TileXMin: 1,
+				TileXMax: 3,
+				TileYMin: 2,
+				TileYMax: 4,
+			},
+			Zoom:       1,
+			Adaptive:   true,
+			MaxMarkers: DefaultMaxMarkers,
+		},
+	},
+	{
+		tileStr:         "1,2,3,4",
+		zoomStr:         "1",
+		clusterDepthStr: "auto:32",
+		Result: &MapRequest{
+			TileBBox: TileBBox{
+				TileXMin: 1,
+				TileXMax: 3,
+				TileYMin: 2,
+				TileYMax: 4,
+			},
+			Zoom:       1,
+			Adaptive:   true,
+			MaxMarkers: 32,
+		},
+	},
+	{
+		tileStr:         "1,2,3,4",
+		zoomStr:         "1",
+		clusterDepthStr: "auto:0",
+		Error:           true,
+	},
+	{
+		tileStr:         "1,2,3,4",
+		zoomStr:         "1",
+		clusterDepthStr: "automatic",
+		Error:           true,
+	},
 }
 
 func TestMapRequestSuite(t *testing.T) {
@@ -75,7 +135,7 @@ type MapRequestSuite struct {
 
 func (s *MapRequestSuite) TestParseMapRequest() {
 	for i, rc := range cases {
-		mr, err := ParseMapRequest(rc.coordsStr, rc.tileStr, rc.zoomStr, rc.callbackID, rc.debugStr, rc.clusterDepthStr)
+		mr, err := ParseMapRequest(rc.coordsStr, rc.tileStr, rc.zoomStr, rc.callbackID, rc.debugStr, rc.clusterDepthStr, rc.withinStr, rc.filterStr, rc.layerStr)
 		if !s.EqualValues(rc.Result, mr) {
 			s.Failf("TestParseMapRequest", "fail on %d: err=[%v]", i, err)
 			return
@@ -86,3 +146,114 @@ func (s *MapRequestSuite) TestParseMapRequest() {
 		}
 	}
 }
+
+func (s *MapRequestSuite) TestParseMapRequestWithin() {
+	mr, err := ParseMapRequest("", "0,0,1,1", "1", "", "", "", gardenRing, "", "")
+	if !s.Nil(err) {
+		return
+	}
+	ring, ok := mr.Within.(*GeographicPolygon)
+	if !s.True(ok) {
+		return
+	}
+	s.Len(ring.Points, 13)
+
+	// Google example https://developers.google.com/maps/documentation/utilities/polylinealgorithm
+	mr, err = ParseMapRequest("", "0,0,1,1", "1", "", "", "", "_p~iF~ps|U_ulLnnqC_mqNvxq`@", "", "")
+	if !s.Nil(err) {
+		return
+	}
+	triangle, ok := mr.Within.(*GeographicPolygon)
+	if !s.True(ok) {
+		return
+	}
+	s.Equal([]*GeographicPoint{
+		{Latitude: 38.5, Longitude: -120.2},
+		{Latitude: 40.7, Longitude: -120.95},
+		{Latitude: 43.252, Longitude: -126.453},
+		{Latitude: 38.5, Longitude: -120.2},
+	}, triangle.Points)
+	s.Equal("_p~iF~ps|U_ulLnnqC_mqNvxq`@", EncodePolyline(triangle.Points[:3]))
+	s.True(triangle.ContainsPoint(&GeographicPoint{Latitude: 41, Longitude: -122}))
+
+	_, err = ParseMapRequest("", "0,0,1,1", "1", "", "", "", "_p~iF~ps|U", "", "")
+	s.NotNil(err)
+	_, err = ParseMapRequest("", "0,0,1,1", "1", "", "", "", "POLYGON((1 1,2 2", "", "")
+	s.NotNil(err)
+}
+
+func (s *MapRequestSuite) TestParseMapRequestFilter() {
+	minTraffic, maxTraffic := 1000.0, 5000.0
+	expected := PropertyFilter{
+		{Key: "line", Op: FilterEq, Values: []interface{}{"3"}},
+		{Key: "type", Op: FilterIn, Values: []interface{}{"metro", "mcd"}},
+		{Key: "traffic", Op: FilterRange, Min: &minTraffic, Max: &maxTraffic},
+	}
+	mr, err := ParseMapRequest("", "0,0,1,1", "1", "", "", "", "", "line:3,type:metro|mcd,traffic:1000..5000", "")
+	if !s.Nil(err) {
+		return
+	}
+	s.Equal(expected, mr.Filter)
+
+	mr, err = ParseMapRequest("", "0,0,1,1", "1", "", "", "", "", `{"line":3,"type":{"in":["metro","mcd"]},"traffic":{"gte":1000}}`, "")
+	if !s.Nil(err) {
+		return
+	}
+	s.Equal(PropertyFilter{
+		{Key: "line", Op: FilterEq, Values: []interface{}{3.0}},
+		{Key: "traffic", Op: FilterRange, Min: &minTraffic},
+		{Key: "type", Op: FilterIn, Values: []interface{}{"metro", "mcd"}},
+	}, mr.Filter)
+
+	s.True(mr.Filter.Match(map[string]interface{}{"line": "3", "type": "mcd", "traffic": 1200.0}))
+	s.True(mr.Filter.Match(map[string]interface{}{"line": 3.0, "type": "metro", "traffic": 1000.0}))
+	s.False(mr.Filter.Match(map[string]interface{}{"line": 3.0, "type": "metro", "traffic": 999.0}))
+	s.False(mr.Filter.Match(map[string]interface{}{"line": 3.0, "type": "metro", "traffic": "1200"}))
+	s.False(mr.Filter.Match(map[string]interface{}{"line": 4.0, "type": "metro", "traffic": 1200.0}))
+	s.False(mr.Filter.Match(map[string]interface{}{"type": "metro", "traffic": 1200.0}))
+	s.True(PropertyFilter(nil).Match(nil))
+
+	for _, filter := range []string{"line", "line:3,", "traffic:a..b", `{"line":null}`, `{"line":{"gte":"a"}}`, `{"line":{}}`} {
+		_, err = ParseMapRequest("", "0,0,1,1", "1", "", "", "", "", filter, "")
+		s.NotNil(err, filter)
+	}
+}
+
+func (s *MapRequestSuite) TestChooseClusterDepth() {
+	// sparse tile is not clustered
+	s.Equal(int64(15), ChooseClusterDepth(10, []int64{2, 5, 9}, 16, 15))
+	// the deepest depth fitting into markers
+	s.Equal(int64(2), ChooseClusterDepth(100, []int64{3, 12, 40, 90}, 16, 15))
+	// too dense even for first sub-tiles
+	s.Equal(int64(0), ChooseClusterDepth(100, []int64{4, 16, 64}, 2, 15))
+	// all depths fit
+	s.Equal(int64(3), ChooseClusterDepth(100, []int64{4, 8, 16}, 16, 15))
+}
+
+func (s *MapRequestSuite) TestLoadByDepth() {
+	mr := &MapRequest{Zoom: 10, ClusterDepth: 2}
+	depths := map[int64]int64{1: 3, 2: 1, 3: 3, 4: 0}
+	loaded := make([]int64, 0)
+	err := mr.LoadByDepth([]int64{1, 2, 3, 4}, depths, func(dmr *MapRequest, tileIDs []int64) error {
+		loaded = append(loaded, dmr.ClusterDepth)
+		for _, tileID := range tileIDs {
+			s.Equal(depths[tileID], dmr.ClusterDepth, tileID)
+		}
+		return nil
+	})
+	s.Nil(err)
+	s.Equal([]int64{0, 1, 3}, loaded)
+	s.Equal(int64(2), mr.ClusterDepth)
+	for tileID, depth := range depths {
+		s.Equal(depth, mr.TileClusterDepth(tileID), tileID)
+	}
+
+	failure := errors.New("failure")
+	calls := 0
+	err = mr.LoadByDepth([]int64{1, 2}, depths, func(dmr *MapRequest, tileIDs []int64) error {
+		calls++
+		return failure
+	})
+	s.ErrorIs(err, failure)
+	s.Equal(1, calls)
+}
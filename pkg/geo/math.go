@@ -1,6 +1,9 @@
 package geo
 
-import "math"
+import (
+	"errors"
+	"math"
+)
 
 func CycleRestrict(value, min, max float64) float64 {
 	return value - math.Floor((value-min)/(max-min))*(max-min)
@@ -25,3 +28,112 @@ func RoundToDigit(v float64, n int) float64 {
 	var m = math.Pow(10, float64(n))
 	return math.RoundToEven(v*m) / m
 }
+
+// MeanEarthRadius is IUGG mean radius of Earth in meters
+const MeanEarthRadius = 6371008.8
+
+// HaversineDistance returns great-circle distance in meters between two points
+func HaversineDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	var phi1 = DegreesToRadians(lat1)
+	var phi2 = DegreesToRadians(lat2)
+	var dPhi = DegreesToRadians(lat2 - lat1)
+	var dLambda = DegreesToRadians(lon2 - lon1)
+	var a = math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * MeanEarthRadius * math.Asin(math.Sqrt(math.Min(a, 1)))
+}
+
+// Flattening of WGS84 ellipsoid
+const Flattening = 1 / 298.257223563
+
+// MinorEarthRadius is polar semi-axis of WGS84 ellipsoid in meters
+const MinorEarthRadius = MajorEarthRadius * (1 - Flattening)
+
+var ErrVincentyNotConverged = errors.New("vincenty formula failed to converge")
+
+// VincentyDistance returns distance in meters between two points on WGS84 ellipsoid
+// https://en.wikipedia.org/wiki/Vincenty%27s_formulae#Inverse_problem
+func VincentyDistance(lat1, lon1, lat2, lon2 float64) (float64, error) {
+	var a, b, f = MajorEarthRadius, MinorEarthRadius, Flattening
+	var l = DegreesToRadians(lon2 - lon1)
+	var u1 = math.Atan((1 - f) * math.Tan(DegreesToRadians(lat1)))
+	var u2 = math.Atan((1 - f) * math.Tan(DegreesToRadians(lat2)))
+	var sinU1, cosU1 = math.Sincos(u1)
+	var sinU2, cosU2 = math.Sincos(u2)
+
+	var lambda = l
+	var sinSigma, cosSigma, sigma, cosSqAlpha, cos2SigmaM float64
+	for i := 0; ; i++ {
+		if i == 200 {
+			return 0, ErrVincentyNotConverged
+		}
+		var sinLambda, cosLambda = math.Sincos(lambda)
+		sinSigma = math.Hypot(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+		if sinSigma == 0 {
+			// coincident points
+			return 0, nil
+		}
+		cosSigma = sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma = math.Atan2(sinSigma, cosSigma)
+		var sinAlpha = cosU1 * cosU2 * sinLambda / sinSigma
+		cosSqAlpha = 1 - sinAlpha*sinAlpha
+		cos2SigmaM = 0
+		if cosSqAlpha != 0 {
+			// equatorial line has cosSqAlpha=0
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha
+		}
+		var c = f / 16 * cosSqAlpha * (4 + f*(4-3*cosSqAlpha))
+		var prevLambda = lambda
+		lambda = l + (1-c)*f*sinAlpha*(sigma+c*sinSigma*(cos2SigmaM+c*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-prevLambda) < 1e-12 {
+			break
+		}
+	}
+	var uSq = cosSqAlpha * (a*a - b*b) / (b * b)
+	var bigA = 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+	var bigB = uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+	var deltaSigma = bigB * sinSigma * (cos2SigmaM + bigB/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+		bigB/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+	return b * bigA * (sigma - deltaSigma), nil
+}
+
+// InitialBearing returns bearing in degrees [0,360) of great-circle path from first point to second
+func InitialBearing(lat1, lon1, lat2, lon2 float64) float64 {
+	var phi1 = DegreesToRadians(lat1)
+	var phi2 = DegreesToRadians(lat2)
+	var dLambda = DegreesToRadians(lon2 - lon1)
+	var y = math.Sin(dLambda) * math.Cos(phi2)
+	var x = math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLambda)
+	return CycleRestrict(RadiansToDegrees(math.Atan2(y, x)), 0, 360)
+}
+
+// DestinationPoint returns point reached by moving along great-circle
+// from start point with initial bearing in degrees for distance in meters
+func DestinationPoint(lat, lon, bearing, distance float64) (float64, float64) {
+	var delta = distance / MeanEarthRadius
+	var theta = DegreesToRadians(bearing)
+	var phi1 = DegreesToRadians(lat)
+	var lambda1 = DegreesToRadians(lon)
+	var sinPhi2 = math.Sin(phi1)*math.Cos(delta) + math.Cos(phi1)*math.Sin(delta)*math.Cos(theta)
+	var phi2 = math.Asin(sinPhi2)
+	var y = math.Sin(theta) * math.Sin(delta) * math.Cos(phi1)
+	var x = math.Cos(delta) - math.Sin(phi1)*sinPhi2
+	var lambda2 = lambda1 + math.Atan2(y, x)
+	return RadiansToDegrees(phi2), CycleRestrict(RadiansToDegrees(lambda2), MinLon, MaxLon)
+}
+
+// SphericalRingArea returns area in square meters of closed ring on sphere.
+// Ring is closed implicitly if last point is not equal to first.
+// https://trs.jpl.nasa.gov/handle/2014/41271
+func SphericalRingArea(points []*GeographicPoint) float64 {
+	if len(points) < 3 {
+		return 0
+	}
+	var sum float64
+	for i := range points {
+		p1 := points[i]
+		p2 := points[(i+1)%len(points)]
+		dLambda := DegreesToRadians(p2.Longitude - p1.Longitude)
+		sum += dLambda * (2 + math.Sin(DegreesToRadians(p1.Latitude)) + math.Sin(DegreesToRadians(p2.Latitude)))
+	}
+	return math.Abs(sum * MeanEarthRadius * MeanEarthRadius / 2)
+}
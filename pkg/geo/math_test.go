@@ -0,0 +1,96 @@
+package geo
+
+import (
+	"github.com/stretchr/testify/suite"
+	"math"
+	"testing"
+)
+
+func TestMathSuite(t *testing.T) {
+	suite.Run(t, new(MathSuite))
+}
+
+type MathSuite struct {
+	suite.Suite
+}
+
+func (s *MathSuite) TestVincentyDistance() {
+	// Flinders Peak - Buninyong, original example from Vincenty paper
+	d, err := VincentyDistance(-37.951033416, 144.424867889, -37.652821139, 143.926495528)
+	if !s.Nil(err) {
+		return
+	}
+	s.InDelta(54972.271, d, 0.001)
+
+	d, err = VincentyDistance(55.69329, 37.534511, 55.69329, 37.534511)
+	if !s.Nil(err) {
+		return
+	}
+	s.Equal(0.0, d)
+
+	_, err = VincentyDistance(0, 0, 0.5, 179.7)
+	s.ErrorIs(err, ErrVincentyNotConverged)
+}
+
+func (s *MathSuite) TestHaversineDistance() {
+	// one degree of meridian
+	d := HaversineDistance(0, 0, 1, 0)
+	s.InDelta(MeanEarthRadius*math.Pi/180, d, 1e-6)
+	vd, err := VincentyDistance(55.69329, 37.534511, 55.676549, 37.504584)
+	if !s.Nil(err) {
+		return
+	}
+	hd := HaversineDistance(55.69329, 37.534511, 55.676549, 37.504584)
+	s.InEpsilon(vd, hd, 0.005)
+}
+
+func (s *MathSuite) TestBearingAndDestination() {
+	s.InDelta(0, InitialBearing(0, 0, 1, 0), 1e-9)
+	s.InDelta(90, InitialBearing(0, 0, 0, 1), 1e-9)
+	s.InDelta(180, InitialBearing(1, 0, 0, 0), 1e-9)
+	s.InDelta(270, InitialBearing(0, 1, 0, 0), 1e-9)
+
+	for bearing := 0.0; bearing < 360; bearing += 45 {
+		lat, lon := DestinationPoint(55.69329, 37.534511, bearing, 5000)
+		s.InDelta(5000, HaversineDistance(55.69329, 37.534511, lat, lon), 1e-6)
+		s.InDelta(bearing, InitialBearing(55.69329, 37.534511, lat, lon), 1e-6)
+	}
+	_, lon := DestinationPoint(0, 179.9, 90, 100000)
+	s.Less(lon, 0.0)
+}
+
+func (s *MathSuite) TestPolygonAreaAndPerimeter() {
+	gs := NewGeographicSystem(DefaultGeoSystemConfig)
+	polygon := &GeographicPolygon{
+		Points: []*GeographicPoint{
+			{Latitude: 0, Longitude: 0},
+			{Latitude: 0, Longitude: 1},
+			{Latitude: 1, Longitude: 1},
+			{Latitude: 1, Longitude: 0},
+		},
+	}
+	expectedArea := MeanEarthRadius * MeanEarthRadius * DegreesToRadians(1) * math.Sin(DegreesToRadians(1))
+	s.InEpsilon(expectedArea, polygon.Area(), 1e-9)
+	s.InEpsilon(4*MeanEarthRadius*DegreesToRadians(1), polygon.Perimeter(), 1e-4)
+
+	// tile polygon repeats each vertex, it should not affect the result
+	tile := gs.TileXYToPolygon(0, 0, 1)
+	s.InEpsilon(tile.Perimeter(), (&GeographicPolygon{Points: []*GeographicPoint{
+		tile.Points[0], tile.Points[2], tile.Points[4], tile.Points[6],
+	}}).Perimeter(), 1e-9)
+
+	// hole is subtracted from area and its border is added to perimeter
+	outer := &GeographicPolygon{Points: []*GeographicPoint{
+		{Latitude: 0, Longitude: 0}, {Latitude: 0, Longitude: 10}, {Latitude: 10, Longitude: 10},
+		{Latitude: 10, Longitude: 0}, {Latitude: 0, Longitude: 0},
+	}}
+	hole := &GeographicPolygon{Points: []*GeographicPoint{
+		{Latitude: 4, Longitude: 4}, {Latitude: 6, Longitude: 4}, {Latitude: 6, Longitude: 6},
+		{Latitude: 4, Longitude: 6}, {Latitude: 4, Longitude: 4},
+	}}
+	holed := &GeographicPolygon{Points: append(append([]*GeographicPoint{}, outer.Points...), hole.Points...)}
+	s.InEpsilon(outer.Area()-hole.Area(), holed.Area(), 1e-9)
+	s.Less(holed.Area(), outer.Area())
+	s.InEpsilon(outer.Perimeter()+hole.Perimeter(), holed.Perimeter(), 1e-9)
+	s.InDelta(5.31e6, holed.Perimeter(), 0.01e6)
+}
@@ -0,0 +1,76 @@
+package geo
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	DefaultNearbyRadius = 1000
+	DefaultNearbyLimit  = 10
+	MaxNearbyRadius     = 50000
+	MaxNearbyLimit      = 100
+)
+
+// NearbyRequest describes search of objects around the point.
+// Radius is set in meters.
+type NearbyRequest struct {
+	Lat        float64
+	Lon        float64
+	Radius     float64
+	Limit      int64
+	CallbackID string
+}
+
+// ParseNearbyRequest from query strings
+func ParseNearbyRequest(latStr, lonStr, radiusStr, limitStr, callbackID string) (*NearbyRequest, error) {
+	lat, err := strconv.ParseFloat(latStr, 64)
+	if err != nil {
+		return nil, fmt.Errorf("lat parse error [%v]", err)
+	}
+	// negated checks also refuse NaN
+	if !(lat >= MinLat && lat <= MaxLat) {
+		return nil, fmt.Errorf("lat must be in range [%v,%v]", MinLat, MaxLat)
+	}
+	lon, err := strconv.ParseFloat(lonStr, 64)
+	if err != nil {
+		return nil, fmt.Errorf("lon parse error [%v]", err)
+	}
+	if !(lon >= MinLon && lon <= MaxLon) {
+		return nil, fmt.Errorf("lon must be in range [%v,%v]", MinLon, MaxLon)
+	}
+	var radius float64 = DefaultNearbyRadius
+	if radiusStr != "" {
+		radius, err = strconv.ParseFloat(radiusStr, 64)
+		if err != nil {
+			return nil, fmt.Errorf("radius parse error [%v]", err)
+		}
+		if !(radius > 0 && radius <= MaxNearbyRadius) {
+			return nil, fmt.Errorf("radius must be in range (0,%d]", MaxNearbyRadius)
+		}
+	}
+	var limit int64 = DefaultNearbyLimit
+	if limitStr != "" {
+		limit, err = strconv.ParseInt(limitStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("limit parse error [%v]", err)
+		}
+		if limit <= 0 || limit > MaxNearbyLimit {
+			return nil, fmt.Errorf("limit must be in range (0,%d]", MaxNearbyLimit)
+		}
+	}
+	return &NearbyRequest{
+		Lat:        lat,
+		Lon:        lon,
+		Radius:     radius,
+		Limit:      limit,
+		CallbackID: callbackID,
+	}, nil
+}
+
+func (n *NearbyRequest) Center() *GeographicPoint {
+	return &GeographicPoint{
+		Latitude:  n.Lat,
+		Longitude: n.Lon,
+	}
+}
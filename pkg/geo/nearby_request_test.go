@@ -0,0 +1,42 @@
+package geo
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+func TestNearbyRequestSuite(t *testing.T) {
+	suite.Run(t, new(NearbyRequestSuite))
+}
+
+type NearbyRequestSuite struct {
+	suite.Suite
+}
+
+func (s *NearbyRequestSuite) TestParse() {
+	cases := []struct {
+		lat, lon, radius string
+		valid            bool
+	}{
+		{lat: "55.75", lon: "37.61", radius: "", valid: true},
+		{lat: "55.75", lon: "37.61", radius: "50000", valid: true},
+		{lat: "-85", lon: "180", radius: "1", valid: true},
+		{lat: "91", lon: "37.61", radius: ""},
+		{lat: "55.75", lon: "-181", radius: ""},
+		{lat: "55.75", lon: "37.61", radius: "0"},
+		{lat: "55.75", lon: "37.61", radius: "50001"},
+		{lat: "NaN", lon: "37.61", radius: ""},
+		{lat: "55.75", lon: "NaN", radius: ""},
+		{lat: "55.75", lon: "37.61", radius: "NaN"},
+		{lat: "NaN", lon: "37.61", radius: "NaN"},
+		{lat: "55.75", lon: "37.61", radius: "+Inf"},
+		{lat: "-Inf", lon: "37.61", radius: ""},
+	}
+	for _, c := range cases {
+		nr, err := ParseNearbyRequest(c.lat, c.lon, c.radius, "", "")
+		s.Equal(c.valid, err == nil, c, err)
+		if c.valid && err == nil {
+			s.Equal(int64(DefaultNearbyLimit), nr.Limit)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package geo
+
+import (
+	"fmt"
+)
+
+type PositionMethod string
+
+const (
+	// PositionCentroid is geometric center of cluster members
+	PositionCentroid PositionMethod = "centroid"
+	// PositionWeighted is center of cluster members weighted by numeric property
+	PositionWeighted PositionMethod = "weighted"
+	// PositionMedoid is the member nearest to the centroid, so marker is always placed at real object
+	PositionMedoid PositionMethod = "medoid"
+	// PositionTileCenter is center of cluster tile
+	PositionTileCenter PositionMethod = "tile_center"
+)
+
+// ClusterPlacement describes where cluster marker is placed and which member represents cluster
+type ClusterPlacement struct {
+	Position PositionMethod `json:"position,omitempty" yaml:"position,omitempty"`
+	// Weight is numeric property of weighted position, members without weight are not taken into account
+	Weight string `json:"weight,omitempty" yaml:"weight,omitempty"`
+	// Priority is numeric property, the member with highest priority represents cluster.
+	// Members without priority go last, ties and clusters without priority fall back to lowest id.
+	Priority string `json:"priority,omitempty" yaml:"priority,omitempty"`
+}
+
+func (p *ClusterPlacement) Validate() error {
+	switch p.Position {
+	case "", PositionCentroid, PositionMedoid, PositionTileCenter:
+	case PositionWeighted:
+		if p.Weight == "" {
+			return fmt.Errorf("placement: weight property expected for %s position", p.Position)
+		}
+	default:
+		return fmt.Errorf("placement: unknown position %q", p.Position)
+	}
+	return nil
+}
+
+// PositionMethod returns position of placement, centroid if not set
+func (p *ClusterPlacement) PositionMethod() PositionMethod {
+	if p == nil || p.Position == "" {
+		return PositionCentroid
+	}
+	return p.Position
+}
+
+// PriorityProperty returns priority property of placement, empty if not set
+func (p *ClusterPlacement) PriorityProperty() string {
+	if p == nil {
+		return ""
+	}
+	return p.Priority
+}
+
+// WeightProperty returns weight property of placement, empty if not set
+func (p *ClusterPlacement) WeightProperty() string {
+	if p == nil {
+		return ""
+	}
+	return p.Weight
+}
@@ -0,0 +1,338 @@
+package geo
+
+import (
+	"math"
+)
+
+// Predicates work in plane of latitude and longitude,
+// that is precise enough for areas of a city size which do not cross antimeridian.
+
+// shape is a flat representation of primitive: single point or polygon.
+// Polygon with holes is a set of rings, which is handled by even-odd rule.
+type shape struct {
+	points []*GeographicPoint
+	rings  [][]*GeographicPoint
+	area   bool
+}
+
+func polygonShape(points []*GeographicPoint) shape {
+	return shape{points: points, rings: splitRings(points), area: true}
+}
+
+// splitRings restores rings of polygon from the list of points,
+// every ring ends with the point equal to its first one
+func splitRings(points []*GeographicPoint) [][]*GeographicPoint {
+	rings := make([][]*GeographicPoint, 0, 1)
+	for start := 0; start < len(points); {
+		end := len(points) - 1
+		for i := start + 1; i < len(points); i++ {
+			if samePoint(points[start], points[i]) {
+				end = i
+				break
+			}
+		}
+		rings = append(rings, points[start:end+1])
+		start = end + 1
+	}
+	return rings
+}
+
+func shapesOf(p Primitive) []shape {
+	switch g := p.(type) {
+	case *GeographicPoint:
+		return []shape{{points: []*GeographicPoint{g}}}
+	case *GeographicPolygon:
+		return []shape{polygonShape(g.Points)}
+	case *GeographicMultiPolygon:
+		result := make([]shape, 0, len(g.Polygons))
+		for _, polygon := range g.Polygons {
+			result = append(result, polygonShape(polygon.Points))
+		}
+		return result
+	case *GeographicCollection:
+		result := make([]shape, 0, len(g.Figures))
+		for _, figure := range g.Figures {
+			result = append(result, shapesOf(figure)...)
+		}
+		return result
+	}
+	return nil
+}
+
+// BBoxOf returns bounding box of primitive
+func BBoxOf(p Primitive) BBox {
+	var points []*GeographicPoint
+	for _, s := range shapesOf(p) {
+		points = append(points, s.points...)
+	}
+	return pointsBBox(points)
+}
+
+// Contains reports whether b lies inside a
+func Contains(a, b Primitive) bool {
+	outer := shapesOf(a)
+	inner := shapesOf(b)
+	if len(inner) == 0 {
+		return false
+	}
+	for _, in := range inner {
+		var ok bool
+		for _, out := range outer {
+			if out.contains(in) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Within reports whether a lies inside b
+func Within(a, b Primitive) bool {
+	return Contains(b, a)
+}
+
+// Intersects reports whether a and b have at least one common point
+func Intersects(a, b Primitive) bool {
+	for _, sa := range shapesOf(a) {
+		for _, sb := range shapesOf(b) {
+			if sa.intersects(sb) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *GeographicPoint) BBox() BBox {
+	return pointsBBox([]*GeographicPoint{p})
+}
+
+func (p *GeographicPolygon) BBox() BBox {
+	return pointsBBox(p.Points)
+}
+
+// ContainsPoint reports whether point lies inside polygon
+func (p *GeographicPolygon) ContainsPoint(point *GeographicPoint) bool {
+	return polygonShape(p.Points).containsPoint(point)
+}
+
+func (p *GeographicPolygon) Intersects(other Primitive) bool {
+	return Intersects(p, other)
+}
+
+func (p *GeographicMultiPolygon) BBox() BBox {
+	return BBoxOf(p)
+}
+
+// ContainsPoint reports whether point lies inside any of polygons
+func (p *GeographicMultiPolygon) ContainsPoint(point *GeographicPoint) bool {
+	for _, polygon := range p.Polygons {
+		if polygon.ContainsPoint(point) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *GeographicMultiPolygon) Intersects(other Primitive) bool {
+	return Intersects(p, other)
+}
+
+func (r *BBox) ContainsPoint(point *GeographicPoint) bool {
+	return point.Latitude >= r.XMin && point.Latitude <= r.XMax &&
+		point.Longitude >= r.YMin && point.Longitude <= r.YMax
+}
+
+func (r *BBox) Intersects(other BBox) bool {
+	return r.XMin <= other.XMax && other.XMin <= r.XMax &&
+		r.YMin <= other.YMax && other.YMin <= r.YMax
+}
+
+func pointsBBox(points []*GeographicPoint) BBox {
+	if len(points) == 0 {
+		return BBox{}
+	}
+	bbox := BBox{
+		XMin: math.Inf(1),
+		XMax: math.Inf(-1),
+		YMin: math.Inf(1),
+		YMax: math.Inf(-1),
+	}
+	for _, point := range points {
+		bbox.XMin = math.Min(bbox.XMin, point.Latitude)
+		bbox.XMax = math.Max(bbox.XMax, point.Latitude)
+		bbox.YMin = math.Min(bbox.YMin, point.Longitude)
+		bbox.YMax = math.Max(bbox.YMax, point.Longitude)
+	}
+	return bbox
+}
+
+// containsPoint uses ray casting with even-odd rule
+func (s shape) containsPoint(point *GeographicPoint) bool {
+	if !s.area {
+		return len(s.points) == 1 && samePoint(s.points[0], point)
+	}
+	var inside bool
+	s.iterateEdges(func(pi, pj *GeographicPoint) bool {
+		if (pi.Longitude > point.Longitude) != (pj.Longitude > point.Longitude) {
+			lat := pi.Latitude + (point.Longitude-pi.Longitude)*(pj.Latitude-pi.Latitude)/(pj.Longitude-pi.Longitude)
+			if point.Latitude < lat {
+				inside = !inside
+			}
+		}
+		return true
+	})
+	return inside
+}
+
+// boundaryEpsilon absorbs rounding of points computed on edges, like midpoints
+const boundaryEpsilon = 1e-12
+
+// onBoundary reports whether point lies on edge of s
+func (s shape) onBoundary(point *GeographicPoint) bool {
+	var on bool
+	s.iterateEdges(func(pi, pj *GeographicPoint) bool {
+		on = math.Abs(orientation(pi, pj, point)) <= boundaryEpsilon && onSegment(pi, pj, point)
+		return !on
+	})
+	return on
+}
+
+// coversPoint reports whether point lies inside s or on its boundary
+func (s shape) coversPoint(point *GeographicPoint) bool {
+	if !s.area {
+		return s.containsPoint(point)
+	}
+	return s.onBoundary(point) || s.containsPoint(point)
+}
+
+// contains reports whether other lies inside s, common boundary is allowed
+func (s shape) contains(other shape) bool {
+	if !s.area {
+		return !other.area && s.containsPoint(other.points[0])
+	}
+	bbox := pointsBBox(s.points)
+	otherBBox := pointsBBox(other.points)
+	if !bbox.Intersects(otherBBox) {
+		return false
+	}
+	for _, point := range other.points {
+		if !s.coversPoint(point) {
+			return false
+		}
+	}
+	if !other.area {
+		return true
+	}
+	// edge between boundary points may still go outside of concave s
+	var outside bool
+	other.iterateEdges(func(a, b *GeographicPoint) bool {
+		outside = !s.coversPoint(&GeographicPoint{Latitude: (a.Latitude + b.Latitude) / 2, Longitude: (a.Longitude + b.Longitude) / 2})
+		return !outside
+	})
+	if outside {
+		return false
+	}
+	// hole of s must not be inside of other
+	for _, point := range s.points {
+		if other.containsPoint(point) && !other.onBoundary(point) {
+			return false
+		}
+	}
+	return !s.edgesCrossProperly(other)
+}
+
+func (s shape) intersects(other shape) bool {
+	if len(s.points) == 0 || len(other.points) == 0 {
+		return false
+	}
+	bbox := pointsBBox(s.points)
+	otherBBox := pointsBBox(other.points)
+	if !bbox.Intersects(otherBBox) {
+		return false
+	}
+	if !s.area {
+		return other.containsPoint(s.points[0]) || (!other.area && samePoint(s.points[0], other.points[0]))
+	}
+	if !other.area {
+		return s.containsPoint(other.points[0])
+	}
+	return s.edgesCross(other) || s.containsPoint(other.points[0]) || other.containsPoint(s.points[0])
+}
+
+// iterateEdges calls cb for every edge of every ring until cb returns false
+func (s shape) iterateEdges(cb func(a, b *GeographicPoint) bool) {
+	for _, ring := range s.rings {
+		n := len(ring)
+		for i := 0; i < n; i++ {
+			if !cb(ring[i], ring[(i+1)%n]) {
+				return
+			}
+		}
+	}
+}
+
+func (s shape) edgesCross(other shape) bool {
+	var cross bool
+	s.iterateEdges(func(a1, a2 *GeographicPoint) bool {
+		other.iterateEdges(func(b1, b2 *GeographicPoint) bool {
+			cross = segmentsIntersect(a1, a2, b1, b2)
+			return !cross
+		})
+		return !cross
+	})
+	return cross
+}
+
+// edgesCrossProperly reports whether edges of shapes cross at a point interior to both of them
+func (s shape) edgesCrossProperly(other shape) bool {
+	var cross bool
+	s.iterateEdges(func(a1, a2 *GeographicPoint) bool {
+		other.iterateEdges(func(b1, b2 *GeographicPoint) bool {
+			cross = segmentsCrossProperly(a1, a2, b1, b2)
+			return !cross
+		})
+		return !cross
+	})
+	return cross
+}
+
+func samePoint(a, b *GeographicPoint) bool {
+	return a.Latitude == b.Latitude && a.Longitude == b.Longitude
+}
+
+func orientation(a, b, c *GeographicPoint) float64 {
+	return (b.Latitude-a.Latitude)*(c.Longitude-a.Longitude) - (b.Longitude-a.Longitude)*(c.Latitude-a.Latitude)
+}
+
+func onSegment(a, b, c *GeographicPoint) bool {
+	return math.Min(a.Latitude, b.Latitude) <= c.Latitude && c.Latitude <= math.Max(a.Latitude, b.Latitude) &&
+		math.Min(a.Longitude, b.Longitude) <= c.Longitude && c.Longitude <= math.Max(a.Longitude, b.Longitude)
+}
+
+// segmentsCrossProperly reports whether segments cross, touching and overlapping do not count
+func segmentsCrossProperly(a1, a2, b1, b2 *GeographicPoint) bool {
+	d1 := orientation(b1, b2, a1)
+	d2 := orientation(b1, b2, a2)
+	d3 := orientation(a1, a2, b1)
+	d4 := orientation(a1, a2, b2)
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+func segmentsIntersect(a1, a2, b1, b2 *GeographicPoint) bool {
+	if segmentsCrossProperly(a1, a2, b1, b2) {
+		return true
+	}
+	d1 := orientation(b1, b2, a1)
+	d2 := orientation(b1, b2, a2)
+	d3 := orientation(a1, a2, b1)
+	d4 := orientation(a1, a2, b2)
+	return (d1 == 0 && onSegment(b1, b2, a1)) ||
+		(d2 == 0 && onSegment(b1, b2, a2)) ||
+		(d3 == 0 && onSegment(a1, a2, b1)) ||
+		(d4 == 0 && onSegment(a1, a2, b2))
+}
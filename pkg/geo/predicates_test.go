@@ -0,0 +1,151 @@
+package geo
+
+import (
+	"github.com/stretchr/testify/suite"
+	"github.com/twpayne/go-geom"
+	"testing"
+)
+
+// gardenRing is approximate border of Moscow Garden Ring in lat,lon order
+const gardenRing = `POLYGON((55.7745 37.6328,55.7700 37.6490,55.7590 37.6560,55.7440 37.6500,55.7320 37.6400,55.7300 37.6230,
+55.7310 37.6110,55.7360 37.5960,55.7480 37.5850,55.7610 37.5830,55.7700 37.5950,55.7760 37.6140,55.7745 37.6328))`
+
+// gardenRingWithHole excludes small area around Okhotny Ryad station
+const gardenRingWithHole = `POLYGON((55.7745 37.6328,55.7700 37.6490,55.7590 37.6560,55.7440 37.6500,55.7320 37.6400,55.7300 37.6230,
+55.7310 37.6110,55.7360 37.5960,55.7480 37.5850,55.7610 37.5830,55.7700 37.5950,55.7760 37.6140,55.7745 37.6328),
+(55.756 37.614,55.758 37.614,55.758 37.616,55.756 37.616,55.756 37.614))`
+
+var insideGardenRing = map[string]*GeographicPoint{
+	"Охотный ряд":   {Latitude: 55.757228, Longitude: 37.615078},
+	"Театральная":   {Latitude: 55.758808, Longitude: 37.61768},
+	"Лубянка":       {Latitude: 55.759889, Longitude: 37.625336},
+	"Арбатская":     {Latitude: 55.752122, Longitude: 37.601553},
+	"Пушкинская":    {Latitude: 55.765607, Longitude: 37.604356},
+	"Третьяковская": {Latitude: 55.74073, Longitude: 37.625624},
+}
+
+var outsideGardenRing = map[string]*GeographicPoint{
+	"Университет":   {Latitude: 55.69329, Longitude: 37.534511},
+	"Белорусская":   {Latitude: 55.777439, Longitude: 37.582107},
+	"Комсомольская": {Latitude: 55.774072, Longitude: 37.654565},
+	"Фрунзенская":   {Latitude: 55.727462, Longitude: 37.58022},
+	"Пролетарская":  {Latitude: 55.731546, Longitude: 37.666917},
+}
+
+func TestPredicatesSuite(t *testing.T) {
+	suite.Run(t, new(PredicatesSuite))
+}
+
+type PredicatesSuite struct {
+	suite.Suite
+	ring *GeographicPolygon
+}
+
+func (s *PredicatesSuite) SetupTest() {
+	s.ring = new(GeographicPolygon)
+	s.Require().Nil(s.ring.FromGeom(FromWKT(gardenRing)))
+}
+
+func (s *PredicatesSuite) TestContainsPoint() {
+	for name, point := range insideGardenRing {
+		s.True(s.ring.ContainsPoint(point), name)
+		s.True(Within(point, s.ring), name)
+	}
+	for name, point := range outsideGardenRing {
+		s.False(s.ring.ContainsPoint(point), name)
+		s.False(Intersects(point, s.ring), name)
+	}
+}
+
+func (s *PredicatesSuite) TestPolygonWithHole() {
+	ring := new(GeographicPolygon)
+	if !s.Nil(ring.FromGeom(FromWKT(gardenRingWithHole))) {
+		return
+	}
+	s.False(ring.ContainsPoint(insideGardenRing["Охотный ряд"]))
+	s.True(ring.ContainsPoint(insideGardenRing["Лубянка"]))
+	s.False(ring.ContainsPoint(outsideGardenRing["Университет"]))
+
+	square := &BBox{XMin: 55.755, XMax: 55.759, YMin: 37.613, YMax: 37.617}
+	s.True(ring.Intersects(square.AsPolygon()))
+	s.False(Contains(ring, square.AsPolygon()))
+	s.True(Contains(s.ring, square.AsPolygon()))
+
+	gt, err := ring.ToGeom()
+	s.Require().Nil(err)
+	polygon, ok := gt.(*geom.Polygon)
+	s.Require().True(ok)
+	s.Equal(2, polygon.NumLinearRings())
+	s.Equal(13, polygon.LinearRing(0).NumCoords())
+	s.Equal(5, polygon.LinearRing(1).NumCoords())
+	restored := new(GeographicPolygon)
+	s.Require().Nil(restored.FromGeom(gt))
+	s.False(restored.ContainsPoint(insideGardenRing["Охотный ряд"]))
+	s.True(restored.ContainsPoint(insideGardenRing["Лубянка"]))
+}
+
+func (s *PredicatesSuite) TestMultiPolygon() {
+	far := &BBox{XMin: 55.69, XMax: 55.70, YMin: 37.53, YMax: 37.54}
+	mp := &GeographicMultiPolygon{Polygons: []*GeographicPolygon{s.ring, far.AsPolygon()}}
+	s.True(mp.ContainsPoint(insideGardenRing["Арбатская"]))
+	s.True(mp.ContainsPoint(outsideGardenRing["Университет"]))
+	s.False(mp.ContainsPoint(outsideGardenRing["Белорусская"]))
+	bbox := mp.BBox()
+	s.Equal(BBox{XMin: 55.69, XMax: 55.7760, YMin: 37.53, YMax: 37.6560}, bbox)
+}
+
+func (s *PredicatesSuite) TestIntersects() {
+	gs := NewGeographicSystem(DefaultGeoSystemConfig)
+	center := insideGardenRing["Театральная"]
+	qk := gs.CoordinatesToQuadKey(center.Latitude, center.Longitude)
+	tx, ty, err := gs.QuadKeySystem.QuadKeyToTileXY(qk)
+	if !s.Nil(err) {
+		return
+	}
+	// tile at zoom 9 covers whole Garden Ring
+	tile := gs.TileXYToPolygon(tx>>14, ty>>14, 9)
+	s.True(Intersects(tile, s.ring))
+	s.True(Within(s.ring, tile))
+	s.False(Within(tile, s.ring))
+
+	crossing := &BBox{XMin: 55.770, XMax: 55.780, YMin: 37.600, YMax: 37.610}
+	s.True(Intersects(s.ring, crossing.AsPolygon()))
+	s.False(Contains(s.ring, crossing.AsPolygon()))
+
+	far := &BBox{XMin: 55.69, XMax: 55.70, YMin: 37.53, YMax: 37.54}
+	s.False(Intersects(s.ring, far.AsPolygon()))
+	bbox := s.ring.BBox()
+	s.False(bbox.Intersects(*far))
+	s.True(bbox.ContainsPoint(center))
+}
+
+func (s *PredicatesSuite) TestBoundary() {
+	s.True(Contains(s.ring, s.ring))
+	s.True(Within(s.ring, s.ring))
+	square := &BBox{XMin: 55.75, XMax: 55.76, YMin: 37.61, YMax: 37.62}
+	s.True(Contains(square.AsPolygon(), square.AsPolygon()))
+	// halves share edges with square
+	half := &BBox{XMin: 55.75, XMax: 55.755, YMin: 37.61, YMax: 37.62}
+	s.True(Contains(square.AsPolygon(), half.AsPolygon()))
+	s.False(Contains(half.AsPolygon(), square.AsPolygon()))
+	corner := &BBox{XMin: 55.75, XMax: 55.751, YMin: 37.61, YMax: 37.611}
+	s.True(Within(corner.AsPolygon(), square.AsPolygon()))
+	// touching from outside intersects but is not contained
+	outside := &BBox{XMin: 55.76, XMax: 55.77, YMin: 37.61, YMax: 37.62}
+	s.True(Intersects(square.AsPolygon(), outside.AsPolygon()))
+	s.False(Contains(square.AsPolygon(), outside.AsPolygon()))
+	// vertex of square is contained
+	s.True(Contains(square.AsPolygon(), &GeographicPoint{Latitude: 55.75, Longitude: 37.61}))
+
+	// triangle between tips of U goes outside through its notch
+	u := &GeographicPolygon{Points: []*GeographicPoint{
+		{Latitude: 0, Longitude: 0}, {Latitude: 3, Longitude: 0}, {Latitude: 3, Longitude: 3}, {Latitude: 2, Longitude: 3},
+		{Latitude: 2, Longitude: 1}, {Latitude: 1, Longitude: 1}, {Latitude: 1, Longitude: 3}, {Latitude: 0, Longitude: 3},
+		{Latitude: 0, Longitude: 0},
+	}}
+	triangle := &GeographicPolygon{Points: []*GeographicPoint{
+		{Latitude: 0, Longitude: 3}, {Latitude: 3, Longitude: 3}, {Latitude: 1.5, Longitude: 0}, {Latitude: 0, Longitude: 3},
+	}}
+	s.False(Contains(u, triangle))
+	s.True(Contains(u, u))
+}
@@ -0,0 +1,214 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type FilterOperator string
+
+const (
+	FilterEq    FilterOperator = "eq"
+	FilterIn    FilterOperator = "in"
+	FilterRange FilterOperator = "range"
+)
+
+// PropertyCondition is a predicate on single property of object.
+// Eq and In compare values as text, Range accepts only numeric properties.
+type PropertyCondition struct {
+	Key    string
+	Op     FilterOperator
+	Values []interface{}
+	Min    *float64
+	Max    *float64
+}
+
+// PropertyFilter matches objects which satisfy all conditions
+type PropertyFilter []*PropertyCondition
+
+// ParsePropertyFilter parses filter in short form
+//
+//	line:3,type:metro|mcd,traffic:1000..5000
+//
+// or in JSON form
+//
+//	{"line":3,"type":{"in":["metro","mcd"]},"traffic":{"gte":1000,"lte":5000}}
+func ParsePropertyFilter(s string) (PropertyFilter, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(s, "{") {
+		return parseJSONPropertyFilter(s)
+	}
+	filter := make(PropertyFilter, 0)
+	for i, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(part, ":", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("%d element must be in key:value format", i)
+		}
+		key, value := kv[0], kv[1]
+		switch {
+		case strings.Contains(value, ".."):
+			bounds := strings.SplitN(value, "..", 2)
+			cond := &PropertyCondition{Key: key, Op: FilterRange}
+			for j, bound := range bounds {
+				if bound == "" {
+					continue
+				}
+				v, err := strconv.ParseFloat(bound, 64)
+				if err != nil {
+					return nil, fmt.Errorf("%d element range bound %v", i, err)
+				}
+				if j == 0 {
+					cond.Min = &v
+				} else {
+					cond.Max = &v
+				}
+			}
+			filter = append(filter, cond)
+		case strings.Contains(value, "|"):
+			values := make([]interface{}, 0)
+			for _, v := range strings.Split(value, "|") {
+				values = append(values, v)
+			}
+			filter = append(filter, &PropertyCondition{Key: key, Op: FilterIn, Values: values})
+		default:
+			filter = append(filter, &PropertyCondition{Key: key, Op: FilterEq, Values: []interface{}{value}})
+		}
+	}
+	return filter, nil
+}
+
+func parseJSONPropertyFilter(s string) (PropertyFilter, error) {
+	var raw map[string]interface{}
+	err := json.Unmarshal([]byte(s), &raw)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	filter := make(PropertyFilter, 0, len(keys))
+	for _, key := range keys {
+		switch v := raw[key].(type) {
+		case []interface{}:
+			filter = append(filter, &PropertyCondition{Key: key, Op: FilterIn, Values: v})
+		case map[string]interface{}:
+			cond, err := parseJSONPropertyCondition(key, v)
+			if err != nil {
+				return nil, err
+			}
+			filter = append(filter, cond)
+		case nil:
+			return nil, fmt.Errorf("%s: null value is not supported", key)
+		default:
+			filter = append(filter, &PropertyCondition{Key: key, Op: FilterEq, Values: []interface{}{v}})
+		}
+	}
+	return filter, nil
+}
+
+func parseJSONPropertyCondition(key string, predicate map[string]interface{}) (*PropertyCondition, error) {
+	if v, ok := predicate["eq"]; ok {
+		return &PropertyCondition{Key: key, Op: FilterEq, Values: []interface{}{v}}, nil
+	}
+	if v, ok := predicate["in"]; ok {
+		values, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: in operator expects array", key)
+		}
+		return &PropertyCondition{Key: key, Op: FilterIn, Values: values}, nil
+	}
+	cond := &PropertyCondition{Key: key, Op: FilterRange}
+	for op, bound := range map[string]**float64{"gte": &cond.Min, "lte": &cond.Max} {
+		v, ok := predicate[op]
+		if !ok || v == nil {
+			continue
+		}
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s operator expects number", key, op)
+		}
+		*bound = &f
+	}
+	if cond.Min == nil && cond.Max == nil {
+		return nil, fmt.Errorf("%s: one of eq, in, gte, lte operators expected", key)
+	}
+	return cond, nil
+}
+
+// Match checks properties of object against filter
+func (f PropertyFilter) Match(props map[string]interface{}) bool {
+	for _, cond := range f {
+		if !cond.Match(props[cond.Key]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *PropertyCondition) Match(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	switch c.Op {
+	case FilterEq, FilterIn:
+		text := FilterValueText(value)
+		for _, v := range c.Values {
+			if text == FilterValueText(v) {
+				return true
+			}
+		}
+		return false
+	case FilterRange:
+		f, ok := NumericValue(value)
+		if !ok {
+			return false
+		}
+		return (c.Min == nil || f >= *c.Min) && (c.Max == nil || f <= *c.Max)
+	}
+	return false
+}
+
+// NumericValue converts number of decoded properties to float64, other values are not numeric
+func NumericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// FilterValueText returns text form of value in the same way as postgres ->> operator does
+func FilterValueText(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// FilterValueVariants returns all JSON values having the same text form as v
+func FilterValueVariants(v interface{}) []interface{} {
+	text := FilterValueText(v)
+	variants := []interface{}{text}
+	if f, err := strconv.ParseFloat(text, 64); err == nil && FilterValueText(f) == text {
+		variants = append(variants, f)
+	}
+	if b, err := strconv.ParseBool(text); err == nil && strconv.FormatBool(b) == text {
+		variants = append(variants, b)
+	}
+	return variants
+}
@@ -2,8 +2,12 @@ package geo
 
 import (
 	"fmt"
+	"math/bits"
 )
 
+// MaxQuadKeyZoom is the deepest zoom whose quad keys fit into int64
+const MaxQuadKeyZoom = 31
+
 type QuadKeySystem struct {
 	minZoom   int64
 	maxZoom   int64
@@ -23,6 +27,28 @@ func NewQuadKeySystem(minZoom int64, maxZoom int64) *QuadKeySystem {
 	}
 }
 
+func (q *QuadKeySystem) MinZoom() int64 {
+	return q.minZoom
+}
+
+func (q *QuadKeySystem) MaxZoom() int64 {
+	return q.maxZoom
+}
+
+// AdaptiveDepthRange returns max depth considered by adaptive clustering at zoom
+// and depth at which tiles are not clustered at all.
+func (q *QuadKeySystem) AdaptiveDepthRange(zoom int64) (maxDepth int64, fullDepth int64) {
+	fullDepth = q.maxZoom - zoom
+	if fullDepth < 0 {
+		fullDepth = 0
+	}
+	maxDepth = fullDepth
+	if maxDepth > MaxAdaptiveDepth {
+		maxDepth = MaxAdaptiveDepth
+	}
+	return maxDepth, fullDepth
+}
+
 func (q *QuadKeySystem) TileXYToQuadKey(tx, ty int64, zoom int64) QuadKey {
 	quadKey := make([]rune, 0, DefaultMaxZoom)
 	for i := zoom; i >= q.minZoom; i-- {
@@ -92,6 +118,18 @@ func (q *QuadKeySystem) BitDelta(len int64) int64 {
 	return diff * 2
 }
 
+// SplitZoom returns minimal zoom at which quad keys of max zoom level fall into different tiles.
+// Objects of continuous quad key range split at the zoom where its bounds split.
+// Returns false if quad keys belong to the same tile of max zoom.
+func (q *QuadKeySystem) SplitZoom(minQk, maxQk int64) (int64, bool) {
+	diff := minQk ^ maxQk
+	if diff == 0 {
+		return 0, false
+	}
+	highBit := int64(bits.Len64(uint64(diff))) - 1
+	return q.maxZoom - highBit/2, true
+}
+
 func (q *QuadKeySystem) CreateMask(qk QuadKey, zoom int64, clusterLevel int64) QuadKey {
 	var mask = qk.Copy()
 	if clusterLevel <= 0 {
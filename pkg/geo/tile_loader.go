@@ -0,0 +1,100 @@
+package geo
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// LoadTilesFunc loads objects of tiles into fc
+type LoadTilesFunc func(ctx context.Context, tileIDs []int64, fc *FeatureCollection) error
+
+// TileLoader splits tiles of map request into chunks loaded concurrently.
+// Zero value loads all tiles by one call.
+type TileLoader struct {
+	// ChunkSize is maximum number of tiles loaded by one call, 0 means no limit
+	ChunkSize int
+	// Workers limits number of chunks loaded at the same time, values below 1 mean 1
+	Workers int
+}
+
+// chunks splits sorted copy of tileIDs
+func (l TileLoader) chunks(tileIDs []int64) [][]int64 {
+	sorted := make([]int64, len(tileIDs))
+	copy(sorted, tileIDs)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	if l.ChunkSize <= 0 || len(sorted) <= l.ChunkSize {
+		return [][]int64{sorted}
+	}
+	chunks := make([][]int64, 0, (len(sorted)+l.ChunkSize-1)/l.ChunkSize)
+	for len(sorted) > l.ChunkSize {
+		chunks = append(chunks, sorted[:l.ChunkSize:l.ChunkSize])
+		sorted = sorted[l.ChunkSize:]
+	}
+	return append(chunks, sorted)
+}
+
+// Load calls load for chunks of tiles sorted by id. Every chunk is loaded into its own collection
+// and collections are appended to fc in order of chunks, so result does not depend on which chunk
+// finishes first. The first error cancels context of other chunks and is returned.
+func (l TileLoader) Load(ctx context.Context, tileIDs []int64, fc *FeatureCollection, load LoadTilesFunc) error {
+	chunks := l.chunks(tileIDs)
+	if len(chunks) == 1 {
+		return load(ctx, chunks[0], fc)
+	}
+	workers := l.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(chunks) {
+		workers = len(chunks)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	results := make([]*FeatureCollection, len(chunks))
+	next := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if ctx.Err() != nil {
+					continue
+				}
+				results[i] = NewFeatureCollection()
+				err := load(ctx, chunks[i], results[i])
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+feed:
+	for i := range chunks {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, result := range results {
+		fc.Append(result)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/suite"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTileLoaderSuite(t *testing.T) {
+	suite.Run(t, new(TileLoaderSuite))
+}
+
+type TileLoaderSuite struct {
+	suite.Suite
+}
+
+// addTiles adds feature per tile, earlier chunks are loaded slower
+func addTiles(ctx context.Context, tileIDs []int64, fc *FeatureCollection) error {
+	time.Sleep(time.Duration(100-tileIDs[0]) * 100 * time.Microsecond)
+	for _, id := range tileIDs {
+		err := fc.Add(id, &GeographicPoint{Latitude: 1, Longitude: 1}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *TileLoaderSuite) TestOrder() {
+	tileIDs := []int64{9, 3, 7, 1, 5, 0, 8, 2, 6, 4}
+	for _, loader := range []TileLoader{{}, {ChunkSize: 3}, {ChunkSize: 2, Workers: 4}, {ChunkSize: 1, Workers: 100}} {
+		fc := NewFeatureCollection()
+		s.Require().Nil(loader.Load(context.Background(), tileIDs, fc, addTiles))
+		ids := make([]string, 0, len(fc.Features))
+		for _, feature := range fc.Features {
+			ids = append(ids, feature.ID)
+		}
+		s.Equal([]string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}, ids, loader)
+	}
+	// tiles of caller are not reordered
+	s.Equal(int64(9), tileIDs[0])
+}
+
+func (s *TileLoaderSuite) TestWorkers() {
+	var running, maxRunning, calls int32
+	loader := TileLoader{ChunkSize: 2, Workers: 3}
+	err := loader.Load(context.Background(), make([]int64, 20), NewFeatureCollection(), func(ctx context.Context, tileIDs []int64, fc *FeatureCollection) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	})
+	s.Nil(err)
+	s.Equal(int32(10), calls)
+	s.LessOrEqual(maxRunning, int32(3))
+}
+
+func (s *TileLoaderSuite) TestError() {
+	errLoad := errors.New("load failed")
+	var calls int32
+	loader := TileLoader{ChunkSize: 1, Workers: 2}
+	fc := NewFeatureCollection()
+	err := loader.Load(context.Background(), []int64{0, 1, 2, 3, 4, 5, 6, 7}, fc, func(ctx context.Context, tileIDs []int64, fc *FeatureCollection) error {
+		atomic.AddInt32(&calls, 1)
+		if tileIDs[0] == 0 {
+			return errLoad
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	s.ErrorIs(err, errLoad)
+	// only chunks started before the error are loaded
+	s.LessOrEqual(calls, int32(2))
+	s.Len(fc.Features, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = loader.Load(ctx, []int64{0, 1, 2}, fc, func(ctx context.Context, tileIDs []int64, fc *FeatureCollection) error {
+		return nil
+	})
+	s.ErrorIs(err, context.Canceled)
+}
@@ -0,0 +1,180 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// ParseLevel parses case insensitive level name
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(s) {
+	case "DEBUG":
+		return LevelDebug, nil
+	case "INFO", "":
+		return LevelInfo, nil
+	case "WARN", "WARNING":
+		return LevelWarn, nil
+	case "ERROR":
+		return LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level [%s]", s)
+}
+
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(strings.ToLower(l.String())), nil
+}
+
+func (l *Level) UnmarshalText(data []byte) error {
+	level, err := ParseLevel(string(data))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// Logger is structured logger, args are alternating keys and values like in log/slog
+type Logger interface {
+	Log(level Level, msg string, args ...interface{})
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+	// Enabled reports whether messages of level are written
+	Enabled(level Level) bool
+	// With returns logger which adds args to every message
+	With(args ...interface{}) Logger
+}
+
+// TextLogger writes messages as key=value lines
+type TextLogger struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	level Level
+	attrs []interface{}
+	// now is replaced in tests
+	now func() time.Time
+}
+
+func NewTextLogger(w io.Writer, level Level) *TextLogger {
+	return &TextLogger{mu: &sync.Mutex{}, w: w, level: level, now: time.Now}
+}
+
+// Nop returns logger which discards everything
+func Nop() Logger {
+	return NewTextLogger(io.Discard, LevelError+1)
+}
+
+func (t *TextLogger) Enabled(level Level) bool {
+	return level >= t.level
+}
+
+func (t *TextLogger) Log(level Level, msg string, args ...interface{}) {
+	if !t.Enabled(level) {
+		return
+	}
+	var b strings.Builder
+	b.WriteString("time=")
+	b.WriteString(t.now().Format(time.RFC3339Nano))
+	b.WriteString(" level=")
+	b.WriteString(level.String())
+	b.WriteString(" msg=")
+	b.WriteString(quote(msg))
+	appendArgs(&b, t.attrs)
+	appendArgs(&b, args)
+	b.WriteByte('\n')
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, _ = io.WriteString(t.w, b.String())
+}
+
+func (t *TextLogger) Debug(msg string, args ...interface{}) {
+	t.Log(LevelDebug, msg, args...)
+}
+
+func (t *TextLogger) Info(msg string, args ...interface{}) {
+	t.Log(LevelInfo, msg, args...)
+}
+
+func (t *TextLogger) Warn(msg string, args ...interface{}) {
+	t.Log(LevelWarn, msg, args...)
+}
+
+func (t *TextLogger) Error(msg string, args ...interface{}) {
+	t.Log(LevelError, msg, args...)
+}
+
+func (t *TextLogger) With(args ...interface{}) Logger {
+	c := *t
+	c.attrs = append(append(make([]interface{}, 0, len(t.attrs)+len(args)), t.attrs...), args...)
+	return &c
+}
+
+// appendArgs writes args as key=value pairs, value without key gets !BADKEY key like in log/slog
+func appendArgs(b *strings.Builder, args []interface{}) {
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok || i+1 == len(args) {
+			key = "!BADKEY"
+			i--
+		}
+		b.WriteByte(' ')
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(formatValue(args[i+1]))
+	}
+}
+
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return quote(val)
+	case error:
+		return quote(val.Error())
+	case time.Duration:
+		return val.String()
+	case fmt.Stringer:
+		return quote(val.String())
+	}
+	return quote(fmt.Sprint(v))
+}
+
+// quote quotes string only if it is empty or has spaces, quotes or control characters
+func quote(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '"' || r == '=' || r == 0x7f {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+func TestLoggerSuite(t *testing.T) {
+	suite.Run(t, new(LoggerSuite))
+}
+
+type LoggerSuite struct {
+	suite.Suite
+	buf    *bytes.Buffer
+	logger *TextLogger
+}
+
+func (s *LoggerSuite) SetupTest() {
+	s.buf = &bytes.Buffer{}
+	s.logger = NewTextLogger(s.buf, LevelInfo)
+	s.logger.now = func() time.Time {
+		return time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+	}
+}
+
+func (s *LoggerSuite) TestFormat() {
+	s.logger.Info("request done", "path", "/api/v1/yandex", "status", 200, "latency", 1500*time.Microsecond, "err", errors.New("bad tile"))
+	s.Equal(`time=2022-07-01T12:00:00Z level=INFO msg="request done" path=/api/v1/yandex status=200 latency=1.5ms err="bad tile"`+"\n", s.buf.String())
+}
+
+func (s *LoggerSuite) TestLevel() {
+	s.logger.Debug("hidden")
+	s.Empty(s.buf.String())
+	s.False(s.logger.Enabled(LevelDebug))
+	s.True(s.logger.Enabled(LevelWarn))
+	s.logger.Warn("shown")
+	s.Contains(s.buf.String(), "level=WARN")
+}
+
+func (s *LoggerSuite) TestWith() {
+	l := s.logger.With("component", "pgds")
+	l.Error("failed", "odd")
+	s.Contains(s.buf.String(), `msg=failed component=pgds !BADKEY=odd`)
+	s.buf.Reset()
+	s.logger.Info("plain")
+	s.NotContains(s.buf.String(), "component")
+}
+
+func (s *LoggerSuite) TestParseLevel() {
+	var l Level
+	s.Require().Nil(l.UnmarshalText([]byte("debug")))
+	s.Equal(LevelDebug, l)
+	l, err := ParseLevel("Warning")
+	s.Require().Nil(err)
+	s.Equal(LevelWarn, l)
+	_, err = ParseLevel("verbose")
+	s.Error(err)
+}
@@ -0,0 +1,79 @@
+package memds
+
+import (
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"sort"
+)
+
+const DefaultClusterMembers = 10
+
+// Layer keeps objects sorted by quad key, so objects of any tile
+// form a continuous range which is found with binary search.
+type Layer struct {
+	Name   string
+	Mapper PropertiesMapper
+	// ClusterMembers is number of objects put into ClusterData of cluster, 0 disables members loading
+	ClusterMembers int64
+	// Aggregations are computed over all members of cluster
+	Aggregations []*geo.Aggregation
+	// Placement of cluster marker and representative member, centroid and lowest id if nil
+	Placement *geo.ClusterPlacement
+	objects   []*GeoObject
+	byID      map[int64]*GeoObject
+	lastID    int64
+}
+
+func NewLayer(name string, mapper PropertiesMapper) *Layer {
+	return &Layer{
+		Name:           name,
+		Mapper:         mapper,
+		ClusterMembers: DefaultClusterMembers,
+		objects:        make([]*GeoObject, 0),
+		byID:           make(map[int64]*GeoObject),
+	}
+}
+
+func (l *Layer) store(gObj *GeoObject) {
+	if gObj.ID == 0 {
+		gObj.ID = l.lastID + 1
+	}
+	if gObj.ID > l.lastID {
+		l.lastID = gObj.ID
+	}
+	if old, ok := l.byID[gObj.ID]; ok {
+		l.remove(old)
+	}
+	i := l.search(gObj.QuadKey, gObj.ID)
+	l.objects = append(l.objects, nil)
+	copy(l.objects[i+1:], l.objects[i:])
+	l.objects[i] = gObj
+	l.byID[gObj.ID] = gObj
+}
+
+func (l *Layer) remove(obj *GeoObject) {
+	i := l.search(obj.QuadKey, obj.ID)
+	if i < len(l.objects) && l.objects[i] == obj {
+		l.objects = append(l.objects[:i], l.objects[i+1:]...)
+	}
+	delete(l.byID, obj.ID)
+}
+
+// search returns position of object in list ordered by quad key and id
+func (l *Layer) search(quadKey int64, id int64) int {
+	return sort.Search(len(l.objects), func(i int) bool {
+		o := l.objects[i]
+		if o.QuadKey == quadKey {
+			return o.ID >= id
+		}
+		return o.QuadKey > quadKey
+	})
+}
+
+// tileRange returns objects with quad_key >> bitDelta = tileID
+func (l *Layer) tileRange(tileID int64, bitDelta int64) []*GeoObject {
+	minQk := tileID << bitDelta
+	maxQk := (tileID + 1) << bitDelta
+	from := sort.Search(len(l.objects), func(i int) bool { return l.objects[i].QuadKey >= minQk })
+	to := sort.Search(len(l.objects), func(i int) bool { return l.objects[i].QuadKey >= maxQk })
+	return l.objects[from:to]
+}
@@ -0,0 +1,372 @@
+package memds
+
+import (
+	"context"
+	"fmt"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/ai-zelenin/geo-host/pkg/style"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+type PropertiesMapper func(obj *Cluster) map[string]interface{}
+
+type GeoObject struct {
+	ID         int64
+	QuadKey    int64
+	Lat        float64
+	Lon        float64
+	Properties map[string]interface{}
+}
+
+func (o *GeoObject) Point() *geo.GeographicPoint {
+	return &geo.GeographicPoint{
+		Latitude:  o.Lat,
+		Longitude: o.Lon,
+	}
+}
+
+type Cluster struct {
+	ID    int64
+	MinID int64
+	// RepresentativeID is id of member whose data is copied into GeoObject
+	RepresentativeID int64
+	Count            int64
+	ClusterData      []*GeoObject
+	Centroid         *geo.GeographicPoint
+	Aggregates       map[string]interface{}
+	GeoObject
+}
+
+// StyleObject is cluster as seen by style templates
+func (c *Cluster) StyleObject() *style.Object {
+	obj := &style.Object{ID: c.ID, Count: c.Count, Properties: c.Properties, Aggregates: c.Aggregates}
+	for _, member := range c.ClusterData {
+		obj.AddMember(member.ID, member.Properties)
+	}
+	return obj
+}
+
+type MemoryDataSource struct {
+	gs     *geo.GeographicSystem
+	mu     sync.RWMutex
+	layers map[string]*Layer
+}
+
+func NewMemoryDataSource(gs *geo.GeographicSystem, mapper PropertiesMapper) *MemoryDataSource {
+	m := &MemoryDataSource{
+		gs:     gs,
+		layers: make(map[string]*Layer),
+	}
+	m.RegisterLayer(geo.DefaultLayer, mapper)
+	return m
+}
+
+// RegisterLayer makes layer available for requests, objects of already registered layer are kept
+func (m *MemoryDataSource) RegisterLayer(name string, mapper PropertiesMapper) *Layer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	layer, ok := m.layers[name]
+	if ok {
+		layer.Mapper = mapper
+		return layer
+	}
+	layer = NewLayer(name, mapper)
+	m.layers[name] = layer
+	return layer
+}
+
+// layer must be called under lock
+func (m *MemoryDataSource) layer(name string) (*Layer, error) {
+	layer, ok := m.layers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", geo.ErrUnknownLayer, name)
+	}
+	return layer, nil
+}
+
+func (m *MemoryDataSource) LoadMapView(ctx context.Context, mr *geo.MapRequest, fc *geo.FeatureCollection) error {
+	tiles := m.gs.MRToTiles(mr)
+	tileIDs := make([]int64, 0, len(tiles))
+	for id := range tiles {
+		tileIDs = append(tileIDs, id)
+	}
+	sort.Slice(tileIDs, func(i, j int) bool { return tileIDs[i] < tileIDs[j] })
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, name := range mr.LayerNames() {
+		layer, err := m.layer(name)
+		if err != nil {
+			return err
+		}
+		err = m.loadLayerMapView(ctx, layer, mr, tileIDs, fc)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDataSource) loadLayerMapView(ctx context.Context, layer *Layer, mr *geo.MapRequest, tileIDs []int64, fc *geo.FeatureCollection) error {
+	bitDelta := m.gs.QuadKeySystem.BitDelta(mr.Zoom)
+	for _, tileID := range tileIDs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		start := time.Now()
+		objects := make([]*GeoObject, 0)
+		for _, object := range layer.tileRange(tileID, bitDelta) {
+			if match(object, mr.Within, mr.Filter) {
+				objects = append(objects, object)
+			}
+		}
+		tmr := mr
+		if mr.Adaptive {
+			depth := m.adaptiveDepth(mr.Zoom, mr.MaxMarkers, objects)
+			mr.SetTileClusterDepth(tileID, depth)
+			tileRequest := *mr
+			tileRequest.ClusterDepth = depth
+			tmr = &tileRequest
+		}
+		clusterShift := m.gs.QuadKeySystem.BitDelta(m.gs.ClusterZoom(tmr))
+		var members []*GeoObject
+		for _, object := range objects {
+			if len(members) > 0 && members[0].QuadKey>>clusterShift != object.QuadKey>>clusterShift {
+				err := m.addCluster(fc, layer, tmr, members[0].QuadKey>>clusterShift, members)
+				if err != nil {
+					return err
+				}
+				members = members[:0]
+			}
+			members = append(members, object)
+		}
+		if len(members) > 0 {
+			err := m.addCluster(fc, layer, tmr, members[0].QuadKey>>clusterShift, members)
+			if err != nil {
+				return err
+			}
+		}
+		mr.DebugInfo.AddLoad([]int64{tileID}, time.Since(start))
+	}
+	return nil
+}
+
+// adaptiveDepth chooses cluster depth of tile objects sorted by quad key
+func (m *MemoryDataSource) adaptiveDepth(zoom int64, maxMarkers int64, objects []*GeoObject) int64 {
+	maxDepth, fullDepth := m.gs.QuadKeySystem.AdaptiveDepthRange(zoom)
+	subTiles := make([]int64, maxDepth)
+	for depth := int64(1); depth <= maxDepth; depth++ {
+		shift := m.gs.QuadKeySystem.BitDelta(zoom + depth)
+		for i, object := range objects {
+			if i == 0 || objects[i-1].QuadKey>>shift != object.QuadKey>>shift {
+				subTiles[depth-1]++
+			}
+		}
+		if subTiles[depth-1] > maxMarkers {
+			break
+		}
+	}
+	return geo.ChooseClusterDepth(int64(len(objects)), subTiles, maxMarkers, fullDepth)
+}
+
+func match(object *GeoObject, within geo.Primitive, filter geo.PropertyFilter) bool {
+	if within != nil && !geo.Intersects(within, object.Point()) {
+		return false
+	}
+	return filter.Match(object.Properties)
+}
+
+func (m *MemoryDataSource) addCluster(fc *geo.FeatureCollection, layer *Layer, mr *geo.MapRequest, clusterID int64, members []*GeoObject) error {
+	minObject := members[0]
+	bbox := geo.BBox{XMin: minObject.Lat, XMax: minObject.Lat, YMin: minObject.Lon, YMax: minObject.Lon}
+	for _, member := range members {
+		if member.ID < minObject.ID {
+			minObject = member
+		}
+		bbox.XMin = math.Min(bbox.XMin, member.Lat)
+		bbox.XMax = math.Max(bbox.XMax, member.Lat)
+		bbox.YMin = math.Min(bbox.YMin, member.Lon)
+		bbox.YMax = math.Max(bbox.YMax, member.Lon)
+	}
+	rep := representative(members, layer.Placement.PriorityProperty())
+	cluster := &Cluster{
+		ID:               clusterID,
+		MinID:            minObject.ID,
+		RepresentativeID: rep.ID,
+		Count:            int64(len(members)),
+		GeoObject:        *rep,
+	}
+	id := geo.LayerFeatureID(layer.Name, cluster.ID)
+	clusterZoom := m.gs.ClusterZoom(mr)
+	mr.DebugInfo.AddCluster(layer.Name, cluster.ID, clusterZoom, cluster.Count)
+	if cluster.Count > 1 {
+		if layer.ClusterMembers > 0 {
+			cluster.ClusterData = firstByID(members, layer.ClusterMembers)
+		}
+		centroid, err := m.position(layer, members, clusterID, clusterZoom)
+		if err != nil {
+			return err
+		}
+		cluster.Centroid = centroid
+		if len(layer.Aggregations) > 0 {
+			aggregator := geo.NewAggregator(layer.Aggregations)
+			for _, member := range members {
+				aggregator.Add(member.Properties)
+			}
+			cluster.Aggregates = aggregator.Result()
+		}
+		props := layer.Mapper(cluster)
+		if props == nil {
+			props = make(map[string]interface{})
+		}
+		// members are sorted by quad key
+		minQk, maxQk := members[0].QuadKey, members[len(members)-1].QuadKey
+		for key, value := range m.gs.ClusterBoundsProperties(bbox, minQk, maxQk, mr.ClusterDepth) {
+			props[key] = value
+		}
+		if cluster.Aggregates != nil {
+			props["aggregates"] = cluster.Aggregates
+		}
+		return fc.Add(id, cluster.Centroid, props)
+	}
+	point := &geo.GeographicPoint{
+		Latitude:  cluster.Lat,
+		Longitude: cluster.Lon,
+	}
+	return fc.Add(id, point, layer.Mapper(cluster))
+}
+
+// firstByID returns copy of n objects with lowest ids
+func firstByID(objects []*GeoObject, n int64) []*GeoObject {
+	sorted := make([]*GeoObject, len(objects))
+	copy(sorted, objects)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	if int64(len(sorted)) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+type nearbyObject struct {
+	*GeoObject
+	distance float64
+}
+
+// LoadNearby scans tiles around the center whose size is comparable to the radius
+// and returns the nearest objects of default layer ordered by great-circle distance.
+func (m *MemoryDataSource) LoadNearby(ctx context.Context, nr *geo.NearbyRequest, fc *geo.FeatureCollection) error {
+	tiles, zoom := m.gs.CircleToTiles(nr.Lat, nr.Lon, nr.Radius)
+	bitDelta := m.gs.QuadKeySystem.BitDelta(zoom)
+
+	m.mu.RLock()
+	layer, err := m.layer(geo.DefaultLayer)
+	if err != nil {
+		m.mu.RUnlock()
+		return err
+	}
+	found := make([]nearbyObject, 0, nr.Limit)
+	for tileID := range tiles {
+		for _, object := range layer.tileRange(tileID, bitDelta) {
+			distance := geo.HaversineDistance(nr.Lat, nr.Lon, object.Lat, object.Lon)
+			if distance <= nr.Radius {
+				found = append(found, nearbyObject{GeoObject: object, distance: distance})
+			}
+		}
+	}
+	m.mu.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].distance == found[j].distance {
+			return found[i].ID < found[j].ID
+		}
+		return found[i].distance < found[j].distance
+	})
+	if int64(len(found)) > nr.Limit {
+		found = found[:nr.Limit]
+	}
+	for _, object := range found {
+		props := layer.Mapper(&Cluster{
+			ID:        object.ID,
+			MinID:     object.ID,
+			Count:     1,
+			GeoObject: *object.GeoObject,
+		})
+		if props == nil {
+			props = make(map[string]interface{})
+		}
+		props["distance"] = object.distance
+		point := &geo.GeographicPoint{
+			Latitude:  object.Lat,
+			Longitude: object.Lon,
+		}
+		err := fc.Add(object.ID, point, props)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDataSource) LoadClusterMembers(ctx context.Context, cr *geo.ClusterMembersRequest, fc *geo.FeatureCollection) (int64, error) {
+	shift := m.gs.QuadKeySystem.BitDelta(cr.Zoom)
+	m.mu.RLock()
+	layer, err := m.layer(cr.Layer)
+	if err != nil {
+		m.mu.RUnlock()
+		return 0, err
+	}
+	members := make([]*GeoObject, 0)
+	for _, object := range layer.tileRange(cr.TileID, shift) {
+		if match(object, cr.Within, cr.Filter) {
+			members = append(members, object)
+		}
+	}
+	m.mu.RUnlock()
+
+	total := int64(len(members))
+	if cr.Offset >= total {
+		return total, nil
+	}
+	members = firstByID(members, cr.Offset+cr.Limit)[cr.Offset:]
+	for _, object := range members {
+		props := layer.Mapper(&Cluster{
+			ID:        object.ID,
+			MinID:     object.ID,
+			Count:     1,
+			GeoObject: *object,
+		})
+		err = fc.Add(geo.LayerFeatureID(layer.Name, object.ID), object.Point(), props)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+func (m *MemoryDataSource) StoreGeoData(ctx context.Context, d interface{}) error {
+	return m.StoreLayerData(ctx, geo.DefaultLayer, d)
+}
+
+func (m *MemoryDataSource) StoreLayerData(ctx context.Context, name string, d interface{}) error {
+	gObj, ok := d.(*GeoObject)
+	if !ok {
+		return fmt.Errorf("unexpected data type %T", d)
+	}
+	qk := m.gs.CoordinatesToQuadKey(gObj.Lat, gObj.Lon)
+	gObj.QuadKey = qk.Int64()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	layer, err := m.layer(name)
+	if err != nil {
+		return err
+	}
+	layer.store(gObj)
+	return nil
+}
@@ -0,0 +1,442 @@
+package memds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"math"
+	"testing"
+)
+
+func TestMemoryDataSourceSuite(t *testing.T) {
+	suite.Run(t, new(MemoryDataSourceSuite))
+}
+
+type MemoryDataSourceSuite struct {
+	suite.Suite
+	gs      *geo.GeographicSystem
+	ds      *MemoryDataSource
+	objects []*GeoObject
+}
+
+func (s *MemoryDataSourceSuite) SetupTest() {
+	s.gs = geo.NewGeographicSystem(geo.DefaultGeoSystemConfig)
+	s.ds = NewMemoryDataSource(s.gs, func(obj *Cluster) map[string]interface{} {
+		return map[string]interface{}{
+			"count": obj.Count,
+			"name":  obj.Properties["name"],
+		}
+	})
+	data, err := ioutil.ReadFile("../../metro.json")
+	s.Require().Nil(err)
+	s.objects = make([]*GeoObject, 0)
+	s.Require().Nil(json.Unmarshal(data, &s.objects))
+	for _, object := range s.objects {
+		s.Require().Nil(s.ds.StoreGeoData(context.Background(), object))
+	}
+}
+
+func (s *MemoryDataSourceSuite) TestLoadNearby() {
+	nr, err := geo.ParseNearbyRequest("55.69329", "37.534511", "3000", "5", "")
+	if !s.Nil(err) {
+		return
+	}
+	fc := geo.NewFeatureCollection()
+	err = s.ds.LoadNearby(context.Background(), nr, fc)
+	if !s.Nil(err) {
+		return
+	}
+	if !s.Len(fc.Features, 5) {
+		return
+	}
+	s.Equal("Университет", fc.Features[0].Properties["name"])
+	s.Equal(0.0, fc.Features[0].Properties["distance"])
+
+	var expected int
+	for _, object := range s.objects {
+		if geo.HaversineDistance(nr.Lat, nr.Lon, object.Lat, object.Lon) <= nr.Radius {
+			expected++
+		}
+	}
+	nr.Limit = geo.MaxNearbyLimit
+	fc = geo.NewFeatureCollection()
+	err = s.ds.LoadNearby(context.Background(), nr, fc)
+	if !s.Nil(err) {
+		return
+	}
+	s.Len(fc.Features, expected)
+	var prev float64
+	for _, feature := range fc.Features {
+		distance := feature.Properties["distance"].(float64)
+		s.LessOrEqual(prev, distance)
+		s.LessOrEqual(distance, nr.Radius)
+		prev = distance
+	}
+}
+
+func (s *MemoryDataSourceSuite) TestLoadNearbyAntimeridian() {
+	for _, lon := range []float64{179.9995, -179.9995} {
+		s.Require().Nil(s.ds.StoreGeoData(context.Background(), &GeoObject{Lat: 0, Lon: lon}))
+	}
+	for _, lon := range []float64{179.9999, -179.9999} {
+		nr := &geo.NearbyRequest{Lat: 0, Lon: lon, Radius: 1000, Limit: 5}
+		fc := geo.NewFeatureCollection()
+		err := s.ds.LoadNearby(context.Background(), nr, fc)
+		if s.Nil(err) {
+			s.Len(fc.Features, 2, lon)
+		}
+	}
+}
+
+func (s *MemoryDataSourceSuite) TestLoadMapView() {
+	mr, err := geo.ParseMapRequest("", "0,0,3,3", "2", "", "", "2", "", "", "")
+	if !s.Nil(err) {
+		return
+	}
+	fc := geo.NewFeatureCollection()
+	err = s.ds.LoadMapView(context.Background(), mr, fc)
+	if !s.Nil(err) {
+		return
+	}
+	var total int64
+	for _, feature := range fc.Features {
+		total += feature.Properties["count"].(int64)
+	}
+	s.Equal(int64(len(s.objects)), total)
+}
+
+func (s *MemoryDataSourceSuite) TestStoreGeoDataMove() {
+	object := s.objects[0]
+	moved := &GeoObject{
+		ID:         object.ID,
+		Lat:        -object.Lat,
+		Lon:        -object.Lon,
+		Properties: object.Properties,
+	}
+	err := s.ds.StoreGeoData(context.Background(), moved)
+	if !s.Nil(err) {
+		return
+	}
+	s.Len(s.ds.layers[geo.DefaultLayer].objects, len(s.objects))
+	nr := &geo.NearbyRequest{Lat: moved.Lat, Lon: moved.Lon, Radius: 10, Limit: 1}
+	fc := geo.NewFeatureCollection()
+	err = s.ds.LoadNearby(context.Background(), nr, fc)
+	if !s.Nil(err) {
+		return
+	}
+	if s.Len(fc.Features, 1) {
+		s.Equal(object.Properties["name"], fc.Features[0].Properties["name"])
+	}
+}
+
+func (s *MemoryDataSourceSuite) TestLoadMapViewWithin() {
+	// Boulevard Ring
+	area := "POLYGON((55.7665 37.6010,55.7690 37.6150,55.7630 37.6390,55.7500 37.6430,55.7400 37.6270,55.7435 37.6040,55.7540 37.5960,55.7665 37.6010))"
+	mr, err := geo.ParseMapRequest("", "0,0,3,3", "2", "", "", "4", area, "", "")
+	if !s.Nil(err) {
+		return
+	}
+	var expected int64
+	for _, object := range s.objects {
+		if geo.Intersects(mr.Within, object.Point()) {
+			expected++
+		}
+	}
+	fc := geo.NewFeatureCollection()
+	err = s.ds.LoadMapView(context.Background(), mr, fc)
+	if !s.Nil(err) {
+		return
+	}
+	var total int64
+	for _, feature := range fc.Features {
+		total += feature.Properties["count"].(int64)
+	}
+	s.Less(int64(0), expected)
+	s.Equal(expected, total)
+}
+
+func (s *MemoryDataSourceSuite) TestLayers() {
+	s.ds.RegisterLayer("bus", func(obj *Cluster) map[string]interface{} {
+		return map[string]interface{}{"count": obj.Count, "bus": true}
+	})
+	err := s.ds.StoreLayerData(context.Background(), "bus", &GeoObject{Lat: 55.75, Lon: 37.61})
+	if !s.Nil(err) {
+		return
+	}
+	err = s.ds.StoreLayerData(context.Background(), "tram", &GeoObject{Lat: 55.75, Lon: 37.61})
+	s.ErrorIs(err, geo.ErrUnknownLayer)
+
+	mr, err := geo.ParseMapRequest("", "0,0,3,3", "2", "", "", "", "", "", "default,bus")
+	if !s.Nil(err) {
+		return
+	}
+	fc := geo.NewFeatureCollection()
+	err = s.ds.LoadMapView(context.Background(), mr, fc)
+	if !s.Nil(err) {
+		return
+	}
+	if !s.Len(fc.Features, 2) {
+		return
+	}
+	s.Equal(int64(len(s.objects)), fc.Features[0].Properties["count"])
+	s.Equal("bus:"+fc.Features[0].ID, fc.Features[1].ID)
+	s.Equal(true, fc.Features[1].Properties["bus"])
+
+	mr.Layers = []string{"tram"}
+	err = s.ds.LoadMapView(context.Background(), mr, geo.NewFeatureCollection())
+	s.ErrorIs(err, geo.ErrUnknownLayer)
+}
+
+func (s *MemoryDataSourceSuite) TestClusterMembers() {
+	mr, err := geo.ParseMapRequest("", "0,0,3,3", "2", "", "", "", "", "", "")
+	if !s.Nil(err) {
+		return
+	}
+	fc := geo.NewFeatureCollection()
+	err = s.ds.LoadMapView(context.Background(), mr, fc)
+	if !s.Nil(err) || !s.Len(fc.Features, 1) {
+		return
+	}
+	var members []interface{}
+	s.ds.RegisterLayer(geo.DefaultLayer, func(obj *Cluster) map[string]interface{} {
+		for _, member := range obj.ClusterData {
+			members = append(members, member.ID)
+		}
+		return map[string]interface{}{"name": obj.Properties["name"]}
+	})
+	err = s.ds.LoadMapView(context.Background(), mr, geo.NewFeatureCollection())
+	if !s.Nil(err) || !s.Len(members, DefaultClusterMembers) {
+		return
+	}
+
+	cr, err := geo.ParseClusterMembersRequest(fc.Features[0].ID, "2", "0", "5", "", "", "", "")
+	if !s.Nil(err) {
+		return
+	}
+	fc = geo.NewFeatureCollection()
+	total, err := s.ds.LoadClusterMembers(context.Background(), cr, fc)
+	if !s.Nil(err) {
+		return
+	}
+	s.Equal(int64(len(s.objects)), total)
+	if !s.Len(fc.Features, 5) {
+		return
+	}
+	for i, feature := range fc.Features {
+		s.Equal(fmt.Sprint(members[i]), feature.ID)
+	}
+
+	cr.Offset = total - 2
+	fc = geo.NewFeatureCollection()
+	_, err = s.ds.LoadClusterMembers(context.Background(), cr, fc)
+	if !s.Nil(err) {
+		return
+	}
+	s.Len(fc.Features, 2)
+
+	cr.Filter, _ = geo.ParsePropertyFilter("name:Университет")
+	cr.Offset = 0
+	fc = geo.NewFeatureCollection()
+	total, err = s.ds.LoadClusterMembers(context.Background(), cr, fc)
+	if !s.Nil(err) {
+		return
+	}
+	s.Equal(int64(1), total)
+	s.Equal("Университет", fc.Features[0].Properties["name"])
+}
+
+func (s *MemoryDataSourceSuite) TestClusterBounds() {
+	mr, err := geo.ParseMapRequest("", "0,0,3,3", "2", "", "", "1", "", "", "")
+	if !s.Nil(err) {
+		return
+	}
+	fc := geo.NewFeatureCollection()
+	err = s.ds.LoadMapView(context.Background(), mr, fc)
+	if !s.Nil(err) || !s.Len(fc.Features, 1) {
+		return
+	}
+	bounds := fc.Features[0].Properties["bounds"].([][]float64)
+	bbox := geo.BBox{XMin: bounds[0][0], YMin: bounds[0][1], XMax: bounds[1][0], YMax: bounds[1][1]}
+	for _, object := range s.objects {
+		s.True(bbox.ContainsPoint(object.Point()))
+	}
+
+	// cluster keeps single marker until expandZoom
+	expandZoom := fc.Features[0].Properties["expandZoom"].(int64)
+	s.Less(mr.Zoom, expandZoom)
+	for zoom := mr.Zoom; zoom <= expandZoom; zoom++ {
+		maxTile := int64(1)<<zoom - 1
+		zmr := &geo.MapRequest{
+			TileBBox:     geo.TileBBox{TileXMax: maxTile, TileYMax: maxTile},
+			Zoom:         zoom,
+			ClusterDepth: mr.ClusterDepth,
+		}
+		fc = geo.NewFeatureCollection()
+		err = s.ds.LoadMapView(context.Background(), zmr, fc)
+		if !s.Nil(err) {
+			return
+		}
+		if zoom < expandZoom {
+			s.Len(fc.Features, 1, zoom)
+		} else {
+			s.Less(1, len(fc.Features))
+		}
+	}
+}
+
+func (s *MemoryDataSourceSuite) TestClusterAggregates() {
+	layer := s.ds.layers[geo.DefaultLayer]
+	layer.Aggregations = []*geo.Aggregation{
+		{Name: "traffic", Property: "traffic", Func: geo.AggregateSum},
+		{Name: "avgTraffic", Property: "traffic", Func: geo.AggregateAvg},
+		{Name: "maxTraffic", Property: "traffic", Func: geo.AggregateMax},
+		{Name: "lines", Property: "line", Func: geo.AggregateTop, K: 2},
+	}
+	var traffic, maxTraffic float64
+	for i, object := range s.objects {
+		object.Properties["traffic"] = float64(object.ID)
+		object.Properties["line"] = []string{"red", "green", "red", "blue", "red", "green"}[i%6]
+		traffic += float64(object.ID)
+		maxTraffic = math.Max(maxTraffic, float64(object.ID))
+	}
+	// value which is not a number is skipped
+	s.objects[0].Properties["traffic"] = "unknown"
+	traffic -= float64(s.objects[0].ID)
+
+	mr, err := geo.ParseMapRequest("", "0,0,3,3", "2", "", "", "1", "", "", "")
+	if !s.Nil(err) {
+		return
+	}
+	fc := geo.NewFeatureCollection()
+	err = s.ds.LoadMapView(context.Background(), mr, fc)
+	if !s.Nil(err) || !s.Len(fc.Features, 1) {
+		return
+	}
+	aggregates := fc.Features[0].Properties["aggregates"].(map[string]interface{})
+	s.Equal(traffic, aggregates["traffic"])
+	s.InDelta(traffic/float64(len(s.objects)-1), aggregates["avgTraffic"], 1e-9)
+	s.Equal(maxTraffic, aggregates["maxTraffic"])
+	s.Equal([]geo.TopValue{{Value: "red", Count: 120}, {Value: "green", Count: 80}}, aggregates["lines"])
+}
+
+func (s *MemoryDataSourceSuite) TestClusterPlacement() {
+	layer := s.ds.layers[geo.DefaultLayer]
+	mr, err := geo.ParseMapRequest("", "0,0,3,3", "2", "", "", "1", "", "", "")
+	if !s.Nil(err) {
+		return
+	}
+	load := func(placement *geo.ClusterPlacement) (*geo.GeographicPoint, map[string]interface{}) {
+		layer.Placement = placement
+		fc := geo.NewFeatureCollection()
+		s.Require().Nil(s.ds.LoadMapView(context.Background(), mr, fc))
+		s.Require().Len(fc.Features, 1)
+		point := new(geo.GeographicPoint)
+		s.Require().Nil(point.FromGeom(fc.Features[0].Geometry))
+		return point, fc.Features[0].Properties
+	}
+	heavy := s.objects[len(s.objects)/2]
+	for _, object := range s.objects {
+		object.Properties["weight"] = 0.0
+		object.Properties["priority"] = float64(object.ID % 7)
+	}
+	heavy.Properties["weight"] = 1.0
+	heavy.Properties["priority"] = 100.0
+
+	point, props := load(&geo.ClusterPlacement{Position: geo.PositionWeighted, Weight: "weight", Priority: "priority"})
+	s.InDelta(heavy.Lat, point.Latitude, 1e-9)
+	s.InDelta(heavy.Lon, point.Longitude, 1e-9)
+	s.Equal(heavy.Properties["name"], props["name"])
+
+	medoid, _ := load(&geo.ClusterPlacement{Position: geo.PositionMedoid})
+	var isMember bool
+	for _, object := range s.objects {
+		isMember = isMember || object.Lat == medoid.Latitude && object.Lon == medoid.Longitude
+	}
+	s.True(isMember)
+
+	// cluster tile contains its center
+	center, _ := load(&geo.ClusterPlacement{Position: geo.PositionTileCenter})
+	shift := s.gs.QuadKeySystem.BitDelta(mr.Zoom + mr.ClusterDepth)
+	s.Equal(s.objects[0].QuadKey>>shift, s.gs.CoordinatesToQuadKey(center.Latitude, center.Longitude).Int64()>>shift)
+}
+
+func (s *MemoryDataSourceSuite) TestAdaptiveClusterDepth() {
+	mr, err := geo.ParseMapRequest("", "0,0,7,7", "3", "", "", "auto:8", "", "", "")
+	if !s.Nil(err) {
+		return
+	}
+	fc := geo.NewFeatureCollection()
+	err = s.ds.LoadMapView(context.Background(), mr, fc)
+	if !s.Nil(err) {
+		return
+	}
+	// all stations are in single tile which is split into no more than 8 clusters
+	s.Len(mr.ClusterDepths, 64)
+	s.LessOrEqual(len(fc.Features), 8)
+	s.Less(1, len(fc.Features))
+	var count int64
+	for _, feature := range fc.Features {
+		if c, ok := feature.Properties["count"].(int64); ok && c > 1 {
+			count += c
+		} else {
+			count++
+		}
+	}
+	s.Equal(int64(len(s.objects)), count)
+
+	// sparse tiles are not clustered
+	mr, err = geo.ParseMapRequest("", "0,0,7,7", "3", "", "", "auto:256", "", "", "")
+	if !s.Nil(err) {
+		return
+	}
+	fc = geo.NewFeatureCollection()
+	err = s.ds.LoadMapView(context.Background(), mr, fc)
+	if !s.Nil(err) {
+		return
+	}
+	s.Len(fc.Features, len(s.objects))
+}
+
+func (s *MemoryDataSourceSuite) TestDebugInfo() {
+	mr, err := geo.ParseMapRequest("", "4,2,5,3", "3", "", "true", "2", "", "", "")
+	if !s.Nil(err) {
+		return
+	}
+	mr.DebugInfo = geo.NewDebugInfo()
+	fc := geo.NewFeatureCollection()
+	err = s.ds.LoadMapView(context.Background(), mr, fc)
+	if !s.Nil(err) {
+		return
+	}
+	s.Len(mr.DebugInfo.Clusters, len(fc.Features))
+	s.Len(mr.DebugInfo.Loads, 4)
+	var total int64
+	for _, count := range mr.DebugInfo.TileCounts(mr.Zoom) {
+		total += count
+	}
+	s.Equal(int64(len(s.objects)), total)
+
+	debug := geo.NewFeatureCollection()
+	s.Nil(s.gs.DrawROMTiles(mr, debug))
+	s.Nil(s.gs.DrawROMClusterGrid(mr, debug))
+	s.Nil(s.gs.DrawROMQueries(mr, debug))
+	s.Len(debug.Features, 4+len(fc.Features)+1)
+}
+
+// TestMaxZoom checks that clusters deeper than max zoom are clusters of max zoom
+func (s *MemoryDataSourceSuite) TestMaxZoom() {
+	object := s.objects[0]
+	gpx, gpy := s.gs.Projection.ToGlobalPixels(object.Lat, object.Lon, 22)
+	tx, ty := s.gs.TileSystem.GlobalPixelsToTileXY(gpx, gpy)
+	mr, err := geo.ParseMapRequest("", fmt.Sprintf("%d,%d,%d,%d", tx, ty, tx, ty), "22", "", "", "4", "", "", "")
+	s.Require().Nil(err)
+	s.Require().Nil(s.gs.ValidateMapRequest(mr, 0))
+	fc := geo.NewFeatureCollection()
+	s.Require().Nil(s.ds.LoadMapView(context.Background(), mr, fc))
+	if s.Len(fc.Features, 1) {
+		s.Equal(int64(1), fc.Features[0].Properties["count"])
+	}
+}
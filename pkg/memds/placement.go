@@ -0,0 +1,83 @@
+package memds
+
+import (
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"math"
+)
+
+// representative returns member with highest priority, member with lowest id wins ties
+func representative(members []*GeoObject, priority string) *GeoObject {
+	var best *GeoObject
+	var bestPriority float64
+	var bestHasPriority bool
+	for _, member := range members {
+		var value float64
+		var ok bool
+		if priority != "" {
+			value, ok = geo.NumericValue(member.Properties[priority])
+		}
+		switch {
+		case best == nil:
+		case ok != bestHasPriority:
+			if !ok {
+				continue
+			}
+		case ok && value != bestPriority:
+			if value < bestPriority {
+				continue
+			}
+		case member.ID > best.ID:
+			continue
+		}
+		best, bestPriority, bestHasPriority = member, value, ok
+	}
+	return best
+}
+
+// position returns point of cluster marker according to placement of layer
+func (m *MemoryDataSource) position(layer *Layer, members []*GeoObject, clusterID int64, clusterZoom int64) (*geo.GeographicPoint, error) {
+	var latSum, lonSum float64
+	for _, member := range members {
+		latSum += member.Lat
+		lonSum += member.Lon
+	}
+	centroid := &geo.GeographicPoint{
+		Latitude:  latSum / float64(len(members)),
+		Longitude: lonSum / float64(len(members)),
+	}
+	switch layer.Placement.PositionMethod() {
+	case geo.PositionWeighted:
+		var weightSum float64
+		latSum, lonSum = 0, 0
+		for _, member := range members {
+			weight, ok := geo.NumericValue(member.Properties[layer.Placement.WeightProperty()])
+			if !ok {
+				continue
+			}
+			weightSum += weight
+			latSum += member.Lat * weight
+			lonSum += member.Lon * weight
+		}
+		// cluster without weights is placed at centroid
+		if weightSum == 0 {
+			return centroid, nil
+		}
+		return &geo.GeographicPoint{
+			Latitude:  latSum / weightSum,
+			Longitude: lonSum / weightSum,
+		}, nil
+	case geo.PositionMedoid:
+		var medoid *GeoObject
+		minDistance := math.Inf(1)
+		for _, member := range members {
+			distance := math.Hypot(member.Lat-centroid.Latitude, member.Lon-centroid.Longitude)
+			if distance < minDistance || distance == minDistance && member.ID < medoid.ID {
+				medoid, minDistance = member, distance
+			}
+		}
+		return medoid.Point(), nil
+	case geo.PositionTileCenter:
+		return m.gs.TileIDToCenterPoint(clusterID, clusterZoom)
+	}
+	return centroid, nil
+}
@@ -0,0 +1,332 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are upper bounds of latency histograms in seconds
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultCountBuckets are upper bounds of histograms of sizes like number of returned features
+var DefaultCountBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+// collector is metric family written in Prometheus text format
+type collector interface {
+	name() string
+	write(w io.Writer) error
+}
+
+// Registry keeps metrics and writes them in Prometheus text format
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.collectors[c.name()]; ok {
+		panic(fmt.Sprintf("metric %s is already registered", c.name()))
+	}
+	r.collectors[c.name()] = c
+}
+
+// WriteText writes all metrics sorted by name
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	collectors := make([]collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+	r.mu.Unlock()
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+	for _, c := range collectors {
+		err := c.write(w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves metrics for Prometheus scraper
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		err := r.WriteText(w)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+		}
+	})
+}
+
+// family is metric with label names and series by label values
+type family struct {
+	metricName string
+	help       string
+	typ        string
+	labels     []string
+	mu         sync.Mutex
+	series     map[string]interface{}
+	keys       map[string][]string
+}
+
+func newFamily(name, help, typ string, labels []string) family {
+	return family{
+		metricName: name,
+		help:       help,
+		typ:        typ,
+		labels:     labels,
+		series:     make(map[string]interface{}),
+		keys:       make(map[string][]string),
+	}
+}
+
+func (f *family) name() string {
+	return f.metricName
+}
+
+// get returns series of label values created by create if it does not exist yet
+func (f *family) get(values []string, create func() interface{}) interface{} {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.metricName, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = create()
+		f.series[key] = s
+		f.keys[key] = append([]string(nil), values...)
+	}
+	return s
+}
+
+// each calls cb with series sorted by label values
+func (f *family) each(cb func(values []string, s interface{}) error) error {
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	f.mu.Unlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		f.mu.Lock()
+		values, s := f.keys[key], f.series[key]
+		f.mu.Unlock()
+		err := cb(values, s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *family) writeHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.metricName, escapeHelp(f.help), f.metricName, f.typ)
+	return err
+}
+
+// Counter is monotonically increasing value
+type Counter struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("counter cannot decrease")
+	}
+	c.mu.Lock()
+	c.value += v
+	c.mu.Unlock()
+}
+
+func (c *Counter) Value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+type CounterVec struct {
+	family
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{family: newFamily(name, help, "counter", labels)}
+	r.register(c)
+	return c
+}
+
+// With returns counter of label values in order of label names
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.get(values, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+func (c *CounterVec) write(w io.Writer) error {
+	err := c.writeHeader(w)
+	if err != nil {
+		return err
+	}
+	return c.each(func(values []string, s interface{}) error {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", c.metricName, formatLabels(c.labels, values), formatValue(s.(*Counter).Value()))
+		return err
+	})
+}
+
+// Histogram counts observations in buckets
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+type HistogramVec struct {
+	family
+	buckets []float64
+}
+
+// NewHistogramVec registers histogram with sorted bucket upper bounds, +Inf bucket is implicit
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{family: newFamily(name, help, "histogram", labels), buckets: buckets}
+	r.register(h)
+	return h
+}
+
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.get(values, func() interface{} {
+		return &Histogram{buckets: h.buckets, counts: make([]uint64, len(h.buckets))}
+	}).(*Histogram)
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+	err := h.writeHeader(w)
+	if err != nil {
+		return err
+	}
+	labels := append(append([]string(nil), h.labels...), "le")
+	return h.each(func(values []string, s interface{}) error {
+		hist := s.(*Histogram)
+		hist.mu.Lock()
+		counts := append([]uint64(nil), hist.counts...)
+		count, sum := hist.count, hist.sum
+		hist.mu.Unlock()
+		bucketValues := append(append([]string(nil), values...), "")
+		for i, upper := range h.buckets {
+			bucketValues[len(values)] = formatValue(upper)
+			_, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(labels, bucketValues), counts[i])
+			if err != nil {
+				return err
+			}
+		}
+		bucketValues[len(values)] = "+Inf"
+		_, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(labels, bucketValues), count)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n",
+			h.metricName, formatLabels(h.labels, values), formatValue(sum),
+			h.metricName, formatLabels(h.labels, values), count)
+		return err
+	})
+}
+
+// gaugeFunc is gauge computed on every scrape
+type gaugeFunc struct {
+	family
+	fn func() float64
+}
+
+// NewGaugeFunc registers gauge whose value is returned by fn when metrics are written
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&gaugeFunc{family: newFamily(name, help, "gauge", nil), fn: fn})
+}
+
+// NewCounterFunc registers counter whose value is returned by fn when metrics are written
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(&gaugeFunc{family: newFamily(name, help, "counter", nil), fn: fn})
+}
+
+func (g *gaugeFunc) write(w io.Writer) error {
+	err := g.writeHeader(w)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s %s\n", g.metricName, formatValue(g.fn()))
+	return err
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/suite"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetricsSuite(t *testing.T) {
+	suite.Run(t, new(MetricsSuite))
+}
+
+type MetricsSuite struct {
+	suite.Suite
+	reg *Registry
+}
+
+func (s *MetricsSuite) SetupTest() {
+	s.reg = NewRegistry()
+}
+
+func (s *MetricsSuite) text() string {
+	buf := &bytes.Buffer{}
+	s.Require().Nil(s.reg.WriteText(buf))
+	return buf.String()
+}
+
+func (s *MetricsSuite) TestCounter() {
+	c := s.reg.NewCounterVec("geo_requests_total", "Requests.", "handler", "code")
+	c.With("yandex", "200").Inc()
+	c.With("yandex", "200").Add(2)
+	c.With("nearby", "500").Inc()
+	s.Equal(`# HELP geo_requests_total Requests.
+# TYPE geo_requests_total counter
+geo_requests_total{handler="nearby",code="500"} 1
+geo_requests_total{handler="yandex",code="200"} 3
+`, s.text())
+}
+
+func (s *MetricsSuite) TestHistogram() {
+	h := s.reg.NewHistogramVec("geo_latency_seconds", "Latency.", []float64{0.1, 1}, "zoom")
+	h.With("10").Observe(0.05)
+	h.With("10").Observe(0.5)
+	h.With("10").Observe(5)
+	s.Equal(`# HELP geo_latency_seconds Latency.
+# TYPE geo_latency_seconds histogram
+geo_latency_seconds_bucket{zoom="10",le="0.1"} 1
+geo_latency_seconds_bucket{zoom="10",le="1"} 2
+geo_latency_seconds_bucket{zoom="10",le="+Inf"} 3
+geo_latency_seconds_sum{zoom="10"} 5.55
+geo_latency_seconds_count{zoom="10"} 3
+`, s.text())
+}
+
+func (s *MetricsSuite) TestGaugeFuncAndOrder() {
+	s.reg.NewGaugeFunc("geo_b", "B \"gauge\".", func() float64 { return 7 })
+	s.reg.NewCounterVec("geo_a", "A.", "path").With("a\"b\\c").Inc()
+	s.Equal(`# HELP geo_a A.
+# TYPE geo_a counter
+geo_a{path="a\"b\\c"} 1
+# HELP geo_b B "gauge".
+# TYPE geo_b gauge
+geo_b 7
+`, s.text())
+}
+
+func (s *MetricsSuite) TestDuplicate() {
+	s.reg.NewGaugeFunc("geo_a", "A.", func() float64 { return 0 })
+	s.Panics(func() {
+		s.reg.NewCounterVec("geo_a", "A.")
+	})
+}
+
+func (s *MetricsSuite) TestHandler() {
+	s.reg.NewGaugeFunc("geo_a", "A.", func() float64 { return 1 })
+	rec := httptest.NewRecorder()
+	s.reg.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	s.Equal(200, rec.Code)
+	s.Contains(rec.Header().Get("Content-Type"), "version=0.0.4")
+	s.Contains(rec.Body.String(), "geo_a 1\n")
+}
@@ -0,0 +1,75 @@
+package pgds
+
+import (
+	"context"
+	"database/sql"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+)
+
+type tileDensity struct {
+	TileID   int64   `bun:"tile_id"`
+	Total    int64   `bun:"total"`
+	SubTiles []int64 `bun:"sub_tiles,array"`
+}
+
+type pyramidDensity struct {
+	TileID int64 `bun:"tile_id"`
+	Depth  int64 `bun:"depth"`
+	Tiles  int64 `bun:"tiles"`
+	Total  int64 `bun:"total"`
+}
+
+// adaptiveDepths chooses cluster depth of every request tile by number of its objects
+// and numbers of non-empty sub-tiles at every depth
+func (p *PostGISDataSource) adaptiveDepths(ctx context.Context, layer *Layer, mr *geo.MapRequest, tileIDs []int64) (map[int64]int64, error) {
+	maxDepth, fullDepth := p.gs.QuadKeySystem.AdaptiveDepthRange(mr.Zoom)
+	if len(tileIDs) == 0 {
+		return map[int64]int64{}, nil
+	}
+	densities := make([]*tileDensity, 0, len(tileIDs))
+	var err error
+	if usePyramid(layer, mr) {
+		densities, err = p.pyramidDensities(ctx, layer, mr.Zoom, maxDepth, tileIDs)
+	} else {
+		err = p.engine.densityQuery(p.DB, layer, mr, maxDepth, tileIDs).Scan(ctx, &densities)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	depths := make(map[int64]int64, len(tileIDs))
+	for _, tileID := range tileIDs {
+		// empty tiles have nothing to cluster
+		depths[tileID] = mr.ClusterDepth
+	}
+	for _, d := range densities {
+		depths[d.TileID] = geo.ChooseClusterDepth(d.Total, d.SubTiles, mr.MaxMarkers, fullDepth)
+	}
+	return depths, nil
+}
+
+// pyramidDensities counts non-empty tiles of pyramid under request tiles at every depth
+func (p *PostGISDataSource) pyramidDensities(ctx context.Context, layer *Layer, zoom int64, maxDepth int64, tileIDs []int64) ([]*tileDensity, error) {
+	rows := make([]*pyramidDensity, 0, len(tileIDs)*int(maxDepth+1))
+	err := p.engine.pyramidDensityQuery(p.DB, layer, zoom, maxDepth, tileIDs).Scan(ctx, &rows)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	byTile := make(map[int64]*tileDensity, len(tileIDs))
+	for _, row := range rows {
+		d, ok := byTile[row.TileID]
+		if !ok {
+			d = &tileDensity{TileID: row.TileID, SubTiles: make([]int64, maxDepth)}
+			byTile[row.TileID] = d
+		}
+		if row.Depth == 0 {
+			d.Total = row.Total
+		} else {
+			d.SubTiles[row.Depth-1] = row.Tiles
+		}
+	}
+	densities := make([]*tileDensity, 0, len(byTile))
+	for _, d := range byTile {
+		densities = append(densities, d)
+	}
+	return densities, nil
+}
@@ -0,0 +1,107 @@
+package pgds
+
+import (
+	"fmt"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/uptrace/bun"
+	"strings"
+)
+
+// numericExpr is value of property as number, CASE guards the cast from non numeric values
+const numericExpr = "CASE WHEN jsonb_typeof(properties->?) = 'number' THEN (properties->>?)::numeric END"
+
+// aggregateFuncSQL maps numeric aggregation to SQL function, layer aggregations
+// can be set without style validation, so func is never put into query as is
+func aggregateFuncSQL(agg *geo.Aggregation) (string, error) {
+	switch agg.Func {
+	case geo.AggregateSum:
+		return "SUM", nil
+	case geo.AggregateAvg:
+		return "AVG", nil
+	case geo.AggregateMin:
+		return "MIN", nil
+	case geo.AggregateMax:
+		return "MAX", nil
+	}
+	return "", fmt.Errorf("aggregation %s: unknown func %q", agg.Name, agg.Func)
+}
+
+// columnAggregates adds numeric aggregations of cluster as single JSONB column
+func columnAggregates(q *bun.SelectQuery, aggregations []*geo.Aggregation) error {
+	parts := make([]string, 0, len(aggregations))
+	args := make([]interface{}, 0, len(aggregations)*3)
+	for _, agg := range aggregations {
+		if agg.Func == geo.AggregateTop {
+			continue
+		}
+		fn, err := aggregateFuncSQL(agg)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, "?, "+fn+"("+numericExpr+")")
+		args = append(args, agg.Name, agg.Property, agg.Property)
+	}
+	if len(parts) > 0 {
+		q.ColumnExpr("jsonb_build_object("+strings.Join(parts, ", ")+") AS aggregates", args...)
+	}
+	return nil
+}
+
+// topValuesQuery counts values of top aggregations in every cluster of objects CTE
+// and returns JSONB object of the most frequent ones by cluster, nil if layer has no top aggregations.
+func topValuesQuery(db bun.IDB, aggregations []*geo.Aggregation) *bun.SelectQuery {
+	var tops *bun.SelectQuery
+	for _, agg := range aggregations {
+		if agg.Func != geo.AggregateTop {
+			continue
+		}
+		counts := db.NewSelect().TableExpr("objects")
+		counts.ColumnExpr("tile_id")
+		counts.ColumnExpr("properties->? AS value", agg.Property)
+		counts.ColumnExpr("COUNT(*) AS count")
+		// objects and arrays are not counted, NULL type of missing property is filtered out too
+		counts.Where("jsonb_typeof(properties->?) NOT IN ('null', 'object', 'array')", agg.Property)
+		counts.GroupExpr("tile_id, value")
+		ranked := db.NewSelect().TableExpr("(?) AS counts", counts)
+		ranked.ColumnExpr("*")
+		ranked.ColumnExpr("row_number() OVER (PARTITION BY tile_id ORDER BY count DESC, value #>> '{}') AS rank")
+		top := db.NewSelect().TableExpr("(?) AS ranked", ranked)
+		top.ColumnExpr("tile_id")
+		top.ColumnExpr("? AS name", agg.Name)
+		top.ColumnExpr("jsonb_agg(jsonb_build_object('value', value, 'count', count) ORDER BY rank) AS top")
+		top.Where("rank <= ?", agg.TopK())
+		top.Group("tile_id")
+		if tops == nil {
+			tops = top
+		} else {
+			tops.UnionAll(top)
+		}
+	}
+	if tops == nil {
+		return nil
+	}
+	// leading underscore makes bun skip the join column on scan
+	q := db.NewSelect().TableExpr("(?) AS tops", tops)
+	q.ColumnExpr("tile_id AS _top_tile_id")
+	q.ColumnExpr("jsonb_object_agg(name, top) AS top_values")
+	q.Group("tile_id")
+	return q
+}
+
+// clusterAggregates merges numeric and top aggregations of cluster,
+// top aggregation without values is empty list.
+func clusterAggregates(aggregations []*geo.Aggregation, c *Cluster) map[string]interface{} {
+	result := make(map[string]interface{}, len(aggregations))
+	for _, agg := range aggregations {
+		if agg.Func == geo.AggregateTop {
+			top, ok := c.TopValues[agg.Name]
+			if !ok {
+				top = []geo.TopValue{}
+			}
+			result[agg.Name] = top
+			continue
+		}
+		result[agg.Name] = c.Aggregates[agg.Name]
+	}
+	return result
+}
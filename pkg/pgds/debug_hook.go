@@ -0,0 +1,19 @@
+package pgds
+
+import (
+	"context"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/uptrace/bun"
+	"time"
+)
+
+// debugQueryHook records queries of requests in debug mode
+type debugQueryHook struct{}
+
+func (debugQueryHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (debugQueryHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	geo.DebugInfoFromContext(ctx).AddQuery(event.Query, time.Since(event.StartTime))
+}
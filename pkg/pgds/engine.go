@@ -0,0 +1,354 @@
+package pgds
+
+import (
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+	"strings"
+)
+
+// engine builds queries of layer tables for geographic system and turns loaded clusters into features.
+// Queries are built for db passed by caller, so they can be run in transaction.
+type engine struct {
+	gs *geo.GeographicSystem
+}
+
+func newEngine(gs *geo.GeographicSystem) *engine {
+	return &engine{gs: gs}
+}
+
+// clustersQuery groups objects of request tiles into clusters on the fly
+func (e *engine) clustersQuery(db bun.IDB, layer *Layer, mr *geo.MapRequest, tileIDs []int64) (*bun.SelectQuery, error) {
+	bitDelta := e.gs.QuadKeySystem.BitDelta(mr.Zoom)
+	clusterShift := e.gs.QuadKeySystem.BitDelta(e.gs.ClusterZoom(mr))
+	// filtered objects are shared by clusters and top values queries
+	base := db.NewSelect().Model((*GeoObject)(nil)).ModelTableExpr("? AS geo_object", bun.Ident(layer.Table))
+	base.ColumnExpr("*")
+	base.ColumnExpr("quad_key >> ? as tile_id", clusterShift)
+	base.Where("quad_key >> ? in (?)", bitDelta, bun.In(tileIDs))
+	whereWithin(base, mr.Within)
+	wherePropertyFilter(base, mr.Filter)
+	columnCentroidDistance(base, layer.Placement, clusterShift)
+	subq := db.NewSelect().TableExpr("objects")
+	subq.ColumnExpr("COUNT(id) AS count")
+	subq.ColumnExpr("MIN(id) AS min_id")
+	columnPlacement(subq, layer.Placement)
+	subq.ColumnExpr("tile_id")
+	subq.ColumnExpr("MIN(quad_key) AS min_quad_key")
+	subq.ColumnExpr("MAX(quad_key) AS max_quad_key")
+	// point is stored in lat,lon order, so X of extent is latitude
+	subq.ColumnExpr("ST_XMin(ST_Extent(point::geometry)) AS min_lat")
+	subq.ColumnExpr("ST_XMax(ST_Extent(point::geometry)) AS max_lat")
+	subq.ColumnExpr("ST_YMin(ST_Extent(point::geometry)) AS min_lon")
+	subq.ColumnExpr("ST_YMax(ST_Extent(point::geometry)) AS max_lon")
+	if layer.ClusterMembers > 0 {
+		subq.ColumnExpr("CASE WHEN COUNT(id) > 1 THEN to_jsonb((array_agg(jsonb_build_object('id', id, 'properties', properties) ORDER BY id))[1:?]) END AS cluster_data", layer.ClusterMembers)
+	}
+	err := columnAggregates(subq, layer.Aggregations)
+	if err != nil {
+		return nil, err
+	}
+	subq.Order("tile_id")
+	subq.Group("tile_id")
+	q := db.NewSelect().With("objects", base)
+	q.TableExpr("(?) AS cluster", subq)
+	q.Join("left join ? gp on gp.id = cluster.representative_id", bun.Ident(layer.Table))
+	if top := topValuesQuery(db, layer.Aggregations); top != nil {
+		q.Join("left join (?) top on top._top_tile_id = cluster.tile_id", top)
+	}
+	return q, nil
+}
+
+// pyramidClustersQuery reads clusters of request tiles from pyramid, tileIDs must not be empty
+func (e *engine) pyramidClustersQuery(db bun.IDB, layer *Layer, mr *geo.MapRequest, tileIDs []int64) *bun.SelectQuery {
+	zoom := e.gs.ClusterZoom(mr)
+	shift := e.gs.QuadKeySystem.BitDelta(mr.Zoom) - e.gs.QuadKeySystem.BitDelta(zoom)
+	q := db.NewSelect().TableExpr("? AS pt", bun.Ident(layer.PyramidTable()))
+	q.ColumnExpr("pt.tile_id, pt.count, pt.min_id, pt.representative_id")
+	q.ColumnExpr("pt.min_quad_key, pt.max_quad_key, pt.min_lat, pt.max_lat, pt.min_lon, pt.max_lon")
+	centroid := "ST_SetSRID(ST_MakePoint(pt.lat_sum / pt.count, pt.lon_sum / pt.count), 4326)"
+	if layer.Placement.PositionMethod() == geo.PositionWeighted {
+		q.ColumnExpr("COALESCE(ST_SetSRID(ST_MakePoint(pt.weighted_lat_sum / NULLIF(pt.weight_sum, 0), pt.weighted_lon_sum / NULLIF(pt.weight_sum, 0)), 4326), " + centroid + ") AS centroid")
+	} else {
+		q.ColumnExpr(centroid + " AS centroid")
+	}
+	q.ColumnExpr("CASE WHEN pt.count > 1 THEN pt.cluster_data END AS cluster_data")
+	parts := make([]string, 0, len(layer.Aggregations))
+	args := make([]interface{}, 0, len(layer.Aggregations)*3)
+	for _, agg := range layer.Aggregations {
+		if agg.Func == geo.AggregateAvg {
+			parts = append(parts, "?, (pt.aggregates->?->>'sum')::numeric / NULLIF((pt.aggregates->?->>'count')::numeric, 0)")
+			args = append(args, agg.Name, agg.Name, agg.Name)
+			continue
+		}
+		parts = append(parts, "?, pt.aggregates->?")
+		args = append(args, agg.Name, agg.Name)
+	}
+	if len(parts) > 0 {
+		q.ColumnExpr("jsonb_build_object("+strings.Join(parts, ", ")+") AS aggregates", args...)
+	}
+	q.ColumnExpr("gp.*")
+	q.Join("left join ? gp on gp.id = pt.representative_id", bun.Ident(layer.Table))
+	q.Where("pt.zoom = ?", zoom)
+	// ranges of child tiles keep primary key index usable
+	q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+		for _, tileID := range tileIDs {
+			q.WhereOr("pt.tile_id >= ? AND pt.tile_id < ?", tileID<<shift, (tileID+1)<<shift)
+		}
+		return q
+	})
+	q.Order("pt.tile_id")
+	return q
+}
+
+// densityQuery counts objects of request tiles and their non-empty sub-tiles up to maxDepth
+func (e *engine) densityQuery(db bun.IDB, layer *Layer, mr *geo.MapRequest, maxDepth int64, tileIDs []int64) *bun.SelectQuery {
+	bitDelta := e.gs.QuadKeySystem.BitDelta(mr.Zoom)
+	q := db.NewSelect().TableExpr("? AS geo_object", bun.Ident(layer.Table))
+	q.ColumnExpr("quad_key >> ? AS tile_id", bitDelta)
+	q.ColumnExpr("COUNT(id) AS total")
+	parts := make([]string, 0, maxDepth)
+	args := make([]interface{}, 0, maxDepth)
+	for depth := int64(1); depth <= maxDepth; depth++ {
+		parts = append(parts, "COUNT(DISTINCT quad_key >> ?)")
+		args = append(args, e.gs.QuadKeySystem.BitDelta(mr.Zoom+depth))
+	}
+	if len(parts) > 0 {
+		q.ColumnExpr("ARRAY["+strings.Join(parts, ", ")+"] AS sub_tiles", args...)
+	}
+	q.Where("quad_key >> ? in (?)", bitDelta, bun.In(tileIDs))
+	whereWithin(q, mr.Within)
+	wherePropertyFilter(q, mr.Filter)
+	q.GroupExpr("quad_key >> ?", bitDelta)
+	return q
+}
+
+// pyramidDensityQuery counts non-empty tiles of pyramid under request tiles at every depth, tileIDs must not be empty
+func (e *engine) pyramidDensityQuery(db bun.IDB, layer *Layer, zoom int64, maxDepth int64, tileIDs []int64) *bun.SelectQuery {
+	q := db.NewSelect().TableExpr("? AS pt", bun.Ident(layer.PyramidTable()))
+	q.ColumnExpr("tile_id >> (2 * (zoom - ?)) AS tile_id", zoom)
+	q.ColumnExpr("zoom - ? AS depth", zoom)
+	q.ColumnExpr("COUNT(*) AS tiles")
+	q.ColumnExpr("SUM(count)::bigint AS total")
+	// ranges of child tiles keep primary key index usable
+	q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+		for depth := int64(0); depth <= maxDepth; depth++ {
+			shift := 2 * depth
+			for _, tileID := range tileIDs {
+				q.WhereOr("zoom = ? AND tile_id >= ? AND tile_id < ?", zoom+depth, tileID<<shift, (tileID+1)<<shift)
+			}
+		}
+		return q
+	})
+	q.GroupExpr("1, 2")
+	return q
+}
+
+// objectsLevelQuery groups objects by quad key into pyramid tiles of max zoom
+func (e *engine) objectsLevelQuery(db bun.IDB, layer *Layer) (*bun.SelectQuery, error) {
+	q := db.NewSelect().TableExpr("? AS geo_object", bun.Ident(layer.Table))
+	q.ColumnExpr("?::integer", e.gs.QuadKeySystem.MaxZoom())
+	q.ColumnExpr("quad_key")
+	q.ColumnExpr("COUNT(id)")
+	q.ColumnExpr("SUM(lat)")
+	q.ColumnExpr("SUM(lon)")
+	if layer.Placement.PositionMethod() == geo.PositionWeighted {
+		weight := layer.Placement.WeightProperty()
+		w := schema.SafeQuery("("+numericExpr+")::double precision", []interface{}{weight, weight})
+		q.ColumnExpr("SUM(?), SUM(lat * ?), SUM(lon * ?)", w, w, w)
+	} else {
+		q.ColumnExpr("NULL::double precision, NULL::double precision, NULL::double precision")
+	}
+	q.ColumnExpr("MIN(id)")
+	if priority := layer.Placement.PriorityProperty(); priority != "" {
+		q.ColumnExpr("(array_agg(id ORDER BY "+numericExpr+" DESC NULLS LAST, id))[1]", priority, priority)
+		q.ColumnExpr("MAX("+numericExpr+")::double precision", priority, priority)
+	} else {
+		q.ColumnExpr("MIN(id), NULL::double precision")
+	}
+	q.ColumnExpr("MIN(quad_key), MAX(quad_key), MIN(lat), MAX(lat), MIN(lon), MAX(lon)")
+	if layer.ClusterMembers > 0 {
+		q.ColumnExpr("to_jsonb((array_agg(jsonb_build_object('id', id, 'properties', properties) ORDER BY id))[1:?])", layer.ClusterMembers)
+	} else {
+		q.ColumnExpr("NULL::jsonb")
+	}
+	parts := make([]string, 0, len(layer.Aggregations))
+	args := make([]interface{}, 0, len(layer.Aggregations)*3)
+	for _, agg := range layer.Aggregations {
+		num := schema.SafeQuery(numericExpr, []interface{}{agg.Property, agg.Property})
+		if agg.Func == geo.AggregateAvg {
+			parts = append(parts, "?, jsonb_build_object('sum', SUM(?), 'count', COUNT(?))")
+			args = append(args, agg.Name, num, num)
+			continue
+		}
+		fn, err := aggregateFuncSQL(agg)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, "?, "+fn+"(?)")
+		args = append(args, agg.Name, num)
+	}
+	pyramidAggregatesColumn(q, parts, args)
+	q.ColumnExpr("MAX(id), SUM(quad_key)")
+	q.Group("quad_key")
+	return q, nil
+}
+
+// childrenLevelQuery combines pyramid tiles of zoom+1 into tiles of zoom
+func (e *engine) childrenLevelQuery(db bun.IDB, layer *Layer, zoom int64) (*bun.SelectQuery, error) {
+	q := db.NewSelect().TableExpr("? AS child", bun.Ident(layer.PyramidTable()))
+	q.ColumnExpr("?::integer", zoom)
+	q.ColumnExpr("tile_id >> 2")
+	q.ColumnExpr("SUM(count)")
+	q.ColumnExpr("SUM(lat_sum), SUM(lon_sum)")
+	q.ColumnExpr("SUM(weight_sum), SUM(weighted_lat_sum), SUM(weighted_lon_sum)")
+	q.ColumnExpr("MIN(min_id)")
+	q.ColumnExpr("(array_agg(representative_id ORDER BY representative_priority DESC NULLS LAST, representative_id))[1]")
+	q.ColumnExpr("MAX(representative_priority)")
+	q.ColumnExpr("MIN(min_quad_key), MAX(max_quad_key), MIN(min_lat), MAX(max_lat), MIN(min_lon), MAX(max_lon)")
+	if layer.ClusterMembers > 0 {
+		// members of children are flattened and the first of them by id are kept
+		q.ColumnExpr("(SELECT to_jsonb((array_agg(m ORDER BY (m->>'id')::bigint))[1:?]) FROM jsonb_array_elements(jsonb_path_query_array(jsonb_agg(cluster_data), '$[*][*]')) AS m)", layer.ClusterMembers)
+	} else {
+		q.ColumnExpr("NULL::jsonb")
+	}
+	parts := make([]string, 0, len(layer.Aggregations))
+	args := make([]interface{}, 0, len(layer.Aggregations)*3)
+	for _, agg := range layer.Aggregations {
+		if agg.Func == geo.AggregateAvg {
+			parts = append(parts, "?, jsonb_build_object('sum', SUM((aggregates->?->>'sum')::numeric), 'count', SUM((aggregates->?->>'count')::numeric))")
+			args = append(args, agg.Name, agg.Name, agg.Name)
+			continue
+		}
+		fn, err := aggregateFuncSQL(agg)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, "?, "+fn+"((aggregates->>?)::numeric)")
+		args = append(args, agg.Name, agg.Name)
+	}
+	pyramidAggregatesColumn(q, parts, args)
+	q.ColumnExpr("MAX(max_id), SUM(quad_key_sum)")
+	q.Where("zoom = ?", zoom+1)
+	q.GroupExpr("tile_id >> 2")
+	return q, nil
+}
+
+// pyramidTileQuery recomputes single pyramid tile, tiles of max zoom are made of objects
+// and tiles of other zooms of their children
+func (e *engine) pyramidTileQuery(db bun.IDB, layer *Layer, zoom, tileID int64) (*bun.SelectQuery, error) {
+	if zoom == e.gs.QuadKeySystem.MaxZoom() {
+		q, err := e.objectsLevelQuery(db, layer)
+		if err != nil {
+			return nil, err
+		}
+		return q.Where("quad_key = ?", tileID), nil
+	}
+	q, err := e.childrenLevelQuery(db, layer, zoom)
+	if err != nil {
+		return nil, err
+	}
+	return q.Where("tile_id >= ?", tileID<<2).Where("tile_id < ?", (tileID+1)<<2), nil
+}
+
+// pyramidFreshQuery returns true if root tile of pyramid has the same number, max id and sum of quad keys
+// as objects of layer. Objects stored while pyramid was disabled break the equality.
+func (e *engine) pyramidFreshQuery(db bun.IDB, layer *Layer) *bun.SelectQuery {
+	objects := db.NewSelect().TableExpr("? AS geo_object", bun.Ident(layer.Table))
+	objects.ColumnExpr("COUNT(id) AS count, COALESCE(MAX(id), 0) AS max_id, COALESCE(SUM(quad_key), 0) AS quad_key_sum")
+	root := db.NewSelect().TableExpr("? AS pt", bun.Ident(layer.PyramidTable()))
+	root.ColumnExpr("COALESCE(SUM(count), 0) AS count, COALESCE(MAX(max_id), 0) AS max_id, COALESCE(SUM(quad_key_sum), 0) AS quad_key_sum")
+	root.Where("zoom = ?", e.gs.QuadKeySystem.MinZoom())
+	q := db.NewSelect().TableExpr("(?) AS o, (?) AS p", objects, root)
+	q.ColumnExpr("o.count = p.count AND o.max_id = p.max_id AND o.quad_key_sum = p.quad_key_sum")
+	return q
+}
+
+func pyramidAggregatesColumn(q *bun.SelectQuery, parts []string, args []interface{}) {
+	if len(parts) == 0 {
+		q.ColumnExpr("NULL::jsonb")
+		return
+	}
+	q.ColumnExpr("jsonb_build_object("+strings.Join(parts, ", ")+")", args...)
+}
+
+// nearbyQuery selects objects of layer within radius ordered by distance
+func (e *engine) nearbyQuery(db bun.IDB, layer *Layer, nr *geo.NearbyRequest) *bun.SelectQuery {
+	center := schema.SafeQuery("ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography", []interface{}{nr.Lon, nr.Lat})
+	q := db.NewSelect().Model((*GeoObject)(nil)).ModelTableExpr("? AS geo_object", bun.Ident(layer.Table))
+	q.ColumnExpr("*")
+	q.ColumnExpr("ST_Distance(?, ?) AS distance", bun.Safe(geographyExpr), center)
+	q.Where("ST_DWithin(?, ?, ?)", bun.Safe(geographyExpr), center, nr.Radius)
+	q.OrderExpr("? <-> ?", bun.Safe(geographyExpr), center)
+	q.Limit(int(nr.Limit))
+	return q
+}
+
+// clusterMembersQuery selects requested page of cluster objects into dest
+func (e *engine) clusterMembersQuery(db bun.IDB, layer *Layer, cr *geo.ClusterMembersRequest, dest *[]*GeoObject) *bun.SelectQuery {
+	// cluster members are in continuous range of quad keys, so quad key index is used
+	shift := e.gs.QuadKeySystem.BitDelta(cr.Zoom)
+	q := db.NewSelect().Model(dest).ModelTableExpr("? AS geo_object", bun.Ident(layer.Table))
+	q.Where("quad_key >= ?", cr.TileID<<shift)
+	q.Where("quad_key < ?", (cr.TileID+1)<<shift)
+	whereWithin(q, cr.Within)
+	wherePropertyFilter(q, cr.Filter)
+	q.Order("id")
+	q.Offset(int(cr.Offset))
+	q.Limit(int(cr.Limit))
+	return q
+}
+
+// upsertQuery computes quad key of object and inserts or updates it
+func (e *engine) upsertQuery(db bun.IDB, layer *Layer, obj *GeoObject) *bun.InsertQuery {
+	obj.QuadKey = e.gs.CoordinatesToQuadKey(obj.Lat, obj.Lon).Int64()
+	return db.NewInsert().Model(obj).ModelTableExpr("? AS geo_object", bun.Ident(layer.Table)).On("CONFLICT (id) DO UPDATE")
+}
+
+// addFeatures puts loaded clusters of layer into fc and returns number of clusters of several objects
+func (e *engine) addFeatures(layer *Layer, mr *geo.MapRequest, objects []*Cluster, fc *geo.FeatureCollection) (int, error) {
+	clusterZoom := e.gs.ClusterZoom(mr)
+	clusters := 0
+	for _, object := range objects {
+		// todo here we can put object into cache
+		id := geo.LayerFeatureID(layer.Name, object.ID)
+		mr.DebugInfo.AddCluster(layer.Name, object.ID, clusterZoom, object.Count)
+		if object.Count <= 1 {
+			point := &geo.GeographicPoint{
+				Latitude:  object.Lat,
+				Longitude: object.Lon,
+			}
+			err := fc.Add(id, point, layer.Mapper(object))
+			if err != nil {
+				return clusters, err
+			}
+			continue
+		}
+		clusters++
+		if len(layer.Aggregations) > 0 {
+			object.Aggregates = clusterAggregates(layer.Aggregations, object)
+		}
+		if layer.Placement.PositionMethod() == geo.PositionTileCenter {
+			center, err := e.gs.TileIDToCenterPoint(object.ID, clusterZoom)
+			if err != nil {
+				return clusters, err
+			}
+			object.Centroid = center
+		}
+		props := layer.Mapper(object)
+		if props == nil {
+			props = make(map[string]interface{})
+		}
+		for key, value := range e.gs.ClusterBoundsProperties(object.BBox(), object.MinQuadKey, object.MaxQuadKey, mr.ClusterDepth) {
+			props[key] = value
+		}
+		if len(layer.Aggregations) > 0 {
+			props["aggregates"] = object.Aggregates
+		}
+		err := fc.Add(id, object.Centroid, props)
+		if err != nil {
+			return clusters, err
+		}
+	}
+	return clusters, nil
+}
@@ -0,0 +1,186 @@
+package pgds
+
+import (
+	"database/sql"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/ai-zelenin/geo-host/pkg/style"
+	"github.com/stretchr/testify/suite"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"testing"
+)
+
+func TestEngineSuite(t *testing.T) {
+	suite.Run(t, new(EngineSuite))
+}
+
+// EngineSuite checks generated SQL, queries are only formatted, so no database is needed
+type EngineSuite struct {
+	suite.Suite
+	db     *bun.DB
+	engine *engine
+	layer  *Layer
+}
+
+func (s *EngineSuite) SetupTest() {
+	s.db = bun.NewDB(&sql.DB{}, pgdialect.New())
+	s.engine = newEngine(geo.NewGeographicSystem(geo.DefaultGeoSystemConfig))
+	var err error
+	s.layer, err = NewLayer(geo.DefaultLayer, style.NewMapper[*Cluster](style.MustNewStyle(style.DefaultLayerConfig)))
+	s.Require().Nil(err)
+}
+
+func (s *EngineSuite) sql(q bun.Query) string {
+	data, err := q.AppendQuery(s.db.Formatter(), nil)
+	s.Require().Nil(err)
+	return string(data)
+}
+
+// query fails test on error of query builder
+func (s *EngineSuite) query(q *bun.SelectQuery, err error) *bun.SelectQuery {
+	s.Require().Nil(err)
+	return q
+}
+
+func (s *EngineSuite) TestClustersQuery() {
+	cases := []struct {
+		zoom, depth int64
+		tiles       string
+		clusters    string
+	}{
+		{zoom: 10, depth: 0, tiles: "quad_key >> 26 in (5, 6)", clusters: "quad_key >> 26 as tile_id"},
+		{zoom: 10, depth: 2, tiles: "quad_key >> 26 in (5, 6)", clusters: "quad_key >> 22 as tile_id"},
+		{zoom: 21, depth: 2, tiles: "quad_key >> 4 in (5, 6)", clusters: "quad_key >> 0 as tile_id"},
+		// cluster zoom is limited by max zoom
+		{zoom: 22, depth: 4, tiles: "quad_key >> 2 in (5, 6)", clusters: "quad_key >> 0 as tile_id"},
+	}
+	for _, c := range cases {
+		mr := &geo.MapRequest{Zoom: c.zoom, ClusterDepth: c.depth}
+		q := s.sql(s.query(s.engine.clustersQuery(s.db, s.layer, mr, []int64{5, 6})))
+		s.Contains(q, `WITH "objects" AS (SELECT *, `+c.clusters+` FROM "geo_objects" AS geo_object WHERE (`+c.tiles+`))`)
+		s.Contains(q, `FROM objects GROUP BY "tile_id" ORDER BY "tile_id") AS cluster left join "geo_objects" gp on gp.id = cluster.representative_id`)
+		s.Contains(q, "[1:10]")
+		s.NotContains(q, "top")
+	}
+}
+
+func (s *EngineSuite) TestClustersQueryOfLayer() {
+	layer, err := NewLayer("metro", s.layer.Mapper)
+	s.Require().Nil(err)
+	layer.ClusterMembers = 0
+	layer.Aggregations = []*geo.Aggregation{{Name: "lines", Property: "line", Func: geo.AggregateTop}}
+	filter, err := geo.ParsePropertyFilter("line:3")
+	s.Require().Nil(err)
+	mr := &geo.MapRequest{Zoom: 12, ClusterDepth: 1, Filter: filter}
+	q := s.sql(s.query(s.engine.clustersQuery(s.db, layer, mr, []int64{7})))
+	s.Contains(q, `FROM "geo_objects_metro" AS geo_object WHERE (quad_key >> 22 in (7)) AND (`)
+	s.Contains(q, `left join "geo_objects_metro" gp`)
+	s.Contains(q, "top._top_tile_id = cluster.tile_id")
+	s.NotContains(q, "cluster_data")
+}
+
+func (s *EngineSuite) TestAggregations() {
+	layer, err := NewLayer("metro", s.layer.Mapper)
+	s.Require().Nil(err)
+	layer.Aggregations = []*geo.Aggregation{
+		{Name: "total", Property: "passengers", Func: geo.AggregateSum},
+		{Name: "mean", Property: "passengers", Func: geo.AggregateAvg},
+	}
+	mr := &geo.MapRequest{Zoom: 12, ClusterDepth: 1}
+	q := s.sql(s.query(s.engine.clustersQuery(s.db, layer, mr, []int64{7})))
+	s.Contains(q, `jsonb_build_object('total', SUM(CASE`)
+	s.Contains(q, `'mean', AVG(CASE`)
+	s.Contains(s.sql(s.query(s.engine.objectsLevelQuery(s.db, layer))), `jsonb_build_object('total', SUM(CASE`)
+	s.Contains(s.sql(s.query(s.engine.childrenLevelQuery(s.db, layer, 22))), `jsonb_build_object('total', SUM((aggregates->>'total')::numeric)`)
+
+	// func set directly on layer is not put into SQL
+	layer.Aggregations = append(layer.Aggregations, &geo.Aggregation{Name: "x", Property: "p", Func: "count(*)); DROP TABLE geo_objects; --"})
+	_, err = s.engine.clustersQuery(s.db, layer, mr, []int64{7})
+	s.Error(err)
+	_, err = s.engine.objectsLevelQuery(s.db, layer)
+	s.Error(err)
+	_, err = s.engine.childrenLevelQuery(s.db, layer, 22)
+	s.Error(err)
+}
+
+func (s *EngineSuite) TestPyramidClustersQuery() {
+	mr := &geo.MapRequest{Zoom: 10, ClusterDepth: 2}
+	s.Equal(`SELECT pt.tile_id, pt.count, pt.min_id, pt.representative_id, pt.min_quad_key, pt.max_quad_key, pt.min_lat, pt.max_lat, pt.min_lon, pt.max_lon, `+
+		`ST_SetSRID(ST_MakePoint(pt.lat_sum / pt.count, pt.lon_sum / pt.count), 4326) AS centroid, CASE WHEN pt.count > 1 THEN pt.cluster_data END AS cluster_data, gp.* `+
+		`FROM "geo_objects_pyramid" AS pt left join "geo_objects" gp on gp.id = pt.representative_id `+
+		`WHERE (pt.zoom = 12) AND ((pt.tile_id >= 80 AND pt.tile_id < 96) OR (pt.tile_id >= 96 AND pt.tile_id < 112)) ORDER BY "pt"."tile_id"`,
+		s.sql(s.engine.pyramidClustersQuery(s.db, s.layer, mr, []int64{5, 6})))
+	// cluster zoom is limited by max zoom
+	mr = &geo.MapRequest{Zoom: 22, ClusterDepth: 4}
+	s.Contains(s.sql(s.engine.pyramidClustersQuery(s.db, s.layer, mr, []int64{5})), "WHERE (pt.zoom = 23) AND ((pt.tile_id >= 20 AND pt.tile_id < 24))")
+}
+
+func (s *EngineSuite) TestDensityQueries() {
+	mr := &geo.MapRequest{Zoom: 10}
+	s.Equal(`SELECT quad_key >> 26 AS tile_id, COUNT(id) AS total, ARRAY[COUNT(DISTINCT quad_key >> 24), COUNT(DISTINCT quad_key >> 22)] AS sub_tiles `+
+		`FROM "geo_objects" AS geo_object WHERE (quad_key >> 26 in (5)) GROUP BY quad_key >> 26`,
+		s.sql(s.engine.densityQuery(s.db, s.layer, mr, 2, []int64{5})))
+	s.Equal(`SELECT tile_id >> (2 * (zoom - 10)) AS tile_id, zoom - 10 AS depth, COUNT(*) AS tiles, SUM(count)::bigint AS total `+
+		`FROM "geo_objects_pyramid" AS pt WHERE ((zoom = 10 AND tile_id >= 5 AND tile_id < 6) OR (zoom = 11 AND tile_id >= 20 AND tile_id < 24)) GROUP BY 1, 2`,
+		s.sql(s.engine.pyramidDensityQuery(s.db, s.layer, 10, 1, []int64{5})))
+}
+
+func (s *EngineSuite) TestPyramidLevelQueries() {
+	objects := s.sql(s.query(s.engine.objectsLevelQuery(s.db, s.layer)))
+	s.Contains(objects, `SELECT 23::integer, quad_key, COUNT(id), SUM(lat), SUM(lon)`)
+	s.Contains(objects, `NULL::jsonb, MAX(id), SUM(quad_key) FROM "geo_objects" AS geo_object GROUP BY "quad_key"`)
+	children := s.sql(s.query(s.engine.childrenLevelQuery(s.db, s.layer, 22)))
+	s.Contains(children, `SELECT 22::integer, tile_id >> 2, SUM(count)`)
+	s.Contains(children, `MAX(max_id), SUM(quad_key_sum) FROM "geo_objects_pyramid" AS child WHERE (zoom = 23) GROUP BY tile_id >> 2`)
+}
+
+func (s *EngineSuite) TestPyramidTileQuery() {
+	q := s.sql(s.query(s.engine.pyramidTileQuery(s.db, s.layer, 23, 1234)))
+	s.Contains(q, `FROM "geo_objects" AS geo_object WHERE (quad_key = 1234) GROUP BY "quad_key"`)
+	q = s.sql(s.query(s.engine.pyramidTileQuery(s.db, s.layer, 10, 5)))
+	s.Contains(q, `SELECT 10::integer, tile_id >> 2`)
+	s.Contains(q, `WHERE (zoom = 11) AND (tile_id >= 20) AND (tile_id < 24) GROUP BY tile_id >> 2`)
+}
+
+func (s *EngineSuite) TestPyramidFreshQuery() {
+	s.Equal(`SELECT o.count = p.count AND o.max_id = p.max_id AND o.quad_key_sum = p.quad_key_sum FROM `+
+		`(SELECT COUNT(id) AS count, COALESCE(MAX(id), 0) AS max_id, COALESCE(SUM(quad_key), 0) AS quad_key_sum FROM "geo_objects" AS geo_object) AS o, `+
+		`(SELECT COALESCE(SUM(count), 0) AS count, COALESCE(MAX(max_id), 0) AS max_id, COALESCE(SUM(quad_key_sum), 0) AS quad_key_sum `+
+		`FROM "geo_objects_pyramid" AS pt WHERE (zoom = 0)) AS p`,
+		s.sql(s.engine.pyramidFreshQuery(s.db, s.layer)))
+}
+
+func (s *EngineSuite) TestClusterMembersQuery() {
+	var objects []*GeoObject
+	cr := &geo.ClusterMembersRequest{TileID: 5, Zoom: 10, Offset: 20, Limit: 10}
+	s.Equal(`SELECT "geo_object"."id", "geo_object"."quad_key", "geo_object"."lat", "geo_object"."lon", "geo_object"."properties", "geo_object"."point" `+
+		`FROM "geo_objects" AS geo_object WHERE (quad_key >= 335544320) AND (quad_key < 402653184) ORDER BY "id" LIMIT 10 OFFSET 20`,
+		s.sql(s.engine.clusterMembersQuery(s.db, s.layer, cr, &objects)))
+}
+
+func (s *EngineSuite) TestUpsertQuery() {
+	obj := &GeoObject{ID: 1, Lat: 55.75, Lon: 37.61}
+	q := s.sql(s.engine.upsertQuery(s.db, s.layer, obj))
+	s.Equal(s.engine.gs.CoordinatesToQuadKey(55.75, 37.61).Int64(), obj.QuadKey)
+	s.Contains(q, `INSERT INTO "geo_objects" AS geo_object`)
+	s.Contains(q, `ON CONFLICT (id) DO UPDATE`)
+}
+
+func (s *EngineSuite) TestAddFeatures() {
+	s.layer.Placement = &geo.ClusterPlacement{Position: geo.PositionTileCenter}
+	mr := &geo.MapRequest{Zoom: 10, ClusterDepth: 1}
+	objects := []*Cluster{
+		{ID: 20, Count: 1, GeoObject: GeoObject{ID: 1, Lat: 55.75, Lon: 37.61}},
+		{ID: 21, Count: 3, MinQuadKey: 21 << 24, MaxQuadKey: 22<<24 - 1, GeoObject: GeoObject{ID: 2, Lat: 55.76, Lon: 37.62}},
+	}
+	fc := geo.NewFeatureCollection()
+	clusters, err := s.engine.addFeatures(s.layer, mr, objects, fc)
+	s.Require().Nil(err)
+	s.Equal(1, clusters)
+	s.Require().Len(fc.Features, 2)
+	s.Equal("21", fc.Features[1].ID)
+	center, err := s.engine.gs.TileIDToCenterPoint(21, 11)
+	s.Require().Nil(err)
+	s.Equal(center, objects[1].Centroid)
+	s.Contains(fc.Features[1].Properties, "bounds")
+}
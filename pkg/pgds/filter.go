@@ -0,0 +1,48 @@
+package pgds
+
+import (
+	"encoding/json"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/uptrace/bun"
+	"strings"
+)
+
+// whereWithin restricts objects to area
+func whereWithin(q *bun.SelectQuery, area geo.Primitive) *bun.SelectQuery {
+	if area != nil {
+		q.Where("ST_Intersects(point::geometry, ?::geometry)", area)
+	}
+	return q
+}
+
+// wherePropertyFilter translates filter to JSONB conditions.
+// Equality is expressed with @> operator to make use of properties GIN index.
+func wherePropertyFilter(q *bun.SelectQuery, filter geo.PropertyFilter) *bun.SelectQuery {
+	for _, cond := range filter {
+		switch cond.Op {
+		case geo.FilterEq, geo.FilterIn:
+			parts := make([]string, 0, len(cond.Values))
+			args := make([]interface{}, 0, len(cond.Values))
+			for _, value := range cond.Values {
+				for _, variant := range geo.FilterValueVariants(value) {
+					doc, _ := json.Marshal(map[string]interface{}{cond.Key: variant})
+					parts = append(parts, "properties @> ?::jsonb")
+					args = append(args, string(doc))
+				}
+			}
+			if len(parts) == 0 {
+				q.Where("FALSE")
+				continue
+			}
+			q.Where("("+strings.Join(parts, " OR ")+")", args...)
+		case geo.FilterRange:
+			if cond.Min != nil {
+				q.Where(numericExpr+" >= ?", cond.Key, cond.Key, *cond.Min)
+			}
+			if cond.Max != nil {
+				q.Where(numericExpr+" <= ?", cond.Key, cond.Key, *cond.Max)
+			}
+		}
+	}
+	return q
+}
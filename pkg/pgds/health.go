@@ -0,0 +1,61 @@
+package pgds
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/uptrace/bun"
+	"strings"
+)
+
+// CheckHealth checks connectivity, PostGIS extension, migrations and indexes of registered layers
+func (p *PostGISDataSource) CheckHealth(ctx context.Context) error {
+	err := p.DB.PingContext(ctx)
+	if err != nil {
+		return err
+	}
+	var version string
+	err = p.DB.NewSelect().ColumnExpr("extversion").TableExpr("pg_extension").Where("extname = 'postgis'").Scan(ctx, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("postgis extension is not installed")
+	}
+	if err != nil {
+		return err
+	}
+	pending, err := p.pendingMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return fmt.Errorf("%d migrations are not applied", pending)
+	}
+	expected := make([]string, 0)
+	p.mu.RLock()
+	for _, layer := range p.layers {
+		expected = append(expected, layer.IndexNames()...)
+	}
+	p.mu.RUnlock()
+	var existing []string
+	err = p.DB.NewSelect().ColumnExpr("indexname").TableExpr("pg_indexes").
+		Where("schemaname = current_schema()").
+		Where("indexname IN (?)", bun.In(expected)).
+		Scan(ctx, &existing)
+	if err != nil {
+		return err
+	}
+	found := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		found[name] = true
+	}
+	missing := make([]string, 0)
+	for _, name := range expected {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing indexes: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package pgds
+
+import (
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+)
+
+const (
+	DefaultTable          = geo.DefaultLayerTable
+	DefaultClusterMembers = 10
+)
+
+// names of indexes of layer table, see indexName
+const (
+	pointIndex      = "point_st_gist"
+	quadKeyIndex    = "quad_key_btree"
+	geographyIndex  = "geog_gist"
+	propertiesIndex = "properties_gin"
+)
+
+// Layer is a named set of objects stored in its own table
+type Layer struct {
+	Name   string
+	Table  string
+	Mapper PropertiesMapper
+	// ClusterMembers is number of objects put into ClusterData of cluster, 0 disables members loading
+	ClusterMembers int64
+	// Aggregations are computed over all members of cluster
+	Aggregations []*geo.Aggregation
+	// Placement of cluster marker and representative member, centroid and lowest id if nil
+	Placement *geo.ClusterPlacement
+	// Pyramid is set by EnablePyramid when precomputed clusters of layer are available
+	Pyramid bool
+}
+
+func NewLayer(name string, mapper PropertiesMapper) (*Layer, error) {
+	table, err := geo.LayerTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Layer{Name: name, Table: table, Mapper: mapper, ClusterMembers: DefaultClusterMembers}, nil
+}
+
+// IndexNames returns names of indexes created by CreateSchema
+func (l *Layer) IndexNames() []string {
+	return []string{l.indexName(pointIndex), l.indexName(quadKeyIndex), l.indexName(geographyIndex), l.indexName(propertiesIndex)}
+}
+
+// indexName keeps original index names of default table
+func (l *Layer) indexName(name string) string {
+	if l.Table == DefaultTable {
+		return name
+	}
+	return l.Table + "_" + name
+}
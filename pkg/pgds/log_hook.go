@@ -0,0 +1,45 @@
+package pgds
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/ai-zelenin/geo-host/pkg/logging"
+	"github.com/uptrace/bun"
+	"time"
+)
+
+// QueryLogConfig controls logging of SQL queries
+type QueryLogConfig struct {
+	// Level of every query, queries are hidden when logger level is higher
+	Level logging.Level `json:"level" yaml:"level"`
+	// SlowThreshold makes queries taking longer logged as warnings, zero disables it
+	SlowThreshold time.Duration `json:"slow_threshold" yaml:"slow_threshold"`
+}
+
+var DefaultQueryLogConfig = QueryLogConfig{
+	Level:         logging.LevelDebug,
+	SlowThreshold: time.Second,
+}
+
+// logQueryHook writes queries to logger, failed queries are logged as errors
+type logQueryHook struct {
+	logger logging.Logger
+	cfg    QueryLogConfig
+}
+
+func (logQueryHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (h logQueryHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	duration := time.Since(event.StartTime)
+	switch {
+	case event.Err != nil && !errors.Is(event.Err, sql.ErrNoRows):
+		h.logger.Error("query failed", "query", event.Query, "duration", duration, "err", event.Err)
+	case h.cfg.SlowThreshold > 0 && duration >= h.cfg.SlowThreshold:
+		h.logger.Warn("slow query", "query", event.Query, "duration", duration)
+	case h.logger.Enabled(h.cfg.Level):
+		h.logger.Log(h.cfg.Level, "query", "query", event.Query, "duration", duration)
+	}
+}
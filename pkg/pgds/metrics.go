@@ -0,0 +1,77 @@
+package pgds
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/ai-zelenin/geo-host/pkg/metrics"
+	"github.com/uptrace/bun"
+	"strings"
+	"time"
+)
+
+// dataSourceMetrics are metrics of loading clusters, nil until metrics are enabled
+type dataSourceMetrics struct {
+	clusters *metrics.CounterVec
+	// cache counts pyramid loads as hits and live clustering of layers with pyramid as misses
+	cache *metrics.CounterVec
+}
+
+func (m *dataSourceMetrics) addClusters(layer string, n int) {
+	if m == nil || n == 0 {
+		return
+	}
+	m.clusters.With(layer).Add(float64(n))
+}
+
+func (m *dataSourceMetrics) addCacheLoad(layer *Layer, hit bool) {
+	if m == nil || !layer.Pyramid {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cache.With(layer.Name, result).Inc()
+}
+
+// metricsQueryHook observes durations of queries by operation
+type metricsQueryHook struct {
+	durations *metrics.HistogramVec
+	errors    *metrics.CounterVec
+}
+
+func (metricsQueryHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (h metricsQueryHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	operation := strings.ToLower(event.Operation())
+	h.durations.With(operation).Observe(time.Since(event.StartTime).Seconds())
+	if event.Err != nil && !errors.Is(event.Err, sql.ErrNoRows) {
+		h.errors.With(operation).Inc()
+	}
+}
+
+// EnableMetrics registers metrics of queries, connection pool and loaded clusters
+func (p *PostGISDataSource) EnableMetrics(reg *metrics.Registry) {
+	p.DB.AddQueryHook(metricsQueryHook{
+		durations: reg.NewHistogramVec("geo_db_query_duration_seconds", "Duration of database queries.", metrics.DefaultBuckets, "operation"),
+		errors:    reg.NewCounterVec("geo_db_query_errors_total", "Failed database queries.", "operation"),
+	})
+	stats := func(fn func(s sql.DBStats) float64) func() float64 {
+		return func() float64 {
+			return fn(p.DB.Stats())
+		}
+	}
+	reg.NewGaugeFunc("geo_db_connections_open", "Open database connections.", stats(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	reg.NewGaugeFunc("geo_db_connections_in_use", "Database connections in use.", stats(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	reg.NewGaugeFunc("geo_db_connections_idle", "Idle database connections.", stats(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	reg.NewGaugeFunc("geo_db_connections_max_open", "Maximum open database connections.", stats(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	reg.NewCounterFunc("geo_db_connections_wait_total", "Waits for database connection.", stats(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	reg.NewCounterFunc("geo_db_connections_wait_seconds_total", "Time spent waiting for database connection.", stats(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	p.metrics = &dataSourceMetrics{
+		clusters: reg.NewCounterVec("geo_clusters_returned_total", "Clusters of several objects returned by map requests.", "layer"),
+		cache:    reg.NewCounterVec("geo_pyramid_loads_total", "Loads of layers with pyramid by result, miss means clustering on the fly.", "layer", "result"),
+	}
+}
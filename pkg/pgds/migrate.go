@@ -0,0 +1,232 @@
+package pgds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/uptrace/bun"
+	"sort"
+	"time"
+)
+
+// ErrSchemaNotMigrated is returned by CheckSchema when migrations are pending
+var ErrSchemaNotMigrated = errors.New("database schema is not migrated, run geo migrate")
+
+// SchemaMigration is record of applied migration
+type SchemaMigration struct {
+	bun.BaseModel `bun:"table:geo_schema_migrations"`
+	// Scope is postgis or table of layer
+	Scope     string    `bun:"scope,pk"`
+	Version   int64     `bun:"version,pk"`
+	Name      string    `bun:"name,notnull"`
+	AppliedAt time.Time `bun:"applied_at,notnull,default:current_timestamp"`
+}
+
+// MigrationStatus is migration of scope with time of applying, zero if it is pending
+type MigrationStatus struct {
+	Scope     string
+	Version   int64
+	Name      string
+	AppliedAt time.Time
+}
+
+func (m *MigrationStatus) Applied() bool {
+	return !m.AppliedAt.IsZero()
+}
+
+// migrationScope is set of migrations applied to one layer or to database
+type migrationScope struct {
+	name       string
+	layer      *Layer
+	migrations []*Migration
+}
+
+// migrationScopes returns postgis scope and scopes of registered layers ordered by table
+func (p *PostGISDataSource) migrationScopes() []*migrationScope {
+	scopes := []*migrationScope{{name: postgisScope, migrations: postgisMigrations}}
+	p.mu.RLock()
+	for _, layer := range p.layers {
+		scopes = append(scopes, layerMigrationScope(layer))
+	}
+	p.mu.RUnlock()
+	sort.Slice(scopes[1:], func(i, j int) bool { return scopes[i+1].name < scopes[j+1].name })
+	return scopes
+}
+
+func layerMigrationScope(layer *Layer) *migrationScope {
+	return &migrationScope{name: layer.Table, layer: layer, migrations: layerMigrations}
+}
+
+func (p *PostGISDataSource) scope(name string) (*migrationScope, error) {
+	for _, s := range p.migrationScopes() {
+		if s.name == name {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown migration scope %q", name)
+}
+
+func (p *PostGISDataSource) createMigrationsTable(ctx context.Context) error {
+	_, err := p.DB.NewCreateTable().Model((*SchemaMigration)(nil)).IfNotExists().Exec(ctx)
+	return err
+}
+
+// lockMigrations serializes migrations of server instances sharing database
+func lockMigrations(ctx context.Context, tx bun.Tx) error {
+	_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext(?))", "geo_schema_migrations")
+	return err
+}
+
+// Migrate applies pending migrations of database and all registered layers
+func (p *PostGISDataSource) Migrate(ctx context.Context) error {
+	err := p.createMigrationsTable(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range p.migrationScopes() {
+		err = p.migrateScope(ctx, s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateScope applies every pending migration in its own transaction
+func (p *PostGISDataSource) migrateScope(ctx context.Context, s *migrationScope) error {
+	for _, m := range s.migrations {
+		err := p.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			err := lockMigrations(ctx, tx)
+			if err != nil {
+				return err
+			}
+			// other instance may have applied migration while waiting for lock
+			applied, err := tx.NewSelect().Model((*SchemaMigration)(nil)).
+				Where("scope = ?", s.name).Where("version = ?", m.Version).Exists(ctx)
+			if err != nil || applied {
+				return err
+			}
+			err = m.Up(ctx, tx, s.layer)
+			if err != nil {
+				return err
+			}
+			_, err = tx.NewInsert().Model(&SchemaMigration{Scope: s.name, Version: m.Version, Name: m.Name}).Exec(ctx)
+			if err != nil {
+				return err
+			}
+			p.logger.Info("migration applied", "scope", s.name, "version", m.Version, "name", m.Name)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s %d %s: %w", s.name, m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// Rollback reverts migrations of scope with versions greater than version, newest first
+func (p *PostGISDataSource) Rollback(ctx context.Context, scopeName string, version int64) error {
+	s, err := p.scope(scopeName)
+	if err != nil {
+		return err
+	}
+	err = p.createMigrationsTable(ctx)
+	if err != nil {
+		return err
+	}
+	for i := len(s.migrations) - 1; i >= 0 && s.migrations[i].Version > version; i-- {
+		m := s.migrations[i]
+		err = p.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			err := lockMigrations(ctx, tx)
+			if err != nil {
+				return err
+			}
+			res, err := tx.NewDelete().Model((*SchemaMigration)(nil)).
+				Where("scope = ?", s.name).Where("version = ?", m.Version).Exec(ctx)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err != nil || n == 0 {
+				return err
+			}
+			err = m.Down(ctx, tx, s.layer)
+			if err != nil {
+				return err
+			}
+			p.logger.Info("migration reverted", "scope", s.name, "version", m.Version, "name", m.Name)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("rollback %s %d %s: %w", s.name, m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// MigrationStatus returns all migrations of database and registered layers
+func (p *PostGISDataSource) MigrationStatus(ctx context.Context) ([]*MigrationStatus, error) {
+	err := p.createMigrationsTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.migrationStatus(ctx)
+}
+
+func (p *PostGISDataSource) migrationStatus(ctx context.Context) ([]*MigrationStatus, error) {
+	var exists bool
+	err := p.DB.NewSelect().ColumnExpr("to_regclass(?) IS NOT NULL", "geo_schema_migrations").Scan(ctx, &exists)
+	if err != nil {
+		return nil, err
+	}
+	// all migrations of fresh database are pending
+	var applied []*SchemaMigration
+	if exists {
+		err = p.DB.NewSelect().Model(&applied).Scan(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	appliedAt := make(map[string]time.Time, len(applied))
+	for _, a := range applied {
+		appliedAt[fmt.Sprintf("%s:%d", a.Scope, a.Version)] = a.AppliedAt
+	}
+	status := make([]*MigrationStatus, 0)
+	for _, s := range p.migrationScopes() {
+		for _, m := range s.migrations {
+			status = append(status, &MigrationStatus{
+				Scope:     s.name,
+				Version:   m.Version,
+				Name:      m.Name,
+				AppliedAt: appliedAt[fmt.Sprintf("%s:%d", s.name, m.Version)],
+			})
+		}
+	}
+	return status, nil
+}
+
+// pendingMigrations returns number of migrations which are not applied yet
+func (p *PostGISDataSource) pendingMigrations(ctx context.Context) (int, error) {
+	status, err := p.migrationStatus(ctx)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, m := range status {
+		if !m.Applied() {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// CheckSchema returns ErrSchemaNotMigrated if migrations of database or registered layers are pending
+func (p *PostGISDataSource) CheckSchema(ctx context.Context) error {
+	pending, err := p.pendingMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return fmt.Errorf("%w: %d migrations are pending", ErrSchemaNotMigrated, pending)
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package pgds
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/ai-zelenin/geo-host/pkg/logging"
+	"github.com/ai-zelenin/geo-host/pkg/style"
+	"github.com/stretchr/testify/suite"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMigrateSuite(t *testing.T) {
+	suite.Run(t, new(MigrateSuite))
+}
+
+// MigrateSuite runs migrations against fakeDB which keeps only records of geo_schema_migrations
+type MigrateSuite struct {
+	suite.Suite
+	db *fakeDB
+	p  *PostGISDataSource
+}
+
+func (s *MigrateSuite) SetupTest() {
+	s.db = &fakeDB{applied: make(map[string]string)}
+	s.p = &PostGISDataSource{
+		DB:     bun.NewDB(sql.OpenDB(s.db), pgdialect.New()),
+		logger: logging.NewTextLogger(ioutil.Discard, logging.LevelError),
+		layers: make(map[string]*Layer),
+	}
+	for _, name := range []string{geo.DefaultLayer, "shops"} {
+		layer, err := NewLayer(name, style.NewMapper[*Cluster](style.MustNewStyle(style.DefaultLayerConfig)))
+		s.Require().Nil(err)
+		s.p.layers[name] = layer
+	}
+}
+
+func (s *MigrateSuite) TestMigrate() {
+	err := s.p.CheckSchema(context.Background())
+	s.ErrorIs(err, ErrSchemaNotMigrated)
+	s.Contains(err.Error(), fmt.Sprintf("%d migrations are pending", len(postgisMigrations)+2*len(layerMigrations)))
+
+	s.Require().Nil(s.p.Migrate(context.Background()))
+	s.Len(s.db.applied, len(postgisMigrations)+2*len(layerMigrations))
+	s.Equal("create_postgis_extension", s.db.applied["postgis:1"])
+	s.Equal("create_properties_index", s.db.applied["geo_objects_shops:5"])
+	s.Nil(s.p.CheckSchema(context.Background()))
+	ddl := s.db.take()
+	s.Contains(ddl, `CREATE INDEX IF NOT EXISTS "geo_objects_shops_point_st_gist" ON "geo_objects_shops" USING SPGIST ("point")`)
+	// every migration is applied in its own transaction under lock
+	s.Equal(len(s.db.applied), strings.Count(ddl, "pg_advisory_xact_lock"))
+	s.Equal(len(s.db.applied), strings.Count(ddl, "COMMIT"))
+
+	// applied migrations are skipped
+	s.Require().Nil(s.p.Migrate(context.Background()))
+	s.NotContains(s.db.take(), "CREATE INDEX")
+}
+
+func (s *MigrateSuite) TestMigrateError() {
+	s.db.failOn = "geo_objects_shops_quad_key_btree"
+	err := s.p.Migrate(context.Background())
+	s.ErrorIs(err, errFakeQuery)
+	s.Contains(err.Error(), "migration geo_objects_shops 3 create_quad_key_index")
+	s.Contains(s.db.take(), "ROLLBACK")
+	s.Equal("create_point_index", s.db.applied["geo_objects_shops:2"])
+	s.NotContains(s.db.applied, "geo_objects_shops:3")
+	s.ErrorIs(s.p.CheckSchema(context.Background()), ErrSchemaNotMigrated)
+}
+
+func (s *MigrateSuite) TestRollback() {
+	s.Require().Nil(s.p.Migrate(context.Background()))
+	s.db.take()
+	s.Require().Nil(s.p.Rollback(context.Background(), "geo_objects_shops", 2))
+	ddl := s.db.take()
+	// newest migration is reverted first
+	s.Regexp(`DROP INDEX IF EXISTS "geo_objects_shops_properties_gin"(?s:.*)DROP INDEX IF EXISTS "geo_objects_shops_geog_gist"(?s:.*)DROP INDEX IF EXISTS "geo_objects_shops_quad_key_btree"`, ddl)
+	s.NotContains(ddl, "geo_objects_shops_point_st_gist")
+	s.NotContains(ddl, `"properties_gin"`)
+	s.Contains(s.db.applied, "geo_objects_shops:2")
+	s.NotContains(s.db.applied, "geo_objects_shops:3")
+	s.Contains(s.db.applied, "geo_objects:5")
+	s.ErrorIs(s.p.CheckSchema(context.Background()), ErrSchemaNotMigrated)
+
+	// migrations which are not applied are not reverted
+	s.Require().Nil(s.p.Rollback(context.Background(), "geo_objects_shops", 0))
+	s.NotContains(s.db.take(), "geo_objects_shops_quad_key_btree")
+	s.NotContains(s.db.applied, "geo_objects_shops:1")
+
+	s.Error(s.p.Rollback(context.Background(), "unknown", 0))
+}
+
+var errFakeQuery = errors.New("fake query failed")
+
+var (
+	insertMigrationRegexp = regexp.MustCompile(`^INSERT INTO "geo_schema_migrations" .* VALUES \('([^']*)', (\d+), '([^']*)'`)
+	deleteMigrationRegexp = regexp.MustCompile(`^DELETE FROM "geo_schema_migrations" .*scope = '([^']*)'\) AND \(version = (\d+)\)`)
+	existsMigrationRegexp = regexp.MustCompile(`^SELECT EXISTS \(SELECT .* FROM "geo_schema_migrations" .*scope = '([^']*)'\) AND \(version = (\d+)\)`)
+)
+
+// fakeDB is database/sql connector which records queries and emulates geo_schema_migrations table
+type fakeDB struct {
+	mu      sync.Mutex
+	queries []string
+	// created is set by creation of geo_schema_migrations
+	created bool
+	applied map[string]string
+	// failOn fails queries containing it
+	failOn string
+	// rows returns rows of other queries, nil means empty result
+	rows func(query string) *fakeRows
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{db: db}, nil
+}
+
+func (db *fakeDB) Driver() driver.Driver {
+	return nil
+}
+
+// take returns recorded queries and forgets them
+func (db *fakeDB) take() string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	queries := strings.Join(db.queries, "\n")
+	db.queries = nil
+	return queries
+}
+
+func (db *fakeDB) record(query string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.queries = append(db.queries, query)
+	if db.failOn != "" && strings.Contains(query, db.failOn) {
+		return errFakeQuery
+	}
+	return nil
+}
+
+// run emulates query, it returns rows of query and number of affected rows
+func (db *fakeDB) run(query string) (*fakeRows, int64, error) {
+	err := db.record(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if strings.HasPrefix(query, `CREATE TABLE IF NOT EXISTS "geo_schema_migrations"`) {
+		db.created = true
+	}
+	if m := insertMigrationRegexp.FindStringSubmatch(query); m != nil {
+		db.applied[m[1]+":"+m[2]] = m[3]
+		return &fakeRows{columns: []string{"applied_at"}, values: [][]driver.Value{{time.Now()}}}, 1, nil
+	}
+	if m := deleteMigrationRegexp.FindStringSubmatch(query); m != nil {
+		if _, ok := db.applied[m[1]+":"+m[2]]; !ok {
+			return &fakeRows{}, 0, nil
+		}
+		delete(db.applied, m[1]+":"+m[2])
+		return &fakeRows{}, 1, nil
+	}
+	if m := existsMigrationRegexp.FindStringSubmatch(query); m != nil {
+		_, ok := db.applied[m[1]+":"+m[2]]
+		return &fakeRows{columns: []string{"exists"}, values: [][]driver.Value{{ok}}}, 0, nil
+	}
+	if strings.Contains(query, "to_regclass") {
+		return &fakeRows{columns: []string{"exists"}, values: [][]driver.Value{{db.created}}}, 0, nil
+	}
+	if strings.HasPrefix(query, `SELECT "schema_migration"."scope"`) {
+		rows := &fakeRows{columns: []string{"scope", "version", "name", "applied_at"}}
+		for key, name := range db.applied {
+			i := strings.LastIndex(key, ":")
+			version, _ := strconv.ParseInt(key[i+1:], 10, 64)
+			rows.values = append(rows.values, []driver.Value{key[:i], version, name, time.Now()})
+		}
+		return rows, 0, nil
+	}
+	if db.rows != nil {
+		if rows := db.rows(query); rows != nil {
+			return rows, 0, nil
+		}
+	}
+	return &fakeRows{}, 0, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{db: c.db}, c.db.record("BEGIN")
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	_, n, err := c.db.run(query)
+	return driver.RowsAffected(n), err
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, _, err := c.db.run(query)
+	return rows, err
+}
+
+type fakeTx struct {
+	db *fakeDB
+}
+
+func (tx fakeTx) Commit() error {
+	return tx.db.record("COMMIT")
+}
+
+func (tx fakeTx) Rollback() error {
+	return tx.db.record("ROLLBACK")
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
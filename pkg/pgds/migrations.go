@@ -0,0 +1,105 @@
+package pgds
+
+import (
+	"context"
+	"github.com/uptrace/bun"
+)
+
+// Migration changes schema of scope, layer is nil for migrations of postgisScope.
+// Applied migrations must never be changed, schema changes are made by new migrations.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(ctx context.Context, tx bun.Tx, layer *Layer) error
+	Down    func(ctx context.Context, tx bun.Tx, layer *Layer) error
+}
+
+// postgisScope is scope of migrations shared by all layers
+const postgisScope = "postgis"
+
+var postgisMigrations = []*Migration{
+	{
+		Version: 1,
+		Name:    "create_postgis_extension",
+		Up: func(ctx context.Context, tx bun.Tx, _ *Layer) error {
+			_, err := tx.ExecContext(ctx, "CREATE EXTENSION IF NOT EXISTS postgis")
+			return err
+		},
+		// extension may be used by other schemas, so it is kept
+		Down: func(ctx context.Context, tx bun.Tx, _ *Layer) error {
+			return nil
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create_quad_key_configs_table",
+		Up: func(ctx context.Context, tx bun.Tx, _ *Layer) error {
+			_, err := tx.NewCreateTable().Model((*QuadKeyConfig)(nil)).IfNotExists().Exec(ctx)
+			return err
+		},
+		Down: func(ctx context.Context, tx bun.Tx, _ *Layer) error {
+			_, err := tx.NewDropTable().Model((*QuadKeyConfig)(nil)).IfExists().Exec(ctx)
+			return err
+		},
+	},
+}
+
+// layerMigrations are applied to table of every layer.
+// First migrations use IF NOT EXISTS to adopt tables created before migrations.
+var layerMigrations = []*Migration{
+	{
+		Version: 1,
+		Name:    "create_table",
+		Up: func(ctx context.Context, tx bun.Tx, l *Layer) error {
+			_, err := tx.NewCreateTable().Model(new(GeoObject)).ModelTableExpr("?", bun.Ident(l.Table)).IfNotExists().Exec(ctx)
+			return err
+		},
+		Down: func(ctx context.Context, tx bun.Tx, l *Layer) error {
+			_, err := tx.NewDropTable().TableExpr("?", bun.Ident(l.Table)).IfExists().Exec(ctx)
+			return err
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create_point_index",
+		Up: func(ctx context.Context, tx bun.Tx, l *Layer) error {
+			_, err := tx.NewCreateIndex().Model(new(GeoObject)).ModelTableExpr("?", bun.Ident(l.Table)).Index(l.indexName(pointIndex)).Column("point").Using("SPGIST").IfNotExists().Exec(ctx)
+			return err
+		},
+		Down: dropIndex(pointIndex),
+	},
+	{
+		Version: 3,
+		Name:    "create_quad_key_index",
+		Up: func(ctx context.Context, tx bun.Tx, l *Layer) error {
+			_, err := tx.NewCreateIndex().Model(new(GeoObject)).ModelTableExpr("?", bun.Ident(l.Table)).Index(l.indexName(quadKeyIndex)).Column("quad_key").IfNotExists().Exec(ctx)
+			return err
+		},
+		Down: dropIndex(quadKeyIndex),
+	},
+	{
+		Version: 4,
+		Name:    "create_geography_index",
+		Up: func(ctx context.Context, tx bun.Tx, l *Layer) error {
+			_, err := tx.NewCreateIndex().Model(new(GeoObject)).ModelTableExpr("?", bun.Ident(l.Table)).Index(l.indexName(geographyIndex)).ColumnExpr(geographyExpr).Using("GIST").IfNotExists().Exec(ctx)
+			return err
+		},
+		Down: dropIndex(geographyIndex),
+	},
+	{
+		Version: 5,
+		Name:    "create_properties_index",
+		Up: func(ctx context.Context, tx bun.Tx, l *Layer) error {
+			_, err := tx.NewCreateIndex().Model(new(GeoObject)).ModelTableExpr("?", bun.Ident(l.Table)).Index(l.indexName(propertiesIndex)).ColumnExpr("properties jsonb_path_ops").Using("GIN").IfNotExists().Exec(ctx)
+			return err
+		},
+		Down: dropIndex(propertiesIndex),
+	},
+}
+
+func dropIndex(name string) func(ctx context.Context, tx bun.Tx, l *Layer) error {
+	return func(ctx context.Context, tx bun.Tx, l *Layer) error {
+		_, err := tx.NewDropIndex().Index("?", bun.Ident(l.indexName(name))).IfExists().Exec(ctx)
+		return err
+	}
+}
@@ -0,0 +1,40 @@
+package pgds
+
+import (
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+const centroidExpr = "st_centroid(st_collect(point::geometry))"
+
+// columnCentroidDistance adds distance of object to centroid of its cluster which is used to find medoid
+func columnCentroidDistance(q *bun.SelectQuery, placement *geo.ClusterPlacement, clusterShift int64) *bun.SelectQuery {
+	if placement.PositionMethod() == geo.PositionMedoid {
+		q.ColumnExpr("ST_Distance(point::geometry, ST_Centroid(ST_Collect(point::geometry) OVER (PARTITION BY quad_key >> ?))) AS centroid_distance", clusterShift)
+	}
+	return q
+}
+
+// columnPlacement adds position of cluster and id of its representative member.
+// Tile center position does not depend on members, so it is computed by caller.
+func columnPlacement(q *bun.SelectQuery, placement *geo.ClusterPlacement) *bun.SelectQuery {
+	switch placement.PositionMethod() {
+	case geo.PositionWeighted:
+		weight := placement.WeightProperty()
+		w := schema.SafeQuery(numericExpr, []interface{}{weight, weight})
+		// point is stored in lat,lon order, so weighted point keeps it.
+		// Cluster without weights is placed at centroid.
+		q.ColumnExpr("COALESCE(ST_SetSRID(ST_MakePoint(SUM(lat * ?) / NULLIF(SUM(?), 0), SUM(lon * ?) / NULLIF(SUM(?), 0)), 4326), "+centroidExpr+") AS centroid", w, w, w, w)
+	case geo.PositionMedoid:
+		q.ColumnExpr("(array_agg(point::geometry ORDER BY centroid_distance, id))[1] AS centroid")
+	default:
+		q.ColumnExpr(centroidExpr + " AS centroid")
+	}
+	if priority := placement.PriorityProperty(); priority != "" {
+		q.ColumnExpr("(array_agg(id ORDER BY "+numericExpr+" DESC NULLS LAST, id))[1] AS representative_id", priority, priority)
+	} else {
+		q.ColumnExpr("MIN(id) AS representative_id")
+	}
+	return q
+}
@@ -5,10 +5,14 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/ai-zelenin/geo-host/pkg/logging"
+	"github.com/ai-zelenin/geo-host/pkg/style"
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dialect/pgdialect"
 	"github.com/uptrace/bun/driver/pgdriver"
-	"github.com/uptrace/bun/extra/bundebug"
+	"sort"
+	"sync"
+	"time"
 )
 
 type PropertiesMapper func(obj *Cluster) map[string]interface{}
@@ -24,179 +28,325 @@ type GeoObject struct {
 }
 
 type Cluster struct {
-	ID          int64                `bun:"tile_id"`
-	MinID       int64                `bun:"min_id"`
-	Count       int64                `bun:"count"`
-	ClusterData []*GeoObject         `bun:"cluster_data"`
-	Centroid    *geo.GeographicPoint `bun:"centroid"`
+	ID    int64 `bun:"tile_id"`
+	MinID int64 `bun:"min_id"`
+	// RepresentativeID is id of member whose data is loaded into GeoObject
+	RepresentativeID int64                `bun:"representative_id"`
+	Count            int64                `bun:"count"`
+	ClusterData      []*GeoObject         `bun:"cluster_data"`
+	Centroid         *geo.GeographicPoint `bun:"centroid"`
+	MinQuadKey       int64                `bun:"min_quad_key"`
+	MaxQuadKey       int64                `bun:"max_quad_key"`
+	MinLat           float64              `bun:"min_lat"`
+	MaxLat           float64              `bun:"max_lat"`
+	MinLon           float64              `bun:"min_lon"`
+	MaxLon           float64              `bun:"max_lon"`
+	// Aggregates are numeric aggregations, after load they are merged with TopValues
+	Aggregates map[string]interface{} `bun:"aggregates"`
+	TopValues  map[string]interface{} `bun:"top_values"`
 	GeoObject
 }
 
+// StyleObject is cluster as seen by style templates
+func (c *Cluster) StyleObject() *style.Object {
+	obj := &style.Object{ID: c.ID, Count: c.Count, Properties: c.Properties, Aggregates: c.Aggregates}
+	for _, member := range c.ClusterData {
+		obj.AddMember(member.ID, member.Properties)
+	}
+	return obj
+}
+
+// BBox returns bounds of cluster members
+func (c *Cluster) BBox() geo.BBox {
+	return geo.BBox{
+		XMin: c.MinLat,
+		XMax: c.MaxLat,
+		YMin: c.MinLon,
+		YMax: c.MaxLon,
+	}
+}
+
+type NearbyObject struct {
+	Distance float64 `bun:"distance"`
+	GeoObject
+}
+
+// point column keeps coordinates in lat,lon order expected by Yandex maps,
+// so geodesic search uses geography built from lat and lon columns
+const geographyExpr = "(ST_SetSRID(ST_MakePoint(lon, lat), 4326)::geography)"
+
 type PostGISDataSource struct {
-	gs     *geo.GeographicSystem
-	DB     *bun.DB
-	mapper PropertiesMapper
+	gs          *geo.GeographicSystem
+	DB          *bun.DB
+	engine      *engine
+	loader      geo.TileLoader
+	logger      logging.Logger
+	metrics     *dataSourceMetrics
+	autoMigrate bool
+	mu          sync.RWMutex
+	layers      map[string]*Layer
 }
 
-func NewPostGISDataSource(ctx context.Context, dsn string, gs *geo.GeographicSystem, mapper PropertiesMapper) (*PostGISDataSource, error) {
+// Options of PostGISDataSource
+type Options struct {
+	Logger   logging.Logger
+	QueryLog QueryLogConfig
+	// AutoMigrate applies pending migrations of layers when they are registered,
+	// otherwise schema is changed only by Migrate
+	AutoMigrate bool
+	// TileChunkSize splits tiles of map request into chunks loaded by separate queries,
+	// 0 loads all tiles by one query
+	TileChunkSize int
+	// LoadWorkers limits number of chunks loaded concurrently
+	LoadWorkers int
+}
+
+func NewPostGISDataSource(ctx context.Context, dsn string, gs *geo.GeographicSystem, mapper PropertiesMapper, opts Options) (*PostGISDataSource, error) {
+	if opts.Logger == nil {
+		opts.Logger = logging.Nop()
+	}
 	sqldb := sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn)))
 	db := bun.NewDB(sqldb, pgdialect.New())
-	_, err := db.NewCreateTable().Model(new(GeoObject)).Table("geo_objects").IfNotExists().Exec(ctx)
-	if err != nil {
-		return nil, err
+	db.AddQueryHook(logQueryHook{logger: opts.Logger, cfg: opts.QueryLog})
+	db.AddQueryHook(debugQueryHook{})
+	p := &PostGISDataSource{
+		gs:          gs,
+		DB:          db,
+		engine:      newEngine(gs),
+		loader:      geo.TileLoader{ChunkSize: opts.TileChunkSize, Workers: opts.LoadWorkers},
+		logger:      opts.Logger,
+		autoMigrate: opts.AutoMigrate,
+		layers:      make(map[string]*Layer),
 	}
-	_, err = db.NewCreateIndex().Model(new(GeoObject)).Index("point_st_gist").Column("point").Using("SPGIST").IfNotExists().Exec(ctx)
+	if p.autoMigrate {
+		err := p.createMigrationsTable(ctx)
+		if err != nil {
+			return nil, err
+		}
+		err = p.migrateScope(ctx, &migrationScope{name: postgisScope, migrations: postgisMigrations})
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err := p.RegisterLayer(ctx, geo.DefaultLayer, mapper)
 	if err != nil {
 		return nil, err
 	}
-	_, err = db.NewCreateIndex().Model(new(GeoObject)).Index("quad_key_btree").Column("quad_key").IfNotExists().Exec(ctx)
+	return p, nil
+}
+
+// Close closes database connections, it must be called after server shutdown
+func (p *PostGISDataSource) Close() error {
+	return p.DB.Close()
+}
+
+// RegisterLayer makes layer available for requests, its table is migrated if AutoMigrate is set
+func (p *PostGISDataSource) RegisterLayer(ctx context.Context, name string, mapper PropertiesMapper) (*Layer, error) {
+	layer, err := NewLayer(name, mapper)
 	if err != nil {
 		return nil, err
 	}
-	db.AddQueryHook(bundebug.NewQueryHook(bundebug.WithVerbose(true)))
-	return &PostGISDataSource{
-		gs:     gs,
-		DB:     db,
-		mapper: mapper,
-	}, nil
+	if p.autoMigrate {
+		err = p.migrateScope(ctx, layerMigrationScope(layer))
+		if err != nil {
+			return nil, err
+		}
+	}
+	p.mu.Lock()
+	p.layers[name] = layer
+	p.mu.Unlock()
+	return layer, nil
+}
+
+func (p *PostGISDataSource) Layer(name string) (*Layer, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	layer, ok := p.layers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", geo.ErrUnknownLayer, name)
+	}
+	return layer, nil
+}
+
+// LayerNames returns sorted names of registered layers
+func (p *PostGISDataSource) LayerNames() []string {
+	p.mu.RLock()
+	names := make([]string, 0, len(p.layers))
+	for name := range p.layers {
+		names = append(names, name)
+	}
+	p.mu.RUnlock()
+	sort.Strings(names)
+	return names
 }
 
 func (p *PostGISDataSource) LoadMapView(ctx context.Context, mr *geo.MapRequest, fc *geo.FeatureCollection) error {
+	for _, name := range mr.LayerNames() {
+		layer, err := p.Layer(name)
+		if err != nil {
+			return err
+		}
+		err = p.loadLayerMapView(ctx, layer, mr, fc)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *PostGISDataSource) loadLayerMapView(ctx context.Context, layer *Layer, mr *geo.MapRequest, fc *geo.FeatureCollection) error {
 	tiles := p.gs.MRToTiles(mr)
 	tileIDs := make([]int64, 0, len(tiles))
 	for id := range tiles {
 		tileIDs = append(tileIDs, id)
 	}
-	bitDelta := p.gs.QuadKeySystem.BitDelta(mr.Zoom)
-	clusterShift := p.gs.QuadKeySystem.BitDelta(mr.Zoom + mr.ClusterDepth)
-	objects := make([]*Cluster, 0, mr.TilesNumber()*(mr.ClusterDepth*4))
-	subq := p.DB.NewSelect().Model((*GeoObject)(nil))
-	subq.ColumnExpr("COUNT(id) AS count")
-	subq.ColumnExpr("MIN(id) AS min_id")
-	subq.ColumnExpr("st_centroid(st_collect(point::geometry)) as centroid")
-	subq.ColumnExpr("quad_key >> ? as tile_id", clusterShift)
-	subq.Where("quad_key >> ? in (?)", bitDelta, bun.In(tileIDs))
-	subq.Order("tile_id")
-	subq.Group("tile_id")
-	q := p.DB.NewSelect()
-	q.TableExpr("(?) AS cluster", subq)
-	q.Join("left join geo_objects gp on gp.id = cluster.min_id")
-	err := q.Scan(ctx, &objects)
-	if err != nil && err != sql.ErrNoRows {
-		return err
+	if !mr.Adaptive {
+		return p.loader.Load(ctx, tileIDs, fc, func(ctx context.Context, tileIDs []int64, fc *geo.FeatureCollection) error {
+			return p.loadTilesMapView(ctx, layer, mr, tileIDs, fc)
+		})
 	}
-
-	for _, object := range objects {
-		// todo here we can put object into cache
-		if object.Count > 1 {
-
-			err = fc.Add(object.ID, object.Centroid, p.mapper(object))
-			if err != nil {
-				return err
-			}
-		} else {
-			point := &geo.GeographicPoint{
-				Latitude:  object.Lat,
-				Longitude: object.Lon,
-			}
-			err = fc.Add(object.ID, point, p.mapper(object))
-			if err != nil {
-				return err
-			}
-		}
+	depths, err := p.adaptiveDepths(ctx, layer, mr, tileIDs)
+	if err != nil {
+		return err
 	}
-	return nil
+	return mr.LoadByDepth(tileIDs, depths, func(dmr *geo.MapRequest, tileIDs []int64) error {
+		return p.loader.Load(ctx, tileIDs, fc, func(ctx context.Context, tileIDs []int64, fc *geo.FeatureCollection) error {
+			return p.loadTilesMapView(ctx, layer, dmr, tileIDs, fc)
+		})
+	})
 }
 
-func (p *PostGISDataSource) StoreGeoData(ctx context.Context, d interface{}) error {
-	gObj, ok := d.(*GeoObject)
-	if !ok {
-		return fmt.Errorf("unexpected data type %T", d)
+func (p *PostGISDataSource) loadTilesMapView(ctx context.Context, layer *Layer, mr *geo.MapRequest, tileIDs []int64, fc *geo.FeatureCollection) error {
+	var objects []*Cluster
+	var err error
+	start := time.Now()
+	pyramid := usePyramid(layer, mr)
+	p.metrics.addCacheLoad(layer, pyramid)
+	if pyramid {
+		objects, err = p.loadPyramidClusters(ctx, layer, mr, tileIDs)
+	} else {
+		objects, err = p.loadClusters(ctx, layer, mr, tileIDs)
 	}
-	qk := p.gs.CoordinatesToQuadKey(gObj.Lat, gObj.Lon)
-	gObj.QuadKey = qk.Int64()
-	_, err := p.DB.NewInsert().Model(d).On("CONFLICT (id) DO UPDATE").Exec(ctx)
 	if err != nil {
 		return err
 	}
-	return nil
+	mr.DebugInfo.AddLoad(tileIDs, time.Since(start))
+	clusters, err := p.engine.addFeatures(layer, mr, objects, fc)
+	p.metrics.addClusters(layer.Name, clusters)
+	return err
 }
 
-func LoadMapView(ctx context.Context, db bun.DB, mr *geo.MapRequest, fc *geo.FeatureCollection) error {
-	gs := geo.NewGeographicSystem(geo.DefaultGeoSystemConfig)
-	tiles := gs.MRToTiles(mr)
-	tileIDs := make([]int64, 0, len(tiles))
-	for id := range tiles {
-		tileIDs = append(tileIDs, id)
+// loadClusters groups objects of request tiles into clusters on the fly
+func (p *PostGISDataSource) loadClusters(ctx context.Context, layer *Layer, mr *geo.MapRequest, tileIDs []int64) ([]*Cluster, error) {
+	objects := make([]*Cluster, 0, int64(len(tileIDs))*(mr.ClusterDepth*4))
+	q, err := p.engine.clustersQuery(p.DB, layer, mr, tileIDs)
+	if err != nil {
+		return nil, err
 	}
-	bitDelta := gs.QuadKeySystem.BitDelta(mr.Zoom)
-	clusterShift := gs.QuadKeySystem.BitDelta(mr.Zoom + mr.ClusterDepth)
-	objects := make([]*Cluster, 0, mr.TilesNumber()*(mr.ClusterDepth*4))
-	subq := db.NewSelect().Model((*GeoObject)(nil))
-	subq.ColumnExpr("COUNT(id) AS count")
-	subq.ColumnExpr("MIN(id) AS min_id")
-	subq.ColumnExpr("st_centroid(st_collect(point::geometry)) as centroid")
-	subq.ColumnExpr("quad_key >> ? as tile_id", clusterShift)
-	subq.Where("quad_key >> ? in (?)", bitDelta, bun.In(tileIDs))
-	subq.Order("tile_id")
-	subq.Group("tile_id")
-	q := db.NewSelect()
-	q.TableExpr("(?) AS cluster", subq)
-	q.Join("left join geo_objects gp on gp.id = cluster.min_id")
-	err := q.Scan(ctx, &objects)
+	err = q.Scan(ctx, &objects)
 	if err != nil && err != sql.ErrNoRows {
-		return err
+		return nil, err
 	}
+	return objects, nil
+}
 
-	var mapper PropertiesMapper = func(obj *Cluster) map[string]interface{} {
-		var iconContent string
-		var balloonContent string
-		if obj.Count > 1 {
-			iconContent = fmt.Sprintf("%d", obj.Count)
-			for _, child := range obj.ClusterData {
-				balloonContent += fmt.Sprintf("%s<br>\n", child.Properties["name"])
-			}
-		} else {
-			iconContent = obj.Properties["name"].(string)
+func (p *PostGISDataSource) LoadNearby(ctx context.Context, nr *geo.NearbyRequest, fc *geo.FeatureCollection) error {
+	layer, err := p.Layer(geo.DefaultLayer)
+	if err != nil {
+		return err
+	}
+	objects := make([]*NearbyObject, 0, nr.Limit)
+	err = p.engine.nearbyQuery(p.DB, layer, nr).Scan(ctx, &objects)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	for _, object := range objects {
+		props := layer.Mapper(&Cluster{
+			ID:        object.ID,
+			MinID:     object.ID,
+			Count:     1,
+			GeoObject: object.GeoObject,
+		})
+		if props == nil {
+			props = make(map[string]interface{})
+		}
+		props["distance"] = object.Distance
+		point := &geo.GeographicPoint{
+			Latitude:  object.Lat,
+			Longitude: object.Lon,
 		}
-		return map[string]interface{}{
-			"hintContent":    obj.ID,
-			"iconContent":    iconContent,
-			"balloonContent": balloonContent,
-			"options": map[string]interface{}{
-				"preset":    "islands#blackStretchyIcon",
-				"fillColor": fmt.Sprintf("rgba(27, 125, 27, 0.2)"),
-			},
+		err = fc.Add(object.ID, point, props)
+		if err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+func (p *PostGISDataSource) LoadClusterMembers(ctx context.Context, cr *geo.ClusterMembersRequest, fc *geo.FeatureCollection) (int64, error) {
+	layer, err := p.Layer(cr.Layer)
+	if err != nil {
+		return 0, err
+	}
+	objects := make([]*GeoObject, 0, cr.Limit)
+	total, err := p.engine.clusterMembersQuery(p.DB, layer, cr, &objects).ScanAndCount(ctx)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
 	for _, object := range objects {
-		// todo here we can put object into cache
-		if object.Count > 1 {
-			err = fc.Add(object.ID, object.Centroid, mapper(object))
-			if err != nil {
-				return err
-			}
-		} else {
-			point := &geo.GeographicPoint{
-				Latitude:  object.Lat,
-				Longitude: object.Lon,
-			}
-			err = fc.Add(object.ID, point, mapper(object))
-			if err != nil {
-				return err
-			}
+		props := layer.Mapper(&Cluster{
+			ID:        object.ID,
+			MinID:     object.ID,
+			Count:     1,
+			GeoObject: *object,
+		})
+		point := &geo.GeographicPoint{
+			Latitude:  object.Lat,
+			Longitude: object.Lon,
+		}
+		err = fc.Add(geo.LayerFeatureID(layer.Name, object.ID), point, props)
+		if err != nil {
+			return 0, err
 		}
 	}
-	return nil
+	return int64(total), nil
+}
+
+func (p *PostGISDataSource) StoreGeoData(ctx context.Context, d interface{}) error {
+	return p.StoreLayerData(ctx, geo.DefaultLayer, d)
 }
 
-func StoreGeoData(ctx context.Context, db bun.DB, gObj *GeoObject) error {
-	gs := geo.NewGeographicSystem(geo.DefaultGeoSystemConfig)
-	qk := gs.CoordinatesToQuadKey(gObj.Lat, gObj.Lon)
-	gObj.QuadKey = qk.Int64()
-	_, err := db.NewInsert().Model(gObj).On("CONFLICT (id) DO UPDATE").Exec(ctx)
+func (p *PostGISDataSource) StoreLayerData(ctx context.Context, name string, d interface{}) error {
+	gObj, ok := d.(*GeoObject)
+	if !ok {
+		return fmt.Errorf("unexpected data type %T", d)
+	}
+	layer, err := p.Layer(name)
 	if err != nil {
 		return err
 	}
-	return nil
+	if !layer.Pyramid {
+		_, err = p.engine.upsertQuery(p.DB, layer, gObj).Exec(ctx)
+		return err
+	}
+	return p.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		upsert := p.engine.upsertQuery(tx, layer, gObj)
+		// tiles of previous position are updated too when object moves
+		quadKeys := []int64{gObj.QuadKey}
+		if gObj.ID != 0 {
+			var oldQuadKey int64
+			err := tx.NewSelect().TableExpr("? AS geo_object", bun.Ident(layer.Table)).Column("quad_key").Where("id = ?", gObj.ID).For("UPDATE").Scan(ctx, &oldQuadKey)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			if err == nil && oldQuadKey != gObj.QuadKey {
+				quadKeys = append(quadKeys, oldQuadKey)
+			}
+		}
+		_, err := upsert.Exec(ctx)
+		if err != nil {
+			return err
+		}
+		return p.updatePyramid(ctx, tx, layer, quadKeys...)
+	})
 }
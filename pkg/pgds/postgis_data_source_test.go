@@ -0,0 +1,32 @@
+package pgds
+
+import (
+	"context"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+func TestPostGISDataSourceSuite(t *testing.T) {
+	suite.Run(t, new(PostGISDataSourceSuite))
+}
+
+type PostGISDataSourceSuite struct {
+	suite.Suite
+}
+
+func (s *PostGISDataSourceSuite) TestNilLogger() {
+	gs := geo.NewGeographicSystem(geo.DefaultGeoSystemConfig)
+	p, err := NewPostGISDataSource(context.Background(), "postgres://geo@127.0.0.1:1/geo?sslmode=disable&dial_timeout=1s", gs, nil, Options{})
+	if !s.Nil(err) {
+		return
+	}
+	defer p.DB.Close()
+	s.NotNil(p.logger)
+	// failed query is logged by query hook
+	s.NotPanics(func() {
+		s.Error(p.DB.PingContext(context.Background()))
+		_, err = p.DB.NewSelect().ColumnExpr("1").Exec(context.Background())
+		s.Error(err)
+	})
+}
@@ -0,0 +1,212 @@
+package pgds
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/uptrace/bun"
+	"time"
+)
+
+// PyramidTile is precomputed cluster of all layer objects within tile of zoom.
+// Tiles of max zoom are built from objects, tiles of other zooms from four child tiles,
+// so every column keeps state which can be combined: sums instead of averages and so on.
+type PyramidTile struct {
+	bun.BaseModel          `bun:"table:geo_objects_pyramid"`
+	Zoom                   int64                  `bun:"zoom,pk"`
+	TileID                 int64                  `bun:"tile_id,pk"`
+	Count                  int64                  `bun:"count,notnull"`
+	LatSum                 float64                `bun:"lat_sum,notnull"`
+	LonSum                 float64                `bun:"lon_sum,notnull"`
+	WeightSum              *float64               `bun:"weight_sum"`
+	WeightedLatSum         *float64               `bun:"weighted_lat_sum"`
+	WeightedLonSum         *float64               `bun:"weighted_lon_sum"`
+	MinID                  int64                  `bun:"min_id,notnull"`
+	RepresentativeID       int64                  `bun:"representative_id,notnull"`
+	RepresentativePriority *float64               `bun:"representative_priority"`
+	MinQuadKey             int64                  `bun:"min_quad_key,notnull"`
+	MaxQuadKey             int64                  `bun:"max_quad_key,notnull"`
+	MinLat                 float64                `bun:"min_lat,notnull"`
+	MaxLat                 float64                `bun:"max_lat,notnull"`
+	MinLon                 float64                `bun:"min_lon,notnull"`
+	MaxLon                 float64                `bun:"max_lon,notnull"`
+	ClusterData            []*GeoObject           `bun:"cluster_data,type:jsonb"`
+	Aggregates             map[string]interface{} `bun:"aggregates,type:jsonb"`
+	// MaxID and QuadKeySum tell whether pyramid matches objects, see pyramidFreshQuery
+	MaxID int64 `bun:"max_id,notnull"`
+	// QuadKeySum is numeric, sum of quad keys does not fit into bigint
+	QuadKeySum string `bun:"quad_key_sum,type:numeric,notnull"`
+}
+
+const pyramidColumns = "zoom, tile_id, count, lat_sum, lon_sum, weight_sum, weighted_lat_sum, weighted_lon_sum, " +
+	"min_id, representative_id, representative_priority, min_quad_key, max_quad_key, " +
+	"min_lat, max_lat, min_lon, max_lon, cluster_data, aggregates, max_id, quad_key_sum"
+
+// PyramidTable is name of table of precomputed clusters of layer
+func (l *Layer) PyramidTable() string {
+	return l.Table + "_pyramid"
+}
+
+// pyramidSupported reports whether placement and aggregations of layer
+// can be combined from child tiles. Medoid and top values can not.
+func (l *Layer) pyramidSupported() error {
+	if l.Placement.PositionMethod() == geo.PositionMedoid {
+		return fmt.Errorf("layer %s: pyramid does not support %s position", l.Name, geo.PositionMedoid)
+	}
+	for _, agg := range l.Aggregations {
+		if agg.Func == geo.AggregateTop {
+			return fmt.Errorf("layer %s: pyramid does not support %s aggregation %s", l.Name, geo.AggregateTop, agg.Name)
+		}
+	}
+	return nil
+}
+
+// EnablePyramid makes LoadMapView of layer read precomputed clusters, like other layer settings
+// it must be called before serving requests. Pyramid is kept up to date by StoreLayerData only while it is enabled,
+// so pyramid is rebuilt if it does not exist yet or does not match objects of layer.
+func (p *PostGISDataSource) EnablePyramid(ctx context.Context, name string) error {
+	layer, err := p.Layer(name)
+	if err != nil {
+		return err
+	}
+	err = layer.pyramidSupported()
+	if err != nil {
+		return err
+	}
+	var exists, fresh bool
+	err = p.DB.NewSelect().ColumnExpr("to_regclass(?) IS NOT NULL", layer.PyramidTable()).Scan(ctx, &exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		err = p.engine.pyramidFreshQuery(p.DB, layer).Scan(ctx, &fresh)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			p.logger.Warn("pyramid does not match objects, rebuilding", "layer", name)
+		}
+	}
+	if !fresh {
+		err = p.BuildPyramid(ctx, name)
+		if err != nil {
+			return err
+		}
+	}
+	layer.Pyramid = true
+	return nil
+}
+
+// BuildPyramid rebuilds all zoom levels of layer pyramid from objects
+func (p *PostGISDataSource) BuildPyramid(ctx context.Context, name string) error {
+	layer, err := p.Layer(name)
+	if err != nil {
+		return err
+	}
+	err = layer.pyramidSupported()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = p.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := lockPyramid(ctx, tx, layer)
+		if err != nil {
+			return err
+		}
+		// pyramid is derived data, so its table is made here rather than by migrations
+		_, err = tx.NewCreateTable().Model((*PyramidTile)(nil)).ModelTableExpr("?", bun.Ident(layer.PyramidTable())).IfNotExists().Exec(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewDelete().TableExpr("?", bun.Ident(layer.PyramidTable())).Where("TRUE").Exec(ctx)
+		if err != nil {
+			return err
+		}
+		maxZoom := p.gs.QuadKeySystem.MaxZoom()
+		q, err := p.engine.objectsLevelQuery(tx, layer)
+		if err != nil {
+			return err
+		}
+		err = insertPyramid(ctx, tx, layer, q)
+		if err != nil {
+			return err
+		}
+		for zoom := maxZoom - 1; zoom >= p.gs.QuadKeySystem.MinZoom(); zoom-- {
+			q, err = p.engine.childrenLevelQuery(tx, layer, zoom)
+			if err != nil {
+				return err
+			}
+			err = insertPyramid(ctx, tx, layer, q)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	p.logger.Info("pyramid built", "layer", name, "duration", time.Since(start))
+	return nil
+}
+
+// updatePyramid recomputes tiles containing quad keys on every zoom from bottom to top
+func (p *PostGISDataSource) updatePyramid(ctx context.Context, tx bun.Tx, layer *Layer, quadKeys ...int64) error {
+	err := lockPyramid(ctx, tx, layer)
+	if err != nil {
+		return err
+	}
+	for zoom := p.gs.QuadKeySystem.MaxZoom(); zoom >= p.gs.QuadKeySystem.MinZoom(); zoom-- {
+		shift := p.gs.QuadKeySystem.BitDelta(zoom)
+		tiles := make(map[int64]bool, len(quadKeys))
+		for _, qk := range quadKeys {
+			tiles[qk>>shift] = true
+		}
+		for tileID := range tiles {
+			_, err = tx.NewDelete().TableExpr("?", bun.Ident(layer.PyramidTable())).Where("zoom = ?", zoom).Where("tile_id = ?", tileID).Exec(ctx)
+			if err != nil {
+				return err
+			}
+			q, err := p.engine.pyramidTileQuery(tx, layer, zoom, tileID)
+			if err != nil {
+				return err
+			}
+			err = insertPyramid(ctx, tx, layer, q)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lockPyramid serializes updates of layer pyramid till the end of transaction
+func lockPyramid(ctx context.Context, tx bun.Tx, layer *Layer) error {
+	_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext(?))", layer.PyramidTable())
+	return err
+}
+
+func insertPyramid(ctx context.Context, tx bun.Tx, layer *Layer, q *bun.SelectQuery) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO ? ("+pyramidColumns+") ?", bun.Ident(layer.PyramidTable()), q)
+	return err
+}
+
+// usePyramid reports whether request can be served from pyramid,
+// objects filtered by area or properties have to be clustered on the fly.
+func usePyramid(layer *Layer, mr *geo.MapRequest) bool {
+	return layer.Pyramid && mr.Within == nil && len(mr.Filter) == 0
+}
+
+// loadPyramidClusters reads clusters of request tiles from pyramid
+func (p *PostGISDataSource) loadPyramidClusters(ctx context.Context, layer *Layer, mr *geo.MapRequest, tileIDs []int64) ([]*Cluster, error) {
+	objects := make([]*Cluster, 0, int64(len(tileIDs))*(mr.ClusterDepth*4))
+	if len(tileIDs) == 0 {
+		return objects, nil
+	}
+	err := p.engine.pyramidClustersQuery(p.DB, layer, mr, tileIDs).Scan(ctx, &objects)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return objects, nil
+}
@@ -0,0 +1,147 @@
+package pgds
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/uptrace/bun"
+	"time"
+)
+
+// DefaultReindexBatch is number of objects updated by one statement of Reindex
+const DefaultReindexBatch = 1000
+
+// quadKeySample is number of objects whose quad keys are verified before config of layer is recorded
+const quadKeySample = 100
+
+// ErrQuadKeyConfigMismatch is returned when quad keys of layer were computed with other geographic system config
+var ErrQuadKeyConfigMismatch = errors.New("quad keys were computed with other geographic system config")
+
+// QuadKeyConfig is fingerprint of geographic system config used to compute quad keys of layer table
+type QuadKeyConfig struct {
+	bun.BaseModel `bun:"table:geo_quad_key_configs"`
+	Table         string    `bun:"table_name,pk"`
+	Fingerprint   string    `bun:"fingerprint,notnull"`
+	UpdatedAt     time.Time `bun:"updated_at,notnull,default:current_timestamp"`
+}
+
+// quadKeyRow is quad key of object updated by Reindex
+type quadKeyRow struct {
+	bun.BaseModel `bun:"table:geo_objects,alias:geo_object"`
+	ID            int64   `bun:"id,pk"`
+	QuadKey       int64   `bun:"quad_key"`
+	Lat           float64 `bun:"lat,scanonly"`
+	Lon           float64 `bun:"lon,scanonly"`
+}
+
+// CheckQuadKeys refuses layers whose quad keys were computed with other config.
+// Config of layer without fingerprint is recorded if quad keys of sample of objects match it,
+// so existing data is adopted on first check.
+func (p *PostGISDataSource) CheckQuadKeys(ctx context.Context) error {
+	fingerprint := p.gs.Config().Fingerprint()
+	for _, s := range p.migrationScopes() {
+		if s.layer == nil {
+			continue
+		}
+		cfg := new(QuadKeyConfig)
+		err := p.DB.NewSelect().Model(cfg).Where("table_name = ?", s.layer.Table).Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = p.verifyQuadKeys(ctx, s.layer)
+			if err != nil {
+				return err
+			}
+			err = p.setQuadKeyConfig(ctx, p.DB, s.layer)
+			if err != nil {
+				return err
+			}
+			p.logger.Info("quad key config recorded", "layer", s.layer.Name, "fingerprint", fingerprint)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if cfg.Fingerprint != fingerprint {
+			return fmt.Errorf("layer %s: %w: stored %s, current %s, run geo reindex", s.layer.Name, ErrQuadKeyConfigMismatch, cfg.Fingerprint, fingerprint)
+		}
+	}
+	return nil
+}
+
+// verifyQuadKeys recomputes quad keys of first objects of layer and fails if they differ from stored ones
+func (p *PostGISDataSource) verifyQuadKeys(ctx context.Context, layer *Layer) error {
+	rows := make([]*quadKeyRow, 0, quadKeySample)
+	err := p.DB.NewSelect().Model(&rows).ModelTableExpr("? AS geo_object", bun.Ident(layer.Table)).
+		Column("id", "quad_key", "lat", "lon").OrderExpr("id").Limit(quadKeySample).Scan(ctx)
+	if err != nil {
+		return err
+	}
+	stale := 0
+	for _, row := range rows {
+		if p.gs.CoordinatesToQuadKey(row.Lat, row.Lon).Int64() != row.QuadKey {
+			stale++
+		}
+	}
+	if stale > 0 {
+		return fmt.Errorf("layer %s: %w: %d of %d sampled objects have other quad keys, run geo reindex", layer.Name, ErrQuadKeyConfigMismatch, stale, len(rows))
+	}
+	return nil
+}
+
+func (p *PostGISDataSource) setQuadKeyConfig(ctx context.Context, db bun.IDB, layer *Layer) error {
+	cfg := &QuadKeyConfig{Table: layer.Table, Fingerprint: p.gs.Config().Fingerprint(), UpdatedAt: time.Now()}
+	_, err := db.NewInsert().Model(cfg).On("CONFLICT (table_name) DO UPDATE").
+		Set("fingerprint = EXCLUDED.fingerprint").Set("updated_at = EXCLUDED.updated_at").Exec(ctx)
+	return err
+}
+
+// Reindex recomputes quad keys of layer objects from their coordinates in batches ordered by id.
+// Fingerprint is updated after the last batch, so interrupted reindex is detected and can be restarted.
+// Pyramid of layer must be rebuilt afterwards.
+func (p *PostGISDataSource) Reindex(ctx context.Context, name string, batchSize int) error {
+	layer, err := p.Layer(name)
+	if err != nil {
+		return err
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultReindexBatch
+	}
+	start := time.Now()
+	var lastID, total int64
+	for {
+		rows := make([]*quadKeyRow, 0, batchSize)
+		err = p.DB.NewSelect().Model(&rows).ModelTableExpr("? AS geo_object", bun.Ident(layer.Table)).
+			Column("id", "quad_key", "lat", "lon").
+			Where("id > ?", lastID).OrderExpr("id").Limit(batchSize).Scan(ctx)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		lastID = rows[len(rows)-1].ID
+		changed := make([]*quadKeyRow, 0, len(rows))
+		for _, row := range rows {
+			qk := p.gs.CoordinatesToQuadKey(row.Lat, row.Lon).Int64()
+			if qk != row.QuadKey {
+				row.QuadKey = qk
+				changed = append(changed, row)
+			}
+		}
+		if len(changed) > 0 {
+			_, err = p.DB.NewUpdate().Model(&changed).ModelTableExpr("? AS geo_object", bun.Ident(layer.Table)).
+				Column("quad_key").Bulk().Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		total += int64(len(changed))
+		p.logger.Debug("reindex batch", "layer", name, "last_id", lastID, "changed", len(changed))
+	}
+	err = p.setQuadKeyConfig(ctx, p.DB, layer)
+	if err != nil {
+		return err
+	}
+	p.logger.Info("layer reindexed", "layer", name, "changed", total, "duration", time.Since(start))
+	return nil
+}
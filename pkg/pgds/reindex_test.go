@@ -0,0 +1,105 @@
+package pgds
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/ai-zelenin/geo-host/pkg/logging"
+	"github.com/ai-zelenin/geo-host/pkg/style"
+	"github.com/stretchr/testify/suite"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReindexSuite(t *testing.T) {
+	suite.Run(t, new(ReindexSuite))
+}
+
+// ReindexSuite checks quad key configs of layers stored in fakeDB
+type ReindexSuite struct {
+	suite.Suite
+	db *fakeDB
+	gs *geo.GeographicSystem
+	p  *PostGISDataSource
+	// fingerprints and objects of layer tables
+	fingerprints map[string]string
+	objects      map[string][][]driver.Value
+}
+
+var layerTableRegexp = regexp.MustCompile(`FROM "(geo_objects[a-z_]*)" AS geo_object ORDER BY id LIMIT`)
+
+func (s *ReindexSuite) SetupTest() {
+	s.gs = geo.NewGeographicSystem(geo.DefaultGeoSystemConfig)
+	s.fingerprints = make(map[string]string)
+	s.objects = make(map[string][][]driver.Value)
+	s.db = &fakeDB{applied: make(map[string]string), rows: func(query string) *fakeRows {
+		if strings.Contains(query, `FROM "geo_quad_key_configs"`) {
+			rows := &fakeRows{columns: []string{"table_name", "fingerprint", "updated_at"}}
+			for table, fingerprint := range s.fingerprints {
+				if strings.Contains(query, "'"+table+"'") {
+					rows.values = append(rows.values, []driver.Value{table, fingerprint, time.Now()})
+				}
+			}
+			return rows
+		}
+		if m := layerTableRegexp.FindStringSubmatch(query); m != nil {
+			return &fakeRows{columns: []string{"id", "quad_key", "lat", "lon"}, values: s.objects[m[1]]}
+		}
+		return nil
+	}}
+	s.p = &PostGISDataSource{
+		gs:     s.gs,
+		DB:     bun.NewDB(sql.OpenDB(s.db), pgdialect.New()),
+		logger: logging.NewTextLogger(ioutil.Discard, logging.LevelError),
+		layers: make(map[string]*Layer),
+	}
+	layer, err := NewLayer(geo.DefaultLayer, style.NewMapper[*Cluster](style.MustNewStyle(style.DefaultLayerConfig)))
+	s.Require().Nil(err)
+	s.p.layers[geo.DefaultLayer] = layer
+}
+
+// object is row of layer table, quad key is computed by current config if qk is 0
+func (s *ReindexSuite) object(id int64, lat, lon float64, qk int64) []driver.Value {
+	if qk == 0 {
+		qk = s.gs.CoordinatesToQuadKey(lat, lon).Int64()
+	}
+	return []driver.Value{id, qk, lat, lon}
+}
+
+func (s *ReindexSuite) TestAdoptMatching() {
+	s.objects[DefaultTable] = [][]driver.Value{s.object(1, 55.75, 37.61, 0), s.object(2, 59.93, 30.31, 0)}
+	s.Nil(s.p.CheckQuadKeys(context.Background()))
+	queries := s.db.take()
+	s.Contains(queries, `FROM "geo_objects" AS geo_object ORDER BY id LIMIT 100`)
+	s.Contains(queries, `INSERT INTO "geo_quad_key_configs"`)
+	s.Contains(queries, "'"+s.gs.Config().Fingerprint()+"'")
+}
+
+func (s *ReindexSuite) TestAdoptEmpty() {
+	s.Nil(s.p.CheckQuadKeys(context.Background()))
+	s.Contains(s.db.take(), `INSERT INTO "geo_quad_key_configs"`)
+}
+
+func (s *ReindexSuite) TestRefuseStale() {
+	s.objects[DefaultTable] = [][]driver.Value{s.object(1, 55.75, 37.61, 0), s.object(2, 59.93, 30.31, 12345)}
+	err := s.p.CheckQuadKeys(context.Background())
+	s.ErrorIs(err, ErrQuadKeyConfigMismatch)
+	s.Contains(err.Error(), "1 of 2 sampled objects")
+	s.NotContains(s.db.take(), "INSERT")
+}
+
+func (s *ReindexSuite) TestFingerprint() {
+	s.fingerprints[DefaultTable] = s.gs.Config().Fingerprint()
+	s.Nil(s.p.CheckQuadKeys(context.Background()))
+	// recorded config is trusted without sampling objects
+	s.NotContains(s.db.take(), "LIMIT 100")
+
+	s.fingerprints[DefaultTable] = "other"
+	s.ErrorIs(s.p.CheckQuadKeys(context.Background()), ErrQuadKeyConfigMismatch)
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const ClusterMembersPrefix = "/api/v1/clusters/"
+
+// ClusterMembersHandler serves /api/v1/clusters/{tileQuadKey}/members
+type ClusterMembersHandler struct {
+	gs *geo.GeographicSystem
+	ds geo.DataSource
+}
+
+func NewClusterMembersHandler(gs *geo.GeographicSystem, ds geo.DataSource) *ClusterMembersHandler {
+	return &ClusterMembersHandler{gs: gs, ds: ds}
+}
+
+func (c *ClusterMembersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, ClusterMembersPrefix), "/")
+	if len(parts) != 2 || parts[1] != "members" {
+		http.NotFound(w, r)
+		return
+	}
+	cr, err := geo.ParseClusterMembersRequest(
+		parts[0],
+		r.URL.Query().Get("zoom"),
+		r.URL.Query().Get("offset"),
+		r.URL.Query().Get("limit"),
+		r.URL.Query().Get("layer"),
+		r.URL.Query().Get("callback"),
+		r.URL.Query().Get("within"),
+		r.URL.Query().Get("filter"),
+	)
+	if err == nil {
+		err = c.gs.ValidateClusterMembersRequest(cr)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	fc := geo.NewFeatureCollection()
+	total, err := c.ds.LoadClusterMembers(r.Context(), cr, fc)
+	if err != nil {
+		writeDataSourceError(w, err)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	writeFeatureCollection(w, fc, cr.CallbackID)
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/ai-zelenin/geo-host/pkg/memds"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClusterMembersHandlerSuite(t *testing.T) {
+	suite.Run(t, new(ClusterMembersHandlerSuite))
+}
+
+type ClusterMembersHandlerSuite struct {
+	suite.Suite
+	gs *geo.GeographicSystem
+	ds *memds.MemoryDataSource
+}
+
+func (s *ClusterMembersHandlerSuite) SetupTest() {
+	s.gs = geo.NewGeographicSystem(geo.DefaultGeoSystemConfig)
+	s.ds = newMetroDataSource(s.T(), s.gs)
+}
+
+func (s *ClusterMembersHandlerSuite) serve(url string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	NewClusterMembersHandler(s.gs, s.ds).ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	return w
+}
+
+func (s *ClusterMembersHandlerSuite) TestMembers() {
+	w := s.serve(ClusterMembersPrefix + "0/members?zoom=0&limit=5")
+	s.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	s.NotEqual("0", w.Header().Get("X-Total-Count"))
+}
+
+func (s *ClusterMembersHandlerSuite) TestBadRequest() {
+	for _, path := range []string{
+		// tile does not exist at zoom
+		"131071/members?zoom=0",
+		"4/members?zoom=1",
+		"-1/members?zoom=2",
+		// quad keys of zoom do not fit int64
+		"0/members?zoom=32",
+		// zoom is above max zoom of geographic system
+		"0/members?zoom=24",
+		"0/members?zoom=-1",
+		"x/members?zoom=1",
+	} {
+		w := s.serve(ClusterMembersPrefix + path)
+		s.Equal(http.StatusBadRequest, w.Code, path)
+	}
+	s.Equal(http.StatusOK, s.serve(ClusterMembersPrefix+"3/members?zoom=1").Code)
+}
@@ -1,6 +1,41 @@
 package server
 
+import (
+	"time"
+)
+
 type Config struct {
 	ServerAddr string `json:"server_addr" yaml:"server_addr"`
 	StaticDir  string `json:"static_dir" yaml:"static_dir"`
+	// Debug allows debug overlay requested with debug parameter, must be off in production
+	Debug bool `json:"debug" yaml:"debug"`
+	// ReadTimeout limits reading of request including headers, zero means no limit
+	ReadTimeout  time.Duration `json:"read_timeout" yaml:"read_timeout"`
+	WriteTimeout time.Duration `json:"write_timeout" yaml:"write_timeout"`
+	IdleTimeout  time.Duration `json:"idle_timeout" yaml:"idle_timeout"`
+	// DrainPeriod is time between failing readiness probe and closing listener on shutdown,
+	// it lets load balancer stop sending requests
+	DrainPeriod time.Duration `json:"drain_period" yaml:"drain_period"`
+	// ShutdownTimeout limits shutdown including drain period and waiting for in-flight requests
+	ShutdownTimeout time.Duration `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+	// MaxTiles limits tiles of map request, zero means no limit
+	MaxTiles int64 `json:"max_tiles" yaml:"max_tiles"`
+	// RateLimit is requests per second allowed to every client by API handlers, zero disables limiting
+	RateLimit float64 `json:"rate_limit" yaml:"rate_limit"`
+	RateBurst int     `json:"rate_burst" yaml:"rate_burst"`
+	// ClientIPHeader identifies clients of rate limiter behind proxy, e.g. X-Forwarded-For whose rightmost
+	// entry is set by the proxy, empty means remote address of connection
+	ClientIPHeader string `json:"client_ip_header" yaml:"client_ip_header"`
+}
+
+var DefaultConfig = Config{
+	ServerAddr:      ":8080",
+	StaticDir:       "./front",
+	ReadTimeout:     10 * time.Second,
+	WriteTimeout:    30 * time.Second,
+	IdleTimeout:     2 * time.Minute,
+	DrainPeriod:     5 * time.Second,
+	ShutdownTimeout: 30 * time.Second,
+	MaxTiles:        256,
+	RateBurst:       20,
 }
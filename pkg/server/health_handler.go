@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// readyCheckTimeout limits health check of data source
+const readyCheckTimeout = 5 * time.Second
+
+// HealthHandler serves /healthz which only reports that process is alive
+type HealthHandler struct{}
+
+func (HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, nil)
+}
+
+// ReadyHandler serves /readyz which reports whether server can serve map requests
+type ReadyHandler struct {
+	ds geo.DataSource
+	// shuttingDown is set to 1 by server shutdown to stop traffic before connections are closed
+	shuttingDown *int32
+}
+
+func NewReadyHandler(ds geo.DataSource, shuttingDown *int32) *ReadyHandler {
+	return &ReadyHandler{ds: ds, shuttingDown: shuttingDown}
+}
+
+func (h *ReadyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(h.shuttingDown) != 0 {
+		writeProbe(w, errShuttingDown)
+		return
+	}
+	checker, ok := h.ds.(geo.HealthChecker)
+	if !ok {
+		writeProbe(w, nil)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+	defer cancel()
+	writeProbe(w, checker.CheckHealth(ctx))
+}
+
+var errShuttingDown = errors.New("server is shutting down")
+
+func writeProbe(w http.ResponseWriter, err error) {
+	w.Header().Set("Cache-Control", "no-store")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok\n"))
+}
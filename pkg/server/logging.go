@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"github.com/ai-zelenin/geo-host/pkg/logging"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// statusRecorder remembers status and size of response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(data []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(data)
+	s.size += n
+	return n, err
+}
+
+// requestLogFields are fields added to request log line by handlers
+type requestLogFields struct {
+	mu   sync.Mutex
+	args []interface{}
+}
+
+type requestLogFieldsKey struct{}
+
+// addLogFields adds key value pairs to log line of request, it does nothing outside LogRequests
+func addLogFields(ctx context.Context, args ...interface{}) {
+	fields, ok := ctx.Value(requestLogFieldsKey{}).(*requestLogFields)
+	if !ok {
+		return
+	}
+	fields.mu.Lock()
+	defer fields.mu.Unlock()
+	fields.args = append(fields.args, args...)
+}
+
+// LogRequests writes line with latency and status of every request.
+// Server errors are logged as errors, client errors as warnings.
+func LogRequests(logger logging.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		fields := &requestLogFields{}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestLogFieldsKey{}, fields)))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		level := logging.LevelInfo
+		switch {
+		case rec.status >= 500:
+			level = logging.LevelError
+		case rec.status >= 400:
+			level = logging.LevelWarn
+		}
+		if !logger.Enabled(level) {
+			return
+		}
+		args := []interface{}{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"size", rec.size,
+			"latency", time.Since(start),
+		}
+		fields.mu.Lock()
+		args = append(args, fields.args...)
+		fields.mu.Unlock()
+		logger.Log(level, "request", args...)
+	})
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"bytes"
+	"github.com/ai-zelenin/geo-host/pkg/logging"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogRequestsSuite(t *testing.T) {
+	suite.Run(t, new(LogRequestsSuite))
+}
+
+type LogRequestsSuite struct {
+	suite.Suite
+}
+
+func (s *LogRequestsSuite) TestLevels() {
+	cases := []struct {
+		status int
+		level  string
+	}{
+		{http.StatusOK, "level=INFO"},
+		{http.StatusBadRequest, "level=WARN"},
+		{http.StatusInternalServerError, "level=ERROR"},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		h := LogRequests(logging.NewTextLogger(&buf, logging.LevelInfo), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addLogFields(r.Context(), "zoom", 9)
+			w.WriteHeader(c.status)
+			_, _ = w.Write([]byte("body"))
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/yandex?zoom=9", nil))
+		line := buf.String()
+		s.True(strings.HasPrefix(strings.SplitN(line, " ", 2)[1], c.level), line)
+		s.Contains(line, "msg=request method=GET path=/api/v1/yandex status=")
+		s.Contains(line, " size=4 ")
+		s.Contains(line, " zoom=9")
+	}
+}
+
+func (s *LogRequestsSuite) TestDisabledLevel() {
+	var buf bytes.Buffer
+	h := LogRequests(logging.NewTextLogger(&buf, logging.LevelWarn), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	s.Empty(buf.String())
+	// fields added outside of LogRequests are ignored
+	addLogFields(httptest.NewRequest(http.MethodGet, "/", nil).Context(), "zoom", 1)
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"github.com/ai-zelenin/geo-host/pkg/metrics"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var tilesBuckets = []float64{1, 2, 4, 8, 16, 32, 64, 128, 256}
+
+// serverMetrics are metrics of handlers, methods do nothing on nil serverMetrics
+type serverMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+	tiles    *metrics.HistogramVec
+	features *metrics.HistogramVec
+	maxZoom  int64
+}
+
+func newServerMetrics(reg *metrics.Registry, maxZoom int64) *serverMetrics {
+	return &serverMetrics{
+		requests: reg.NewCounterVec("geo_http_requests_total", "HTTP requests by handler and status code.", "handler", "code"),
+		duration: reg.NewHistogramVec("geo_http_request_duration_seconds", "Latency of HTTP requests by handler and zoom.", metrics.DefaultBuckets, "handler", "zoom"),
+		tiles:    reg.NewHistogramVec("geo_map_request_tiles", "Tiles per map request.", tilesBuckets, "zoom"),
+		features: reg.NewHistogramVec("geo_map_request_features", "Features returned by map request.", metrics.DefaultCountBuckets),
+		maxZoom:  maxZoom,
+	}
+}
+
+// zoomLabel keeps label cardinality bounded by ignoring invalid zoom
+func (m *serverMetrics) zoomLabel(zoomStr string) string {
+	zoom, err := strconv.ParseInt(zoomStr, 10, 64)
+	if err != nil || zoom < 0 || zoom > m.maxZoom {
+		return ""
+	}
+	return zoomStr
+}
+
+func (m *serverMetrics) observeMapRequest(zoomStr string, tiles int64, features int) {
+	if m == nil {
+		return
+	}
+	m.tiles.With(m.zoomLabel(zoomStr)).Observe(float64(tiles))
+	m.features.With().Observe(float64(features))
+}
+
+// instrument counts requests of handler and observes their latency
+func (m *serverMetrics) instrument(handler string, next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		m.requests.With(handler, strconv.Itoa(rec.status)).Inc()
+		m.duration.With(handler, m.zoomLabel(r.URL.Query().Get("zoom"))).Observe(time.Since(start).Seconds())
+	})
+}
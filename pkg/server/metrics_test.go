@@ -0,0 +1,57 @@
+package server
+
+import (
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/ai-zelenin/geo-host/pkg/metrics"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerMetricsSuite(t *testing.T) {
+	suite.Run(t, new(ServerMetricsSuite))
+}
+
+type ServerMetricsSuite struct {
+	suite.Suite
+	reg *metrics.Registry
+	m   *serverMetrics
+}
+
+func (s *ServerMetricsSuite) SetupTest() {
+	s.reg = metrics.NewRegistry()
+	s.m = newServerMetrics(s.reg, geo.DefaultMaxZoom)
+}
+
+func (s *ServerMetricsSuite) text() string {
+	var b strings.Builder
+	s.Require().Nil(s.reg.WriteText(&b))
+	return b.String()
+}
+
+func (s *ServerMetricsSuite) TestInstrument() {
+	gs := geo.NewGeographicSystem(geo.DefaultGeoSystemConfig)
+	rom := NewYandexROMHandler(gs, newMetroDataSource(s.T(), gs), false)
+	rom.metrics = s.m
+	h := s.m.instrument("yandex", rom)
+	for _, url := range []string{metroRequest, metroRequest, "/api/v1/yandex?zoom=x", "/api/v1/yandex?zoom=99"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, url, nil))
+	}
+	text := s.text()
+	s.Contains(text, `geo_http_requests_total{handler="yandex",code="200"} 2`)
+	s.Contains(text, `geo_http_requests_total{handler="yandex",code="400"} 2`)
+	s.Contains(text, `geo_http_request_duration_seconds_count{handler="yandex",zoom="9"} 2`)
+	// invalid zoom does not make new label values
+	s.Contains(text, `geo_http_request_duration_seconds_count{handler="yandex",zoom=""} 2`)
+	s.Contains(text, `geo_map_request_tiles_count{zoom="9"} 2`)
+	s.Contains(text, `geo_map_request_features_count 2`)
+}
+
+func (s *ServerMetricsSuite) TestNilMetrics() {
+	var m *serverMetrics
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	s.NotNil(m.instrument("yandex", h))
+	m.observeMapRequest("9", 1, 1)
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"net/http"
+)
+
+type NearbyHandler struct {
+	ds geo.DataSource
+}
+
+func NewNearbyHandler(ds geo.DataSource) *NearbyHandler {
+	return &NearbyHandler{ds: ds}
+}
+
+func (n *NearbyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	nr, err := geo.ParseNearbyRequest(
+		r.URL.Query().Get("lat"),
+		r.URL.Query().Get("lon"),
+		r.URL.Query().Get("radius"),
+		r.URL.Query().Get("limit"),
+		r.URL.Query().Get("callback"),
+	)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	fc := geo.NewFeatureCollection()
+	err = n.ds.LoadNearby(r.Context(), nr, fc)
+	if err != nil {
+		writeDataSourceError(w, err)
+		return
+	}
+
+	writeFeatureCollection(w, fc, nr.CallbackID)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bucket holds tokens of client at time of last request
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter limits requests of every client with token bucket refilled at rate per second
+// up to burst tokens. Clients are identified by remote IP or by header set by trusted proxy.
+type RateLimiter struct {
+	rate   float64
+	burst  float64
+	header string
+	now    func() time.Time
+
+	mu        sync.Mutex
+	clients   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewRateLimiter(rate float64, burst int, header string) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		header:  header,
+		now:     time.Now,
+		clients: make(map[string]*bucket),
+	}
+}
+
+// Allow takes token of client, if there is none it returns time until next token
+func (l *RateLimiter) Allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+	b, ok := l.clients[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.clients[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets clients whose buckets are full again, they are the same as new ones
+func (l *RateLimiter) sweep(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < refill {
+		return
+	}
+	l.lastSweep = now
+	for client, b := range l.clients {
+		if now.Sub(b.last) >= refill {
+			delete(l.clients, client)
+		}
+	}
+}
+
+func (l *RateLimiter) client(r *http.Request) string {
+	if l.header != "" {
+		if value := r.Header.Get(l.header); value != "" {
+			// trusted proxy appends address of its peer to X-Forwarded-For, entries on the left come from client
+			entries := strings.Split(value, ",")
+			return strings.TrimSpace(entries[len(entries)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Limit responds 429 with Retry-After to clients exceeding rate, nil RateLimiter does not limit
+func (l *RateLimiter) Limit(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, retry := l.Allow(l.client(r))
+		if !ok {
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retry.Seconds())), 10))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
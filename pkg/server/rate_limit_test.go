@@ -0,0 +1,183 @@
+package server
+
+import (
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterSuite(t *testing.T) {
+	suite.Run(t, new(RateLimiterSuite))
+}
+
+type RateLimiterSuite struct {
+	suite.Suite
+	now time.Time
+}
+
+func (s *RateLimiterSuite) SetupTest() {
+	s.now = time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+}
+
+// limiter returns limiter whose clock is moved by tests
+func (s *RateLimiterSuite) limiter(rate float64, burst int, header string) *RateLimiter {
+	l := NewRateLimiter(rate, burst, header)
+	l.now = func() time.Time { return s.now }
+	return l
+}
+
+func (s *RateLimiterSuite) TestAllow() {
+	type step struct {
+		after  time.Duration
+		client string
+		ok     bool
+		retry  time.Duration
+	}
+	cases := []struct {
+		name  string
+		rate  float64
+		burst int
+		steps []step
+	}{
+		{
+			name: "burst then refill", rate: 2, burst: 2,
+			steps: []step{
+				{client: "a", ok: true},
+				{client: "a", ok: true},
+				{client: "a", ok: false, retry: 500 * time.Millisecond},
+				{after: 200 * time.Millisecond, client: "a", ok: false, retry: 300 * time.Millisecond},
+				{after: 300 * time.Millisecond, client: "a", ok: true},
+				{client: "a", ok: false, retry: 500 * time.Millisecond},
+			},
+		},
+		{
+			name: "clients have own buckets", rate: 1, burst: 1,
+			steps: []step{
+				{client: "a", ok: true},
+				{client: "a", ok: false, retry: time.Second},
+				{client: "b", ok: true},
+				{client: "b", ok: false, retry: time.Second},
+			},
+		},
+		{
+			name: "bucket is not filled above burst", rate: 10, burst: 2,
+			steps: []step{
+				{after: time.Hour, client: "a", ok: true},
+				{client: "a", ok: true},
+				{client: "a", ok: false, retry: 100 * time.Millisecond},
+			},
+		},
+		{
+			name: "burst below 1 means 1", rate: 1, burst: 0,
+			steps: []step{
+				{client: "a", ok: true},
+				{client: "a", ok: false, retry: time.Second},
+			},
+		},
+	}
+	for _, c := range cases {
+		l := s.limiter(c.rate, c.burst, "")
+		for i, st := range c.steps {
+			s.now = s.now.Add(st.after)
+			ok, retry := l.Allow(st.client)
+			s.Equal(st.ok, ok, "%s: step %d", c.name, i)
+			s.InDelta(st.retry, retry, float64(time.Millisecond), "%s: step %d", c.name, i)
+		}
+	}
+}
+
+func (s *RateLimiterSuite) TestSweep() {
+	// bucket is refilled in 2 seconds
+	l := s.limiter(1, 2, "")
+	l.Allow("a")
+	s.now = s.now.Add(time.Second)
+	l.Allow("b")
+	s.Equal([]string{"a", "b"}, clients(l))
+
+	// sweep forgets only full buckets
+	s.now = s.now.Add(1500 * time.Millisecond)
+	l.Allow("c")
+	s.Equal([]string{"b", "c"}, clients(l))
+	// sweep runs once per refill time, so full bucket of b is kept for a while
+	s.now = s.now.Add(600 * time.Millisecond)
+	l.Allow("c")
+	s.Equal([]string{"b", "c"}, clients(l))
+	s.now = s.now.Add(1400 * time.Millisecond)
+	l.Allow("d")
+	s.Equal([]string{"c", "d"}, clients(l))
+}
+
+// clients returns sorted clients remembered by limiter
+func clients(l *RateLimiter) []string {
+	keys := make([]string, 0, len(l.clients))
+	for key := range l.clients {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *RateLimiterSuite) TestClient() {
+	cases := []struct {
+		header, remoteAddr, value string
+		client                    string
+	}{
+		{remoteAddr: "10.0.0.1:5000", client: "10.0.0.1"},
+		{remoteAddr: "[::1]:5000", client: "::1"},
+		{remoteAddr: "pipe", client: "pipe"},
+		// header is ignored unless configured
+		{remoteAddr: "10.0.0.1:5000", value: "1.1.1.1", client: "10.0.0.1"},
+		{header: "X-Forwarded-For", remoteAddr: "10.0.0.1:5000", client: "10.0.0.1"},
+		{header: "X-Forwarded-For", remoteAddr: "10.0.0.1:5000", value: "1.1.1.1", client: "1.1.1.1"},
+		// entries on the left are set by client and can be forged
+		{header: "X-Forwarded-For", remoteAddr: "10.0.0.1:5000", value: "6.6.6.6, 1.1.1.1", client: "1.1.1.1"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/yandex", nil)
+		r.RemoteAddr = c.remoteAddr
+		if c.value != "" {
+			r.Header.Set("X-Forwarded-For", c.value)
+		}
+		s.Equal(c.client, s.limiter(1, 1, c.header).client(r), c)
+	}
+}
+
+func (s *RateLimiterSuite) TestLimit() {
+	l := s.limiter(0.5, 1, "X-Forwarded-For")
+	h := l.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(client string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/yandex", nil)
+		r.Header.Set("X-Forwarded-For", client)
+		h.ServeHTTP(w, r)
+		return w
+	}
+	s.Equal(http.StatusNoContent, serve("1.1.1.1").Code)
+	w := serve("1.1.1.1")
+	s.Equal(http.StatusTooManyRequests, w.Code)
+	s.Equal("2", w.Header().Get("Retry-After"))
+	// forged entry does not give client new bucket
+	s.Equal(http.StatusTooManyRequests, serve("6.6.6.6, 1.1.1.1").Code)
+	s.Equal(http.StatusNoContent, serve("2.2.2.2").Code)
+
+	// Retry-After is rounded up to whole seconds
+	s.now = s.now.Add(1500 * time.Millisecond)
+	w = serve("1.1.1.1")
+	s.Equal(http.StatusTooManyRequests, w.Code)
+	s.Equal("1", w.Header().Get("Retry-After"))
+	s.now = s.now.Add(500 * time.Millisecond)
+	s.Equal(http.StatusNoContent, serve("1.1.1.1").Code)
+
+	var nilLimiter *RateLimiter
+	next := http.NotFoundHandler()
+	s.Equal(http.StatusNotFound, func() int {
+		w := httptest.NewRecorder()
+		nilLimiter.Limit(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Code
+	}())
+}
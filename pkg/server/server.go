@@ -1,28 +1,121 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/ai-zelenin/geo-host/pkg/logging"
+	"github.com/ai-zelenin/geo-host/pkg/metrics"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Server struct {
-	cfg *Config
-	ds  geo.DataSource
-	gs  *geo.GeographicSystem
+	cfg    *Config
+	ds     geo.DataSource
+	gs     *geo.GeographicSystem
+	logger logging.Logger
+	// reg is served at /metrics, nil disables metrics
+	reg *metrics.Registry
+	mu  sync.Mutex
+	srv *http.Server
+	// closed is set by Shutdown, so Start called after it returns at once
+	closed bool
+	addr   net.Addr
+	// shuttingDown makes readiness probe fail during shutdown
+	shuttingDown int32
 }
 
-func NewServer(cfg *Config, ds geo.DataSource, gs *geo.GeographicSystem) *Server {
-	return &Server{cfg: cfg, ds: ds, gs: gs}
+func NewServer(cfg *Config, ds geo.DataSource, gs *geo.GeographicSystem, logger logging.Logger, reg *metrics.Registry) *Server {
+	return &Server{cfg: cfg, ds: ds, gs: gs, logger: logger, reg: reg}
 }
 
-func (s *Server) Start() error {
+// Start listens and serves requests until Shutdown, ctx is used only for listening
+func (s *Server) Start(ctx context.Context) error {
 	mux := http.NewServeMux()
 	fs := http.FileServer(http.Dir(s.cfg.StaticDir))
 	mux.Handle("/", fs)
-	mux.Handle("/api/v1/yandex", NewYandexROMHandler(s.gs, s.ds))
-	srv := http.Server{
-		Addr:    s.cfg.ServerAddr,
-		Handler: mux,
+	mux.Handle("/healthz", HealthHandler{})
+	mux.Handle("/readyz", NewReadyHandler(s.ds, &s.shuttingDown))
+	var m *serverMetrics
+	if s.reg != nil {
+		m = newServerMetrics(s.reg, s.gs.QuadKeySystem.MaxZoom())
+		mux.Handle("/metrics", s.reg.Handler())
 	}
-	return srv.ListenAndServe()
+	var limiter *RateLimiter
+	if s.cfg.RateLimit > 0 {
+		limiter = NewRateLimiter(s.cfg.RateLimit, s.cfg.RateBurst, s.cfg.ClientIPHeader)
+	}
+	rom := NewYandexROMHandler(s.gs, s.ds, s.cfg.Debug)
+	rom.metrics = m
+	rom.maxTiles = s.cfg.MaxTiles
+	mux.Handle("/api/v1/yandex", m.instrument("yandex", limiter.Limit(rom)))
+	mux.Handle("/api/v1/nearby", m.instrument("nearby", limiter.Limit(NewNearbyHandler(s.ds))))
+	mux.Handle(ClusterMembersPrefix, m.instrument("cluster_members", limiter.Limit(NewClusterMembersHandler(s.gs, s.ds))))
+	srv := &http.Server{
+		Addr:              s.cfg.ServerAddr,
+		Handler:           LogRequests(s.logger, mux),
+		ReadHeaderTimeout: s.cfg.ReadTimeout,
+		ReadTimeout:       s.cfg.ReadTimeout,
+		WriteTimeout:      s.cfg.WriteTimeout,
+		IdleTimeout:       s.cfg.IdleTimeout,
+	}
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "tcp", s.cfg.ServerAddr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = ln.Close()
+		return nil
+	}
+	if s.srv != nil {
+		s.mu.Unlock()
+		_ = ln.Close()
+		return errors.New("server is already started")
+	}
+	s.srv = srv
+	s.addr = ln.Addr()
+	s.mu.Unlock()
+	s.logger.Info("server started", "addr", ln.Addr().String())
+	err = srv.Serve(ln)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Addr returns address server listens on, nil before Start
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addr
+}
+
+// Shutdown fails readiness probe, waits drain period and then stops accepting connections
+// and waits for in-flight requests until ctx is done. Server shut down before Start does not start.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	srv := s.srv
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	atomic.StoreInt32(&s.shuttingDown, 1)
+	s.logger.Info("server shutting down")
+	if s.cfg.DrainPeriod > 0 {
+		timer := time.NewTimer(s.cfg.DrainPeriod)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+	return srv.Shutdown(ctx)
 }
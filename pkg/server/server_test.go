@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/ai-zelenin/geo-host/pkg/logging"
+	"github.com/ai-zelenin/geo-host/pkg/memds"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const emptyRequest = "/api/v1/yandex?tiles=0,0,1,1&zoom=1&callback=cb"
+
+func TestServerSuite(t *testing.T) {
+	suite.Run(t, new(ServerSuite))
+}
+
+type ServerSuite struct {
+	suite.Suite
+	cfg Config
+	srv *Server
+}
+
+func (s *ServerSuite) SetupTest() {
+	s.cfg = DefaultConfig
+	s.cfg.ServerAddr = "127.0.0.1:0"
+	s.cfg.DrainPeriod = 0
+	gs := geo.NewGeographicSystem(geo.DefaultGeoSystemConfig)
+	s.srv = NewServer(&s.cfg, memds.NewMemoryDataSource(gs, nil), gs, logging.NewTextLogger(ioutil.Discard, logging.LevelError), nil)
+}
+
+// start runs server and waits until it listens, returned channel gets result of Start
+func (s *ServerSuite) start() <-chan error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.srv.Start(context.Background())
+	}()
+	for i := 0; s.srv.Addr() == nil; i++ {
+		s.Require().Less(i, 500, "server is not started")
+		time.Sleep(10 * time.Millisecond)
+	}
+	return errCh
+}
+
+func (s *ServerSuite) get(path string) int {
+	resp, err := http.Get(fmt.Sprintf("http://%s%s", s.srv.Addr(), path))
+	s.Require().Nil(err)
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
+
+func (s *ServerSuite) TestLifecycle() {
+	errCh := s.start()
+	s.Equal(http.StatusOK, s.get(emptyRequest))
+	s.Error(s.srv.Start(context.Background()), "server is started twice")
+
+	s.Nil(s.srv.Shutdown(context.Background()))
+	s.Nil(<-errCh)
+	_, err := http.Get(fmt.Sprintf("http://%s%s", s.srv.Addr(), emptyRequest))
+	s.Error(err)
+}
+
+func (s *ServerSuite) TestShutdownBeforeStart() {
+	s.Nil(s.srv.Shutdown(context.Background()))
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.srv.Start(context.Background())
+	}()
+	select {
+	case err := <-errCh:
+		s.Nil(err)
+	case <-time.After(5 * time.Second):
+		s.Fail("server started after shutdown")
+	}
+	s.Nil(s.srv.Addr())
+}
+
+func (s *ServerSuite) TestDrain() {
+	s.cfg.DrainPeriod = 300 * time.Millisecond
+	errCh := s.start()
+	s.Equal(http.StatusOK, s.get("/readyz"))
+
+	shutdownCh := make(chan error, 1)
+	go func() {
+		shutdownCh <- s.srv.Shutdown(context.Background())
+	}()
+	for i := 0; s.get("/readyz") != http.StatusServiceUnavailable; i++ {
+		s.Require().Less(i, 100, "readiness probe does not fail")
+		time.Sleep(time.Millisecond)
+	}
+	// requests are still served during drain period
+	s.Equal(http.StatusOK, s.get("/healthz"))
+	s.Equal(http.StatusOK, s.get(emptyRequest))
+	s.Nil(<-shutdownCh)
+	s.Nil(<-errCh)
+}
+
+// TestUnsupportedRequests checks that requests refused by data source, e.g. by tile archive, are bad requests
+func (s *ServerSuite) TestUnsupportedRequests() {
+	gs := geo.NewGeographicSystem(geo.DefaultGeoSystemConfig)
+	s.srv = NewServer(&s.cfg, errDataSource{err: geo.ErrUnsupportedRequest}, gs, logging.NewTextLogger(ioutil.Discard, logging.LevelError), nil)
+	errCh := s.start()
+	for _, path := range []string{
+		metroRequest,
+		"/api/v1/nearby?lat=55.75&lon=37.61&radius=500",
+		ClusterMembersPrefix + "1234/members?zoom=9",
+	} {
+		s.Equal(http.StatusBadRequest, s.get(path), path)
+	}
+	s.Nil(s.srv.Shutdown(context.Background()))
+	s.Nil(<-errCh)
+}
@@ -1,9 +1,41 @@
 package server
 
-import "net/http"
+import (
+	"errors"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"net/http"
+)
 
 func RedirectPermanent(newUrl string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, newUrl, http.StatusMovedPermanently)
 	})
 }
+
+// writeFeatureCollection writes JSONP if callback is set and plain JSON otherwise
+func writeFeatureCollection(w http.ResponseWriter, fc *geo.FeatureCollection, callbackID string) {
+	if callbackID != "" {
+		data, err := fc.MarshalToJSONP(callbackID)
+		if err != nil {
+			panic(err)
+		}
+		w.Header().Set("Content-Type", "application/javascript")
+		_, _ = w.Write(data)
+		return
+	}
+	data, err := fc.MarshalJSON()
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// writeDataSourceError responds 400 to requests refused by data source and 500 to its failures
+func writeDataSourceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, geo.ErrUnknownLayer) || errors.Is(err, geo.ErrUnsupportedRequest) {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	http.Error(w, err.Error(), 500)
+}
@@ -9,10 +9,15 @@ import (
 type YandexROMHandler struct {
 	gs *geo.GeographicSystem
 	ds geo.DataSource
+	// debug allows debug mode of requests
+	debug   bool
+	metrics *serverMetrics
+	// maxTiles limits tiles of request, zero means no limit
+	maxTiles int64
 }
 
-func NewYandexROMHandler(gs *geo.GeographicSystem, ds geo.DataSource) *YandexROMHandler {
-	return &YandexROMHandler{gs: gs, ds: ds}
+func NewYandexROMHandler(gs *geo.GeographicSystem, ds geo.DataSource, debug bool) *YandexROMHandler {
+	return &YandexROMHandler{gs: gs, ds: ds, debug: debug}
 }
 
 func (y *YandexROMHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -23,38 +28,81 @@ func (y *YandexROMHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		r.URL.Query().Get("callback"),
 		r.URL.Query().Get("debug"),
 		r.URL.Query().Get("clusterDepth"),
+		r.URL.Query().Get("within"),
+		r.URL.Query().Get("filter"),
+		r.URL.Query().Get("layer"),
 	)
+	if err == nil {
+		err = y.gs.ValidateMapRequest(mr, y.maxTiles)
+	}
 	if err != nil {
 		http.Error(w, err.Error(), 400)
 		return
 	}
+	// debug parameter is ignored unless server allows it
+	mr.Debug = mr.Debug && y.debug
+	addLogFields(r.Context(), "zoom", mr.Zoom, "tiles", mr.TilesNumber())
 
 	fc, err := y.handleMapRequest(r.Context(), mr)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeDataSourceError(w, err)
 		return
 	}
+	addLogFields(r.Context(), "features", len(fc.Features))
+	y.metrics.observeMapRequest(r.URL.Query().Get("zoom"), mr.TilesNumber(), len(fc.Features))
 
 	data, err := fc.MarshalToJSONP(mr.CallbackID)
 	if err != nil {
 		panic(err)
 	}
 	w.Header().Set("Content-Type", "application/javascript")
-	w.Header().Set("Cache-Control", "max-age=1200")
+	if mr.Debug {
+		w.Header().Set("Cache-Control", "no-store")
+	} else {
+		w.Header().Set("Cache-Control", "max-age=1200")
+	}
 	_, _ = w.Write(data)
 }
 
 func (y *YandexROMHandler) handleMapRequest(ctx context.Context, mr *geo.MapRequest) (*geo.FeatureCollection, error) {
 	fc := geo.NewFeatureCollection()
 	if mr.Debug {
-		err := y.gs.DrawROMTiles(mr, fc)
-		if err != nil {
-			return nil, err
-		}
+		mr.DebugInfo = geo.NewDebugInfo()
+		ctx = geo.ContextWithDebugInfo(ctx, mr.DebugInfo)
 	}
 	err := y.ds.LoadMapView(ctx, mr, fc)
 	if err != nil {
 		return nil, err
 	}
+	if mr.Debug {
+		// overlay is drawn after loading to show what data source did, but goes first to stay under markers
+		debug := geo.NewFeatureCollection()
+		if mr.BBox != (geo.BBox{}) {
+			err = y.gs.DrawROMBBox(mr, debug)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = y.gs.DrawROMTiles(mr, debug)
+		if err != nil {
+			return nil, err
+		}
+		err = y.gs.DrawROMClusterGrid(mr, debug)
+		if err != nil {
+			return nil, err
+		}
+		err = y.gs.DrawROMQueries(mr, debug)
+		if err != nil {
+			return nil, err
+		}
+		if mr.Within != nil {
+			err = y.gs.DrawROMWithin(mr, debug)
+			if err != nil {
+				return nil, err
+			}
+		}
+		debug.Append(fc)
+		return debug, nil
+	}
 	return fc, nil
 }
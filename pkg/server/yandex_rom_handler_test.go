@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/ai-zelenin/geo-host/pkg/memds"
+	"github.com/stretchr/testify/suite"
+	"github.com/twpayne/go-geom/encoding/geojson"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// metroRequest covers center of Moscow with clusters of metro stations
+const metroRequest = "/api/v1/yandex?tiles=308,159,311,162&zoom=9&clusterDepth=2&callback=cb"
+
+func TestYandexROMHandlerSuite(t *testing.T) {
+	suite.Run(t, new(YandexROMHandlerSuite))
+}
+
+type YandexROMHandlerSuite struct {
+	suite.Suite
+	gs *geo.GeographicSystem
+	ds *memds.MemoryDataSource
+}
+
+func (s *YandexROMHandlerSuite) SetupTest() {
+	s.gs = geo.NewGeographicSystem(geo.DefaultGeoSystemConfig)
+	s.ds = newMetroDataSource(s.T(), s.gs)
+}
+
+// newMetroDataSource is memory data source with metro stations
+func newMetroDataSource(t *testing.T, gs *geo.GeographicSystem) *memds.MemoryDataSource {
+	ds := memds.NewMemoryDataSource(gs, func(obj *memds.Cluster) map[string]interface{} {
+		return map[string]interface{}{"count": obj.Count}
+	})
+	data, err := ioutil.ReadFile("../../metro.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := make([]*memds.GeoObject, 0)
+	if err = json.Unmarshal(data, &objects); err != nil {
+		t.Fatal(err)
+	}
+	for _, object := range objects {
+		if err = ds.StoreGeoData(context.Background(), object); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ds
+}
+
+// serve returns response and features of JSONP response
+func (s *YandexROMHandlerSuite) serve(h http.Handler, url string) (*httptest.ResponseRecorder, []*geojson.Feature) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	if w.Code != http.StatusOK {
+		return w, nil
+	}
+	body := w.Body.String()
+	s.Require().True(strings.HasPrefix(body, "cb(") && strings.HasSuffix(body, ")"), body)
+	var fc geojson.FeatureCollection
+	s.Require().Nil(json.Unmarshal([]byte(body[3:len(body)-1]), &fc))
+	return w, fc.Features
+}
+
+func (s *YandexROMHandlerSuite) TestDebugDisallowed() {
+	h := NewYandexROMHandler(s.gs, s.ds, false)
+	w, plain := s.serve(h, metroRequest)
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.NotEmpty(plain)
+	s.Equal("max-age=1200", w.Header().Get("Cache-Control"))
+
+	// debug parameter can not turn debug on in production
+	w, features := s.serve(h, metroRequest+"&debug=true")
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.Equal("max-age=1200", w.Header().Get("Cache-Control"))
+	s.Equal(plain, features)
+}
+
+func (s *YandexROMHandlerSuite) TestDebugAllowed() {
+	h := NewYandexROMHandler(s.gs, s.ds, true)
+	_, plain := s.serve(h, metroRequest)
+	w, features := s.serve(h, metroRequest+"&debug=true")
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.Equal("no-store", w.Header().Get("Cache-Control"))
+	s.Greater(len(features), len(plain))
+	// overlay goes first to stay under markers
+	s.Equal(plain, features[len(features)-len(plain):])
+}
+
+func (s *YandexROMHandlerSuite) TestBadRequest() {
+	h := NewYandexROMHandler(s.gs, s.ds, false)
+	for _, url := range []string{
+		"/api/v1/yandex?tiles=1,2,3&zoom=9",
+		"/api/v1/yandex?tiles=0,0,1,1&zoom=x",
+		"/api/v1/yandex?tiles=0,0,1,1&zoom=2&layer=tram",
+	} {
+		w, _ := s.serve(h, url)
+		s.Equal(http.StatusBadRequest, w.Code, url)
+	}
+}
+
+// errDataSource fails requests with err
+type errDataSource struct {
+	geo.DataSource
+	err error
+}
+
+func (d errDataSource) LoadMapView(ctx context.Context, mr *geo.MapRequest, fc *geo.FeatureCollection) error {
+	return d.err
+}
+
+func (d errDataSource) LoadNearby(ctx context.Context, nr *geo.NearbyRequest, fc *geo.FeatureCollection) error {
+	return d.err
+}
+
+func (d errDataSource) LoadClusterMembers(ctx context.Context, cr *geo.ClusterMembersRequest, fc *geo.FeatureCollection) (int64, error) {
+	return 0, d.err
+}
+
+func (s *YandexROMHandlerSuite) TestDataSourceError() {
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{err: fmt.Errorf("%w: within", geo.ErrUnsupportedRequest), code: http.StatusBadRequest},
+		{err: fmt.Errorf("%w \"tram\"", geo.ErrUnknownLayer), code: http.StatusBadRequest},
+		{err: errors.New("connection refused"), code: http.StatusInternalServerError},
+	}
+	for _, c := range cases {
+		w, _ := s.serve(NewYandexROMHandler(s.gs, errDataSource{err: c.err}, false), metroRequest)
+		s.Equal(c.code, w.Code, c.err)
+		s.Contains(w.Body.String(), c.err.Error())
+	}
+}
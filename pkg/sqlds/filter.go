@@ -0,0 +1,57 @@
+package sqlds
+
+import (
+	"encoding/json"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/uptrace/bun"
+)
+
+// textExpr is text form of property in the same way as geo.FilterValueText
+const textExpr = "CASE json_type(properties, ?) WHEN 'true' THEN 'true' WHEN 'false' THEN 'false' ELSE CAST(json_extract(properties, ?) AS TEXT) END"
+
+// propertyPath is JSON path of top level property, key is quoted to allow any characters
+func propertyPath(key string) string {
+	quoted, _ := json.Marshal(key)
+	return "$." + string(quoted)
+}
+
+// whereTiles restricts objects to tiles with ranges of quad keys, so quad key index is used
+func whereTiles(q *bun.SelectQuery, tileIDs []int64, bitDelta int64) *bun.SelectQuery {
+	if len(tileIDs) == 0 {
+		return q.Where("0")
+	}
+	return q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+		for _, tileID := range tileIDs {
+			q.WhereOr("quad_key >= ? AND quad_key < ?", tileID<<bitDelta, (tileID+1)<<bitDelta)
+		}
+		return q
+	})
+}
+
+// wherePropertyFilter translates filter to conditions on JSON properties
+func wherePropertyFilter(q *bun.SelectQuery, filter geo.PropertyFilter) *bun.SelectQuery {
+	for _, cond := range filter {
+		path := propertyPath(cond.Key)
+		switch cond.Op {
+		case geo.FilterEq, geo.FilterIn:
+			if len(cond.Values) == 0 {
+				q.Where("0")
+				continue
+			}
+			texts := make([]string, 0, len(cond.Values))
+			for _, value := range cond.Values {
+				texts = append(texts, geo.FilterValueText(value))
+			}
+			q.Where(textExpr+" IN (?)", path, path, bun.In(texts))
+		case geo.FilterRange:
+			q.Where("json_type(properties, ?) IN ('integer', 'real')", path)
+			if cond.Min != nil {
+				q.Where("json_extract(properties, ?) >= ?", path, *cond.Min)
+			}
+			if cond.Max != nil {
+				q.Where("json_extract(properties, ?) <= ?", path, *cond.Max)
+			}
+		}
+	}
+	return q
+}
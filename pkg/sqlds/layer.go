@@ -0,0 +1,40 @@
+package sqlds
+
+import (
+	"context"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/uptrace/bun"
+)
+
+const (
+	DefaultTable          = geo.DefaultLayerTable
+	DefaultClusterMembers = 10
+)
+
+// Layer is a named set of objects stored in its own table
+type Layer struct {
+	Name   string
+	Table  string
+	Mapper PropertiesMapper
+	// ClusterMembers is number of objects put into ClusterData of cluster, 0 disables members loading
+	ClusterMembers int64
+}
+
+func NewLayer(name string, mapper PropertiesMapper) (*Layer, error) {
+	table, err := geo.LayerTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Layer{Name: name, Table: table, Mapper: mapper, ClusterMembers: DefaultClusterMembers}, nil
+}
+
+// createSchema creates table of layer and btree index of quad key used by all queries
+func (l *Layer) createSchema(ctx context.Context, db bun.IDB) error {
+	_, err := db.NewCreateTable().Model((*GeoObject)(nil)).ModelTableExpr("?", bun.Ident(l.Table)).IfNotExists().Exec(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = db.NewCreateIndex().Model((*GeoObject)(nil)).ModelTableExpr("?", bun.Ident(l.Table)).
+		Index(l.Table + "_quad_key_btree").Column("quad_key").IfNotExists().Exec(ctx)
+	return err
+}
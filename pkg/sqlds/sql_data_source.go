@@ -0,0 +1,451 @@
+// Package sqlds implements geo.DataSource with plain SQL over quad keys and lat/lon columns,
+// so it runs on embedded SQLite without PostGIS. Clusters are groups of quad keys,
+// their markers are placed at centroids computed as average of coordinates.
+package sqlds
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/ai-zelenin/geo-host/pkg/style"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	_ "modernc.org/sqlite"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrWithinUnsupported is returned for requests restricted to area, which needs spatial functions
+var ErrWithinUnsupported = fmt.Errorf("%w: within needs spatial functions", geo.ErrUnsupportedRequest)
+
+type PropertiesMapper func(obj *Cluster) map[string]interface{}
+
+type GeoObject struct {
+	bun.BaseModel `bun:"table:geo_objects"`
+	ID            int64                  `bun:"id,pk,autoincrement"`
+	QuadKey       int64                  `bun:"quad_key,notnull"`
+	Lat           float64                `bun:"lat,notnull"`
+	Lon           float64                `bun:"lon,notnull"`
+	Properties    map[string]interface{} `bun:"properties"`
+}
+
+func (o *GeoObject) Point() *geo.GeographicPoint {
+	return &geo.GeographicPoint{
+		Latitude:  o.Lat,
+		Longitude: o.Lon,
+	}
+}
+
+type Cluster struct {
+	ID    int64
+	MinID int64
+	Count int64
+	// ClusterData are first members ordered by id, representative is the first of them
+	ClusterData []*GeoObject
+	Centroid    *geo.GeographicPoint
+	GeoObject
+}
+
+// StyleObject is cluster as seen by style templates
+func (c *Cluster) StyleObject() *style.Object {
+	obj := &style.Object{ID: c.ID, Count: c.Count, Properties: c.Properties}
+	for _, member := range c.ClusterData {
+		obj.AddMember(member.ID, member.Properties)
+	}
+	return obj
+}
+
+// clusterRow is cluster aggregated by database
+type clusterRow struct {
+	TileID      int64   `bun:"tile_id"`
+	Count       int64   `bun:"count"`
+	MinID       int64   `bun:"min_id"`
+	CentroidLat float64 `bun:"centroid_lat"`
+	CentroidLon float64 `bun:"centroid_lon"`
+	MinQuadKey  int64   `bun:"min_quad_key"`
+	MaxQuadKey  int64   `bun:"max_quad_key"`
+	MinLat      float64 `bun:"min_lat"`
+	MaxLat      float64 `bun:"max_lat"`
+	MinLon      float64 `bun:"min_lon"`
+	MaxLon      float64 `bun:"max_lon"`
+}
+
+// memberRow is object with tile of its cluster
+type memberRow struct {
+	GeoObject
+	TileID int64 `bun:"tile_id"`
+}
+
+type SQLDataSource struct {
+	DB     *bun.DB
+	gs     *geo.GeographicSystem
+	mu     sync.RWMutex
+	layers map[string]*Layer
+}
+
+// OpenSQLite opens SQLite database with pure Go driver, dsn is file path or ":memory:"
+func OpenSQLite(ctx context.Context, dsn string, gs *geo.GeographicSystem, mapper PropertiesMapper) (*SQLDataSource, error) {
+	sqldb, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has single writer and in-memory database exists per connection
+	sqldb.SetMaxOpenConns(1)
+	s, err := NewSQLDataSource(ctx, bun.NewDB(sqldb, sqlitedialect.New()), gs, mapper)
+	if err != nil {
+		_ = sqldb.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewSQLDataSource creates schema of default layer in db
+func NewSQLDataSource(ctx context.Context, db *bun.DB, gs *geo.GeographicSystem, mapper PropertiesMapper) (*SQLDataSource, error) {
+	s := &SQLDataSource{
+		DB:     db,
+		gs:     gs,
+		layers: make(map[string]*Layer),
+	}
+	_, err := s.RegisterLayer(ctx, geo.DefaultLayer, mapper)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLDataSource) Close() error {
+	return s.DB.Close()
+}
+
+// CheckHealth implements geo.HealthChecker
+func (s *SQLDataSource) CheckHealth(ctx context.Context) error {
+	return s.DB.PingContext(ctx)
+}
+
+// RegisterLayer makes layer available for requests, its table is created if it does not exist
+func (s *SQLDataSource) RegisterLayer(ctx context.Context, name string, mapper PropertiesMapper) (*Layer, error) {
+	layer, err := NewLayer(name, mapper)
+	if err != nil {
+		return nil, err
+	}
+	err = layer.createSchema(ctx, s.DB)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.layers[name] = layer
+	s.mu.Unlock()
+	return layer, nil
+}
+
+func (s *SQLDataSource) Layer(name string) (*Layer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	layer, ok := s.layers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", geo.ErrUnknownLayer, name)
+	}
+	return layer, nil
+}
+
+func (s *SQLDataSource) LoadMapView(ctx context.Context, mr *geo.MapRequest, fc *geo.FeatureCollection) error {
+	if mr.Within != nil {
+		return ErrWithinUnsupported
+	}
+	tiles := s.gs.MRToTiles(mr)
+	tileIDs := make([]int64, 0, len(tiles))
+	for id := range tiles {
+		tileIDs = append(tileIDs, id)
+	}
+	sort.Slice(tileIDs, func(i, j int) bool { return tileIDs[i] < tileIDs[j] })
+	if len(tileIDs) == 0 {
+		return nil
+	}
+	for _, name := range mr.LayerNames() {
+		layer, err := s.Layer(name)
+		if err != nil {
+			return err
+		}
+		err = s.loadLayerMapView(ctx, layer, mr, tileIDs, fc)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLDataSource) loadLayerMapView(ctx context.Context, layer *Layer, mr *geo.MapRequest, tileIDs []int64, fc *geo.FeatureCollection) error {
+	if !mr.Adaptive {
+		return s.loadClusters(ctx, layer, mr, tileIDs, fc)
+	}
+	depths, err := s.adaptiveDepths(ctx, layer, mr, tileIDs)
+	if err != nil {
+		return err
+	}
+	return mr.LoadByDepth(tileIDs, depths, func(mr *geo.MapRequest, tileIDs []int64) error {
+		return s.loadClusters(ctx, layer, mr, tileIDs, fc)
+	})
+}
+
+// adaptiveDepths chooses cluster depth of every tile by numbers of its non-empty sub-tiles
+func (s *SQLDataSource) adaptiveDepths(ctx context.Context, layer *Layer, mr *geo.MapRequest, tileIDs []int64) (map[int64]int64, error) {
+	maxDepth, fullDepth := s.gs.QuadKeySystem.AdaptiveDepthRange(mr.Zoom)
+	bitDelta := s.gs.QuadKeySystem.BitDelta(mr.Zoom)
+	q := s.DB.NewSelect().TableExpr("? AS geo_object", bun.Ident(layer.Table))
+	q.ColumnExpr("quad_key >> ? AS tile_id", bitDelta)
+	q.ColumnExpr("COUNT(id) AS total")
+	for depth := int64(1); depth <= maxDepth; depth++ {
+		q.ColumnExpr("COUNT(DISTINCT quad_key >> ?)", s.gs.QuadKeySystem.BitDelta(mr.Zoom+depth))
+	}
+	whereTiles(q, tileIDs, bitDelta)
+	wherePropertyFilter(q, mr.Filter)
+	q.GroupExpr("quad_key >> ?", bitDelta)
+	rows, err := q.Rows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	depths := make(map[int64]int64, len(tileIDs))
+	for _, tileID := range tileIDs {
+		depths[tileID] = geo.ChooseClusterDepth(0, make([]int64, maxDepth), mr.MaxMarkers, fullDepth)
+	}
+	for rows.Next() {
+		var tileID, total int64
+		subTiles := make([]int64, maxDepth)
+		dest := []interface{}{&tileID, &total}
+		for i := range subTiles {
+			dest = append(dest, &subTiles[i])
+		}
+		err = rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		depths[tileID] = geo.ChooseClusterDepth(total, subTiles, mr.MaxMarkers, fullDepth)
+	}
+	return depths, rows.Err()
+}
+
+// loadClusters groups objects of tiles by quad key prefix of cluster zoom
+func (s *SQLDataSource) loadClusters(ctx context.Context, layer *Layer, mr *geo.MapRequest, tileIDs []int64, fc *geo.FeatureCollection) error {
+	start := time.Now()
+	bitDelta := s.gs.QuadKeySystem.BitDelta(mr.Zoom)
+	clusterShift := s.gs.QuadKeySystem.BitDelta(s.gs.ClusterZoom(mr))
+	clusters := make([]*clusterRow, 0)
+	q := s.DB.NewSelect().TableExpr("? AS geo_object", bun.Ident(layer.Table))
+	q.ColumnExpr("quad_key >> ? AS tile_id", clusterShift)
+	q.ColumnExpr("COUNT(id) AS count")
+	q.ColumnExpr("MIN(id) AS min_id")
+	q.ColumnExpr("AVG(lat) AS centroid_lat")
+	q.ColumnExpr("AVG(lon) AS centroid_lon")
+	q.ColumnExpr("MIN(quad_key) AS min_quad_key")
+	q.ColumnExpr("MAX(quad_key) AS max_quad_key")
+	q.ColumnExpr("MIN(lat) AS min_lat")
+	q.ColumnExpr("MAX(lat) AS max_lat")
+	q.ColumnExpr("MIN(lon) AS min_lon")
+	q.ColumnExpr("MAX(lon) AS max_lon")
+	whereTiles(q, tileIDs, bitDelta)
+	wherePropertyFilter(q, mr.Filter)
+	q.GroupExpr("quad_key >> ?", clusterShift)
+	q.OrderExpr("tile_id")
+	err := q.Scan(ctx, &clusters)
+	if err != nil {
+		return err
+	}
+	members, err := s.loadMembers(ctx, layer, mr, tileIDs, clusterShift)
+	if err != nil {
+		return err
+	}
+	for _, row := range clusters {
+		err = s.addCluster(fc, layer, mr, row, members[row.TileID])
+		if err != nil {
+			return err
+		}
+	}
+	mr.DebugInfo.AddLoad(tileIDs, time.Since(start))
+	return nil
+}
+
+// loadMembers returns first objects of every cluster ordered by id, at least one for representative
+func (s *SQLDataSource) loadMembers(ctx context.Context, layer *Layer, mr *geo.MapRequest, tileIDs []int64, clusterShift int64) (map[int64][]*GeoObject, error) {
+	limit := layer.ClusterMembers
+	if limit < 1 {
+		limit = 1
+	}
+	bitDelta := s.gs.QuadKeySystem.BitDelta(mr.Zoom)
+	ranked := s.DB.NewSelect().TableExpr("? AS geo_object", bun.Ident(layer.Table))
+	ranked.ColumnExpr("*")
+	ranked.ColumnExpr("quad_key >> ? AS tile_id", clusterShift)
+	ranked.ColumnExpr("ROW_NUMBER() OVER (PARTITION BY quad_key >> ? ORDER BY id) AS member_rank", clusterShift)
+	whereTiles(ranked, tileIDs, bitDelta)
+	wherePropertyFilter(ranked, mr.Filter)
+	rows := make([]*memberRow, 0)
+	err := s.DB.NewSelect().TableExpr("(?) AS ranked", ranked).
+		ColumnExpr("id, quad_key, lat, lon, properties, tile_id").
+		Where("member_rank <= ?", limit).
+		OrderExpr("tile_id, id").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[int64][]*GeoObject)
+	for _, row := range rows {
+		object := row.GeoObject
+		members[row.TileID] = append(members[row.TileID], &object)
+	}
+	return members, nil
+}
+
+func (s *SQLDataSource) addCluster(fc *geo.FeatureCollection, layer *Layer, mr *geo.MapRequest, row *clusterRow, members []*GeoObject) error {
+	if len(members) == 0 {
+		return fmt.Errorf("cluster %d of layer %s has no members", row.TileID, layer.Name)
+	}
+	cluster := &Cluster{
+		ID:        row.TileID,
+		MinID:     row.MinID,
+		Count:     row.Count,
+		GeoObject: *members[0],
+	}
+	id := geo.LayerFeatureID(layer.Name, cluster.ID)
+	clusterZoom := s.gs.ClusterZoom(mr)
+	mr.DebugInfo.AddCluster(layer.Name, cluster.ID, clusterZoom, cluster.Count)
+	if cluster.Count == 1 {
+		return fc.Add(id, cluster.Point(), layer.Mapper(cluster))
+	}
+	if layer.ClusterMembers > 0 {
+		cluster.ClusterData = members
+	}
+	cluster.Centroid = &geo.GeographicPoint{
+		Latitude:  row.CentroidLat,
+		Longitude: row.CentroidLon,
+	}
+	props := layer.Mapper(cluster)
+	if props == nil {
+		props = make(map[string]interface{})
+	}
+	bbox := geo.BBox{XMin: row.MinLat, XMax: row.MaxLat, YMin: row.MinLon, YMax: row.MaxLon}
+	for key, value := range s.gs.ClusterBoundsProperties(bbox, row.MinQuadKey, row.MaxQuadKey, mr.ClusterDepth) {
+		props[key] = value
+	}
+	return fc.Add(id, cluster.Centroid, props)
+}
+
+type nearbyObject struct {
+	*GeoObject
+	distance float64
+}
+
+// LoadNearby loads objects of default layer from tiles around the center whose size is comparable
+// to the radius and returns the nearest of them ordered by great-circle distance.
+func (s *SQLDataSource) LoadNearby(ctx context.Context, nr *geo.NearbyRequest, fc *geo.FeatureCollection) error {
+	layer, err := s.Layer(geo.DefaultLayer)
+	if err != nil {
+		return err
+	}
+	tiles, zoom := s.gs.CircleToTiles(nr.Lat, nr.Lon, nr.Radius)
+	tileIDs := make([]int64, 0, len(tiles))
+	for id := range tiles {
+		tileIDs = append(tileIDs, id)
+	}
+	objects := make([]*GeoObject, 0)
+	q := s.DB.NewSelect().Model(&objects).ModelTableExpr("? AS geo_object", bun.Ident(layer.Table))
+	whereTiles(q, tileIDs, s.gs.QuadKeySystem.BitDelta(zoom))
+	err = q.Scan(ctx)
+	if err != nil {
+		return err
+	}
+	found := make([]nearbyObject, 0, nr.Limit)
+	for _, object := range objects {
+		distance := geo.HaversineDistance(nr.Lat, nr.Lon, object.Lat, object.Lon)
+		if distance <= nr.Radius {
+			found = append(found, nearbyObject{GeoObject: object, distance: distance})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].distance == found[j].distance {
+			return found[i].ID < found[j].ID
+		}
+		return found[i].distance < found[j].distance
+	})
+	if int64(len(found)) > nr.Limit {
+		found = found[:nr.Limit]
+	}
+	for _, object := range found {
+		props := layer.Mapper(&Cluster{
+			ID:        object.ID,
+			MinID:     object.ID,
+			Count:     1,
+			GeoObject: *object.GeoObject,
+		})
+		if props == nil {
+			props = make(map[string]interface{})
+		}
+		props["distance"] = object.distance
+		err = fc.Add(object.ID, object.Point(), props)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLDataSource) LoadClusterMembers(ctx context.Context, cr *geo.ClusterMembersRequest, fc *geo.FeatureCollection) (int64, error) {
+	if cr.Within != nil {
+		return 0, ErrWithinUnsupported
+	}
+	layer, err := s.Layer(cr.Layer)
+	if err != nil {
+		return 0, err
+	}
+	shift := s.gs.QuadKeySystem.BitDelta(cr.Zoom)
+	members := make([]*GeoObject, 0)
+	q := s.DB.NewSelect().Model(&members).ModelTableExpr("? AS geo_object", bun.Ident(layer.Table))
+	whereTiles(q, []int64{cr.TileID}, shift)
+	wherePropertyFilter(q, cr.Filter)
+	q.Order("id").Offset(int(cr.Offset)).Limit(int(cr.Limit))
+	total, err := q.ScanAndCount(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, object := range members {
+		props := layer.Mapper(&Cluster{
+			ID:        object.ID,
+			MinID:     object.ID,
+			Count:     1,
+			GeoObject: *object,
+		})
+		err = fc.Add(geo.LayerFeatureID(layer.Name, object.ID), object.Point(), props)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int64(total), nil
+}
+
+func (s *SQLDataSource) StoreGeoData(ctx context.Context, d interface{}) error {
+	return s.StoreLayerData(ctx, geo.DefaultLayer, d)
+}
+
+// StoreLayerData inserts object or replaces object with the same id
+func (s *SQLDataSource) StoreLayerData(ctx context.Context, name string, d interface{}) error {
+	gObj, ok := d.(*GeoObject)
+	if !ok {
+		return fmt.Errorf("unexpected data type %T", d)
+	}
+	layer, err := s.Layer(name)
+	if err != nil {
+		return err
+	}
+	gObj.QuadKey = s.gs.CoordinatesToQuadKey(gObj.Lat, gObj.Lon).Int64()
+	q := s.DB.NewInsert().Model(gObj).ModelTableExpr("?", bun.Ident(layer.Table))
+	if gObj.ID != 0 {
+		q.On("CONFLICT (id) DO UPDATE").
+			Set("quad_key = EXCLUDED.quad_key").
+			Set("lat = EXCLUDED.lat").
+			Set("lon = EXCLUDED.lon").
+			Set("properties = EXCLUDED.properties")
+	}
+	_, err = q.Exec(ctx)
+	return err
+}
@@ -0,0 +1,348 @@
+package sqlds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/ai-zelenin/geo-host/pkg/memds"
+	"github.com/stretchr/testify/suite"
+	"github.com/twpayne/go-geom/encoding/geojson"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSQLDataSourceSuite(t *testing.T) {
+	suite.Run(t, new(SQLDataSourceSuite))
+}
+
+type SQLDataSourceSuite struct {
+	suite.Suite
+	gs      *geo.GeographicSystem
+	ds      *SQLDataSource
+	objects []*GeoObject
+}
+
+func (s *SQLDataSourceSuite) SetupTest() {
+	var err error
+	s.gs = geo.NewGeographicSystem(geo.DefaultGeoSystemConfig)
+	s.ds, err = OpenSQLite(context.Background(), ":memory:", s.gs, func(obj *Cluster) map[string]interface{} {
+		return map[string]interface{}{
+			"count": obj.Count,
+			"name":  obj.Properties["name"],
+		}
+	})
+	s.Require().Nil(err)
+	data, err := ioutil.ReadFile("../../metro.json")
+	s.Require().Nil(err)
+	s.objects = make([]*GeoObject, 0)
+	s.Require().Nil(json.Unmarshal(data, &s.objects))
+	for _, object := range s.objects {
+		s.Require().Nil(s.ds.StoreGeoData(context.Background(), object))
+	}
+}
+
+func (s *SQLDataSourceSuite) TearDownTest() {
+	s.Nil(s.ds.Close())
+}
+
+func (s *SQLDataSourceSuite) TestLoadMapView() {
+	mr, err := geo.ParseMapRequest("", "0,0,3,3", "2", "", "", "2", "", "", "")
+	if !s.Nil(err) {
+		return
+	}
+	fc := geo.NewFeatureCollection()
+	err = s.ds.LoadMapView(context.Background(), mr, fc)
+	if !s.Nil(err) {
+		return
+	}
+	var total int64
+	for _, feature := range fc.Features {
+		total += feature.Properties["count"].(int64)
+	}
+	s.Equal(int64(len(s.objects)), total)
+}
+
+// TestSameAsMemory compares clusters with clusters of memory data source holding the same objects
+func (s *SQLDataSourceSuite) TestSameAsMemory() {
+	mds := memds.NewMemoryDataSource(s.gs, func(obj *memds.Cluster) map[string]interface{} {
+		return map[string]interface{}{
+			"count": obj.Count,
+			"name":  obj.Properties["name"],
+		}
+	})
+	for _, object := range s.objects {
+		s.Require().Nil(mds.StoreGeoData(context.Background(), &memds.GeoObject{
+			ID:         object.ID,
+			Lat:        object.Lat,
+			Lon:        object.Lon,
+			Properties: object.Properties,
+		}))
+	}
+	for _, depth := range []string{"0", "2", "4", "auto:16"} {
+		mr, err := geo.ParseMapRequest("", "308,159,311,162", "9", "", "", depth, "", "", "")
+		s.Require().Nil(err)
+		expected := geo.NewFeatureCollection()
+		s.Require().Nil(mds.LoadMapView(context.Background(), mr, expected))
+		mr, err = geo.ParseMapRequest("", "308,159,311,162", "9", "", "", depth, "", "", "")
+		s.Require().Nil(err)
+		fc := geo.NewFeatureCollection()
+		s.Require().Nil(s.ds.LoadMapView(context.Background(), mr, fc))
+		if !s.Len(fc.Features, len(expected.Features), depth) {
+			continue
+		}
+		byID := make(map[string]*geojson.Feature, len(fc.Features))
+		for _, feature := range fc.Features {
+			byID[feature.ID] = feature
+		}
+		for _, e := range expected.Features {
+			feature, ok := byID[e.ID]
+			if !s.True(ok, depth) {
+				continue
+			}
+			s.Equal(e.Properties, feature.Properties, depth)
+			expectedPoint, point := new(geo.GeographicPoint), new(geo.GeographicPoint)
+			s.Require().Nil(expectedPoint.FromGeom(e.Geometry))
+			s.Require().Nil(point.FromGeom(feature.Geometry))
+			s.InDelta(expectedPoint.Latitude, point.Latitude, 1e-9)
+			s.InDelta(expectedPoint.Longitude, point.Longitude, 1e-9)
+		}
+	}
+}
+
+func (s *SQLDataSourceSuite) TestLoadNearby() {
+	nr, err := geo.ParseNearbyRequest("55.69329", "37.534511", "3000", "5", "")
+	if !s.Nil(err) {
+		return
+	}
+	fc := geo.NewFeatureCollection()
+	err = s.ds.LoadNearby(context.Background(), nr, fc)
+	if !s.Nil(err) || !s.Len(fc.Features, 5) {
+		return
+	}
+	s.Equal("Университет", fc.Features[0].Properties["name"])
+	s.Equal(0.0, fc.Features[0].Properties["distance"])
+	var prev float64
+	for _, feature := range fc.Features {
+		distance := feature.Properties["distance"].(float64)
+		s.LessOrEqual(prev, distance)
+		s.LessOrEqual(distance, nr.Radius)
+		prev = distance
+	}
+}
+
+func (s *SQLDataSourceSuite) TestLoadNearbyAntimeridian() {
+	for _, lon := range []float64{179.9995, -179.9995} {
+		s.Require().Nil(s.ds.StoreGeoData(context.Background(), &GeoObject{Lat: 0, Lon: lon}))
+	}
+	for _, lon := range []float64{179.9999, -179.9999} {
+		nr := &geo.NearbyRequest{Lat: 0, Lon: lon, Radius: 1000, Limit: 5}
+		fc := geo.NewFeatureCollection()
+		err := s.ds.LoadNearby(context.Background(), nr, fc)
+		if s.Nil(err) {
+			s.Len(fc.Features, 2, lon)
+		}
+	}
+}
+
+func (s *SQLDataSourceSuite) TestStoreGeoDataMove() {
+	object := s.objects[0]
+	moved := &GeoObject{
+		ID:         object.ID,
+		Lat:        -object.Lat,
+		Lon:        -object.Lon,
+		Properties: object.Properties,
+	}
+	err := s.ds.StoreGeoData(context.Background(), moved)
+	if !s.Nil(err) {
+		return
+	}
+	count, err := s.ds.DB.NewSelect().Model((*GeoObject)(nil)).Count(context.Background())
+	if !s.Nil(err) {
+		return
+	}
+	s.Equal(len(s.objects), count)
+	nr := &geo.NearbyRequest{Lat: moved.Lat, Lon: moved.Lon, Radius: 10, Limit: 1}
+	fc := geo.NewFeatureCollection()
+	err = s.ds.LoadNearby(context.Background(), nr, fc)
+	if !s.Nil(err) {
+		return
+	}
+	if s.Len(fc.Features, 1) {
+		s.Equal(object.Properties["name"], fc.Features[0].Properties["name"])
+	}
+
+	added := &GeoObject{Lat: 55.75, Lon: 37.61}
+	err = s.ds.StoreGeoData(context.Background(), added)
+	if s.Nil(err) {
+		s.NotZero(added.ID)
+	}
+}
+
+func (s *SQLDataSourceSuite) TestLayers() {
+	_, err := s.ds.RegisterLayer(context.Background(), "bus", func(obj *Cluster) map[string]interface{} {
+		return map[string]interface{}{"count": obj.Count, "bus": true}
+	})
+	if !s.Nil(err) {
+		return
+	}
+	err = s.ds.StoreLayerData(context.Background(), "bus", &GeoObject{Lat: 55.75, Lon: 37.61})
+	if !s.Nil(err) {
+		return
+	}
+	err = s.ds.StoreLayerData(context.Background(), "tram", &GeoObject{Lat: 55.75, Lon: 37.61})
+	s.ErrorIs(err, geo.ErrUnknownLayer)
+	_, err = s.ds.RegisterLayer(context.Background(), `bus"; drop`, s.ds.layers[geo.DefaultLayer].Mapper)
+	s.Error(err)
+
+	mr, err := geo.ParseMapRequest("", "0,0,3,3", "2", "", "", "", "", "", "default,bus")
+	if !s.Nil(err) {
+		return
+	}
+	fc := geo.NewFeatureCollection()
+	err = s.ds.LoadMapView(context.Background(), mr, fc)
+	if !s.Nil(err) || !s.Len(fc.Features, 2) {
+		return
+	}
+	s.Equal(int64(len(s.objects)), fc.Features[0].Properties["count"])
+	s.Equal("bus:"+fc.Features[0].ID, fc.Features[1].ID)
+	s.Equal(true, fc.Features[1].Properties["bus"])
+}
+
+func (s *SQLDataSourceSuite) TestClusterMembers() {
+	mr, err := geo.ParseMapRequest("", "0,0,3,3", "2", "", "", "", "", "", "")
+	if !s.Nil(err) {
+		return
+	}
+	var members []interface{}
+	_, err = s.ds.RegisterLayer(context.Background(), geo.DefaultLayer, func(obj *Cluster) map[string]interface{} {
+		for _, member := range obj.ClusterData {
+			members = append(members, member.ID)
+		}
+		return map[string]interface{}{"name": obj.Properties["name"]}
+	})
+	if !s.Nil(err) {
+		return
+	}
+	fc := geo.NewFeatureCollection()
+	err = s.ds.LoadMapView(context.Background(), mr, fc)
+	if !s.Nil(err) || !s.Len(fc.Features, 1) || !s.Len(members, DefaultClusterMembers) {
+		return
+	}
+
+	cr, err := geo.ParseClusterMembersRequest(fc.Features[0].ID, "2", "0", "5", "", "", "", "")
+	if !s.Nil(err) {
+		return
+	}
+	fc = geo.NewFeatureCollection()
+	total, err := s.ds.LoadClusterMembers(context.Background(), cr, fc)
+	if !s.Nil(err) {
+		return
+	}
+	s.Equal(int64(len(s.objects)), total)
+	if !s.Len(fc.Features, 5) {
+		return
+	}
+	for i, feature := range fc.Features {
+		s.Equal(fmt.Sprint(members[i]), feature.ID)
+	}
+
+	cr.Filter, _ = geo.ParsePropertyFilter("name:Университет")
+	fc = geo.NewFeatureCollection()
+	total, err = s.ds.LoadClusterMembers(context.Background(), cr, fc)
+	if !s.Nil(err) {
+		return
+	}
+	s.Equal(int64(1), total)
+	s.Equal("Университет", fc.Features[0].Properties["name"])
+}
+
+func (s *SQLDataSourceSuite) TestPropertyFilter() {
+	for i, object := range s.objects {
+		object.Properties["line"] = float64(i%3 + 1)
+		object.Properties["metro"] = i%2 == 0
+		s.Require().Nil(s.ds.StoreGeoData(context.Background(), object))
+	}
+	for filter, expected := range map[string]int64{
+		"line:1":       80,
+		"line:1|3":     160,
+		"line:2..":     160,
+		"line:..1.5":   80,
+		"metro:true":   120,
+		"line:abc":     0,
+		"name:1..2":    0,
+		"missing:true": 0,
+	} {
+		mr, err := geo.ParseMapRequest("", "0,0,3,3", "2", "", "", "", "", filter, "")
+		s.Require().Nil(err)
+		fc := geo.NewFeatureCollection()
+		s.Require().Nil(s.ds.LoadMapView(context.Background(), mr, fc))
+		var total int64
+		for _, feature := range fc.Features {
+			total += feature.Properties["count"].(int64)
+		}
+		s.Equal(expected, total, filter)
+	}
+}
+
+func (s *SQLDataSourceSuite) TestWithinUnsupported() {
+	area := "POLYGON((55.7665 37.6010,55.7690 37.6150,55.7630 37.6390,55.7665 37.6010))"
+	mr, err := geo.ParseMapRequest("", "0,0,3,3", "2", "", "", "", area, "", "")
+	if !s.Nil(err) {
+		return
+	}
+	err = s.ds.LoadMapView(context.Background(), mr, geo.NewFeatureCollection())
+	s.ErrorIs(err, ErrWithinUnsupported)
+	// server responds 400 to it
+	s.ErrorIs(err, geo.ErrUnsupportedRequest)
+
+	cr, err := geo.ParseClusterMembersRequest("1", "2", "", "", "", "", area, "")
+	if !s.Nil(err) {
+		return
+	}
+	_, err = s.ds.LoadClusterMembers(context.Background(), cr, geo.NewFeatureCollection())
+	s.ErrorIs(err, geo.ErrUnsupportedRequest)
+}
+
+// TestAdaptiveOrder checks that tiles grouped by chosen depth are loaded in the same order every time
+func (s *SQLDataSourceSuite) TestAdaptiveOrder() {
+	var first []string
+	for i := 0; i < 10; i++ {
+		mr, err := geo.ParseMapRequest("", "308,159,311,162", "9", "", "", "auto:4", "", "", "")
+		s.Require().Nil(err)
+		fc := geo.NewFeatureCollection()
+		s.Require().Nil(s.ds.LoadMapView(context.Background(), mr, fc))
+		depths := make(map[int64]bool)
+		for tileID := range s.gs.MRToTiles(mr) {
+			depths[mr.TileClusterDepth(tileID)] = true
+		}
+		s.Require().Greater(len(depths), 1, "tiles have the same depth")
+		ids := make([]string, 0, len(fc.Features))
+		for _, feature := range fc.Features {
+			ids = append(ids, feature.ID)
+		}
+		if first == nil {
+			first = ids
+		}
+		s.Equal(first, ids)
+	}
+}
+
+func (s *SQLDataSourceSuite) TestCheckHealth() {
+	s.Nil(s.ds.CheckHealth(context.Background()))
+}
+
+// TestMaxZoom checks that clusters deeper than max zoom are clusters of max zoom
+func (s *SQLDataSourceSuite) TestMaxZoom() {
+	object := s.objects[0]
+	gpx, gpy := s.gs.Projection.ToGlobalPixels(object.Lat, object.Lon, 22)
+	tx, ty := s.gs.TileSystem.GlobalPixelsToTileXY(gpx, gpy)
+	mr, err := geo.ParseMapRequest("", fmt.Sprintf("%d,%d,%d,%d", tx, ty, tx, ty), "22", "", "", "4", "", "", "")
+	s.Require().Nil(err)
+	s.Require().Nil(s.gs.ValidateMapRequest(mr, 0))
+	fc := geo.NewFeatureCollection()
+	s.Require().Nil(s.ds.LoadMapView(context.Background(), mr, fc))
+	if s.Len(fc.Features, 1) {
+		s.Equal(int64(1), fc.Features[0].Properties["count"])
+	}
+}
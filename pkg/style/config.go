@@ -0,0 +1,99 @@
+package style
+
+import (
+	"encoding/json"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Config describes presentation of objects of every layer
+type Config struct {
+	Layers map[string]*LayerConfig `json:"layers" yaml:"layers"`
+}
+
+// LayerConfig is ordered list of rules. Every matching rule is applied
+// in turn, so fields of later rules override fields of former ones.
+// Aggregations of cluster are available in templates as .Aggregates.
+type LayerConfig struct {
+	Rules        []*RuleConfig         `json:"rules" yaml:"rules"`
+	Aggregations []*geo.Aggregation    `json:"aggregations,omitempty" yaml:"aggregations,omitempty"`
+	Placement    *geo.ClusterPlacement `json:"placement,omitempty" yaml:"placement,omitempty"`
+	// Pyramid enables precomputed clusters of layer
+	Pyramid bool `json:"pyramid,omitempty" yaml:"pyramid,omitempty"`
+}
+
+type RuleConfig struct {
+	Match *MatchConfig `json:"match,omitempty" yaml:"match,omitempty"`
+	// text/template of object contents
+	HintContent    *string `json:"hint_content,omitempty" yaml:"hint_content,omitempty"`
+	IconContent    *string `json:"icon_content,omitempty" yaml:"icon_content,omitempty"`
+	BalloonContent *string `json:"balloon_content,omitempty" yaml:"balloon_content,omitempty"`
+	// options of object
+	Preset      *string `json:"preset,omitempty" yaml:"preset,omitempty"`
+	FillColor   *string `json:"fill_color,omitempty" yaml:"fill_color,omitempty"`
+	StrokeColor *string `json:"stroke_color,omitempty" yaml:"stroke_color,omitempty"`
+	IconColor   *string `json:"icon_color,omitempty" yaml:"icon_color,omitempty"`
+}
+
+// MatchConfig selects objects by cluster size and properties.
+// Filter has the same syntax as filter parameter of map request.
+type MatchConfig struct {
+	MinCount *int64 `json:"min_count,omitempty" yaml:"min_count,omitempty"`
+	MaxCount *int64 `json:"max_count,omitempty" yaml:"max_count,omitempty"`
+	Filter   string `json:"filter,omitempty" yaml:"filter,omitempty"`
+}
+
+// LoadConfig reads config from YAML or JSON file depending on its extension
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(Config)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	default:
+		err = json.Unmarshal(data, cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func str(s string) *string {
+	return &s
+}
+
+func count(c int64) *int64 {
+	return &c
+}
+
+// DefaultConfig styles default layer only
+var DefaultConfig = &Config{
+	Layers: map[string]*LayerConfig{
+		geo.DefaultLayer: DefaultLayerConfig,
+	},
+}
+
+// DefaultLayerConfig renders names of stations and sizes of clusters
+var DefaultLayerConfig = &LayerConfig{
+	Rules: []*RuleConfig{
+		{
+			HintContent:    str("{{.ID}}"),
+			IconContent:    str(`{{default "" .Properties.name}}`),
+			BalloonContent: str(""),
+			Preset:         str("islands#blackStretchyIcon"),
+			FillColor:      str("rgba(27, 125, 27, 0.2)"),
+		},
+		{
+			Match:          &MatchConfig{MinCount: count(2)},
+			IconContent:    str("{{.Count}}"),
+			BalloonContent: str("{{range .Members}}{{default \"\" .Properties.name}}<br>\n{{end}}"),
+		},
+	},
+}
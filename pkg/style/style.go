@@ -0,0 +1,174 @@
+package style
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"text/template"
+)
+
+// Object is data available in templates
+type Object struct {
+	ID         int64
+	Count      int64
+	Properties map[string]interface{}
+	// Aggregates are values of layer aggregations, set for clusters only
+	Aggregates map[string]interface{}
+	Members    []*Object
+}
+
+// AddMember appends single object to members of cluster
+func (o *Object) AddMember(id int64, properties map[string]interface{}) {
+	o.Members = append(o.Members, &Object{ID: id, Count: 1, Properties: properties})
+}
+
+// Cluster is cluster of data source which can be rendered by style
+type Cluster interface {
+	StyleObject() *Object
+}
+
+// NewMapper makes properties mapper of data source with clusters of type C
+func NewMapper[C Cluster](s *Style) func(obj C) map[string]interface{} {
+	return func(obj C) map[string]interface{} {
+		return s.Apply(obj.StyleObject())
+	}
+}
+
+var funcs = template.FuncMap{
+	// default returns def if value is missing
+	"default": func(def, value interface{}) interface{} {
+		if value == nil {
+			return def
+		}
+		return value
+	},
+}
+
+type Style struct {
+	rules []*rule
+}
+
+type rule struct {
+	minCount *int64
+	maxCount *int64
+	filter   geo.PropertyFilter
+	contents map[string]*template.Template
+	options  map[string]string
+}
+
+// NewStyles compiles style of every layer in config
+func NewStyles(cfg *Config) (map[string]*Style, error) {
+	styles := make(map[string]*Style, len(cfg.Layers))
+	for name, layerCfg := range cfg.Layers {
+		s, err := NewStyle(layerCfg)
+		if err != nil {
+			return nil, fmt.Errorf("layer %s: %w", name, err)
+		}
+		styles[name] = s
+	}
+	return styles, nil
+}
+
+func NewStyle(cfg *LayerConfig) (*Style, error) {
+	for _, agg := range cfg.Aggregations {
+		err := agg.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Placement != nil {
+		err := cfg.Placement.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	s := &Style{rules: make([]*rule, 0, len(cfg.Rules))}
+	for i, rc := range cfg.Rules {
+		r := &rule{
+			contents: make(map[string]*template.Template),
+			options:  make(map[string]string),
+		}
+		if rc.Match != nil {
+			r.minCount = rc.Match.MinCount
+			r.maxCount = rc.Match.MaxCount
+			filter, err := geo.ParsePropertyFilter(rc.Match.Filter)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d filter: %w", i, err)
+			}
+			r.filter = filter
+		}
+		for key, text := range map[string]*string{
+			"hintContent":    rc.HintContent,
+			"iconContent":    rc.IconContent,
+			"balloonContent": rc.BalloonContent,
+		} {
+			if text == nil {
+				continue
+			}
+			t, err := template.New(key).Funcs(funcs).Option("missingkey=zero").Parse(*text)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+			r.contents[key] = t
+		}
+		for key, value := range map[string]*string{
+			"preset":      rc.Preset,
+			"fillColor":   rc.FillColor,
+			"strokeColor": rc.StrokeColor,
+			"iconColor":   rc.IconColor,
+		} {
+			if value != nil {
+				r.options[key] = *value
+			}
+		}
+		s.rules = append(s.rules, r)
+	}
+	return s, nil
+}
+
+// MustNewStyle is like NewStyle but panics if config is invalid
+func MustNewStyle(cfg *LayerConfig) *Style {
+	s, err := NewStyle(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (r *rule) match(obj *Object) bool {
+	if r.minCount != nil && obj.Count < *r.minCount {
+		return false
+	}
+	if r.maxCount != nil && obj.Count > *r.maxCount {
+		return false
+	}
+	return r.filter.Match(obj.Properties)
+}
+
+// Apply evaluates rules against object and returns feature properties.
+// Templates are checked on load, so error of execution is rendered
+// in place of the content to be noticed on the map.
+func (s *Style) Apply(obj *Object) map[string]interface{} {
+	props := make(map[string]interface{})
+	options := make(map[string]interface{})
+	var buf bytes.Buffer
+	for _, r := range s.rules {
+		if !r.match(obj) {
+			continue
+		}
+		for key, t := range r.contents {
+			buf.Reset()
+			err := t.Execute(&buf, obj)
+			if err != nil {
+				props[key] = err.Error()
+				continue
+			}
+			props[key] = buf.String()
+		}
+		for key, value := range r.options {
+			options[key] = value
+		}
+	}
+	props["options"] = options
+	return props
+}
@@ -0,0 +1,116 @@
+package style
+
+import (
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const yamlConfig = `
+layers:
+  metro:
+    rules:
+      - hint_content: "{{.ID}}"
+        icon_content: '{{default "?" .Properties.name}}'
+        preset: islands#blackStretchyIcon
+        fill_color: rgba(27, 125, 27, 0.2)
+      - match:
+          filter: line:3|4
+        preset: islands#blueStretchyIcon
+      - match:
+          min_count: 2
+        icon_content: "{{.Count}}"
+        balloon_content: "{{range .Members}}{{.Properties.name}};{{end}}"
+`
+
+func TestStyleSuite(t *testing.T) {
+	suite.Run(t, new(StyleSuite))
+}
+
+type StyleSuite struct {
+	suite.Suite
+	style *Style
+}
+
+func (s *StyleSuite) SetupTest() {
+	path := filepath.Join(s.T().TempDir(), "style.yaml")
+	s.Require().Nil(ioutil.WriteFile(path, []byte(yamlConfig), os.ModePerm))
+	cfg, err := LoadConfig(path)
+	s.Require().Nil(err)
+	styles, err := NewStyles(cfg)
+	s.Require().Nil(err)
+	s.Require().Contains(styles, "metro")
+	s.style = styles["metro"]
+}
+
+func (s *StyleSuite) TestApply() {
+	props := s.style.Apply(&Object{
+		ID:         7,
+		Count:      1,
+		Properties: map[string]interface{}{"name": "Университет", "line": 1.0},
+	})
+	s.Equal(map[string]interface{}{
+		"hintContent": "7",
+		"iconContent": "Университет",
+		"options": map[string]interface{}{
+			"preset":    "islands#blackStretchyIcon",
+			"fillColor": "rgba(27, 125, 27, 0.2)",
+		},
+	}, props)
+
+	props = s.style.Apply(&Object{
+		ID:         8,
+		Count:      2,
+		Properties: map[string]interface{}{"line": 3.0},
+		Members: []*Object{
+			{ID: 1, Count: 1, Properties: map[string]interface{}{"name": "Арбатская"}},
+			{ID: 2, Count: 1, Properties: map[string]interface{}{"name": "Смоленская"}},
+		},
+	})
+	s.Equal(map[string]interface{}{
+		"hintContent":    "8",
+		"iconContent":    "2",
+		"balloonContent": "Арбатская;Смоленская;",
+		"options": map[string]interface{}{
+			"preset":    "islands#blueStretchyIcon",
+			"fillColor": "rgba(27, 125, 27, 0.2)",
+		},
+	}, props)
+}
+
+// testCluster is cluster of some data source
+type testCluster struct {
+	id      int64
+	members []string
+}
+
+func (c *testCluster) StyleObject() *Object {
+	obj := &Object{ID: c.id, Count: int64(len(c.members)), Properties: map[string]interface{}{"line": 3.0}}
+	for i, name := range c.members {
+		obj.AddMember(int64(i+1), map[string]interface{}{"name": name})
+	}
+	return obj
+}
+
+func (s *StyleSuite) TestMapper() {
+	mapper := NewMapper[*testCluster](s.style)
+	props := mapper(&testCluster{id: 8, members: []string{"Арбатская", "Смоленская"}})
+	s.Equal("2", props["iconContent"])
+	s.Equal("Арбатская;Смоленская;", props["balloonContent"])
+}
+
+func (s *StyleSuite) TestDefaultStyle() {
+	st := MustNewStyle(DefaultLayerConfig)
+	props := st.Apply(&Object{ID: 1, Count: 1, Properties: map[string]interface{}{}})
+	s.Equal("", props["iconContent"])
+	s.Equal("", props["balloonContent"])
+}
+
+func (s *StyleSuite) TestInvalidConfig() {
+	_, err := NewStyle(&LayerConfig{Rules: []*RuleConfig{{IconContent: str("{{.Count")}}})
+	s.NotNil(err)
+	_, err = NewStyle(&LayerConfig{Rules: []*RuleConfig{{Match: &MatchConfig{Filter: "line"}}}})
+	s.NotNil(err)
+}
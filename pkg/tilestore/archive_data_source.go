@@ -0,0 +1,102 @@
+package tilestore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/twpayne/go-geom/encoding/geojson"
+	"strings"
+	"time"
+)
+
+// ErrArchiveUnsupported is returned for requests which need objects rather than rendered tiles
+var ErrArchiveUnsupported = fmt.Errorf("%w: tile archive has only rendered tiles", geo.ErrUnsupportedRequest)
+
+// ArchiveDataSource serves map requests from tiles of archive.
+// Tiles keep clusters made at export, so requested cluster depth is ignored.
+type ArchiveDataSource struct {
+	r      Reader
+	gs     *geo.GeographicSystem
+	layers map[string]bool
+}
+
+// NewArchiveDataSource checks that tiles of archive were cut with the same geographic system
+func NewArchiveDataSource(r Reader, gs *geo.GeographicSystem) (*ArchiveDataSource, error) {
+	meta := r.Metadata()
+	if meta.Format != GeoJSONFormat {
+		return nil, fmt.Errorf("unsupported tile format %q", meta.Format)
+	}
+	if meta.Fingerprint != gs.Config().Fingerprint() {
+		return nil, fmt.Errorf("tiles were cut with %s, geographic system has %s", meta.Fingerprint, gs.Config().Fingerprint())
+	}
+	layers := make(map[string]bool, len(meta.Layers))
+	for _, name := range meta.Layers {
+		layers[name] = true
+	}
+	return &ArchiveDataSource{r: r, gs: gs, layers: layers}, nil
+}
+
+func (a *ArchiveDataSource) Close() error {
+	return a.r.Close()
+}
+
+func (a *ArchiveDataSource) LoadMapView(ctx context.Context, mr *geo.MapRequest, fc *geo.FeatureCollection) error {
+	if mr.Within != nil || len(mr.Filter) > 0 {
+		return ErrArchiveUnsupported
+	}
+	requested := make(map[string]bool)
+	for _, name := range mr.LayerNames() {
+		if !a.layers[name] {
+			return fmt.Errorf("%w %q", geo.ErrUnknownLayer, name)
+		}
+		requested[name] = true
+	}
+	meta := a.r.Metadata()
+	if mr.Zoom < meta.MinZoom || mr.Zoom > meta.MaxZoom {
+		return nil
+	}
+	return mr.IterateTiles(func(x, y int64) error {
+		start := time.Now()
+		data, err := a.r.ReadTile(ctx, mr.Zoom, x, y)
+		if err != nil || data == nil {
+			return err
+		}
+		var tile geojson.FeatureCollection
+		err = json.Unmarshal(data, &tile)
+		if err != nil {
+			return fmt.Errorf("tile %d/%d/%d: %w", mr.Zoom, x, y, err)
+		}
+		for _, feature := range tile.Features {
+			if !requested[featureLayer(feature.ID)] {
+				continue
+			}
+			err = fc.Add(feature.ID, feature.Geometry, feature.Properties)
+			if err != nil {
+				return fmt.Errorf("tile %d/%d/%d: %w", mr.Zoom, x, y, err)
+			}
+		}
+		mr.DebugInfo.AddLoad([]int64{a.gs.QuadKeySystem.TileXYToQuadKey(x, y, mr.Zoom).Int64()}, time.Since(start))
+		return nil
+	})
+}
+
+// featureLayer is layer of feature id made by geo.LayerFeatureID
+func featureLayer(id string) string {
+	if i := strings.IndexByte(id, ':'); i >= 0 {
+		return id[:i]
+	}
+	return geo.DefaultLayer
+}
+
+func (a *ArchiveDataSource) LoadNearby(ctx context.Context, nr *geo.NearbyRequest, fc *geo.FeatureCollection) error {
+	return ErrArchiveUnsupported
+}
+
+func (a *ArchiveDataSource) LoadClusterMembers(ctx context.Context, cr *geo.ClusterMembersRequest, fc *geo.FeatureCollection) (int64, error) {
+	return 0, ErrArchiveUnsupported
+}
+
+func (a *ArchiveDataSource) StoreGeoData(ctx context.Context, d interface{}) error {
+	return ErrArchiveUnsupported
+}
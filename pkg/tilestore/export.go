@@ -0,0 +1,106 @@
+package tilestore
+
+import (
+	"context"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+)
+
+// ExportOptions define tiles rendered by Export
+type ExportOptions struct {
+	MinZoom int64
+	MaxZoom int64
+	// Bounds restrict exported tiles in lat,lon order, zero bounds mean whole world
+	Bounds       geo.BBox
+	ClusterDepth int64
+	// Layers put into every tile, empty means default layer
+	Layers []string
+}
+
+type ExportStats struct {
+	Tiles    int64
+	Features int64
+}
+
+func (o *ExportOptions) bounds() geo.BBox {
+	if o.Bounds == (geo.BBox{}) {
+		return geo.BBox{XMin: -geo.EGS3857MaxLat, XMax: geo.EGS3857MaxLat, YMin: geo.MinLon, YMax: geo.MaxLon}
+	}
+	return o.Bounds
+}
+
+func (o *ExportOptions) layers() []string {
+	mr := geo.MapRequest{Layers: o.Layers}
+	return mr.LayerNames()
+}
+
+// Metadata describes archive of exported tiles
+func (o *ExportOptions) Metadata(name string, gs *geo.GeographicSystem) *Metadata {
+	return &Metadata{
+		Name:         name,
+		Format:       GeoJSONFormat,
+		MinZoom:      o.MinZoom,
+		MaxZoom:      o.MaxZoom,
+		Bounds:       o.bounds(),
+		ClusterDepth: o.ClusterDepth,
+		Layers:       o.layers(),
+		Fingerprint:  gs.Config().Fingerprint(),
+	}
+}
+
+// Export renders tiles with LoadMapView zoom by zoom and writes non-empty tiles to w.
+// Tiles of next zoom are children of non-empty tiles, objects of empty tile can not appear
+// in its children, so empty areas are skipped at once.
+func Export(ctx context.Context, ds geo.DataSource, gs *geo.GeographicSystem, w Writer, opts *ExportOptions) (*ExportStats, error) {
+	stats := new(ExportStats)
+	bounds := opts.bounds()
+	tiles := make([]geo.Tile, 0)
+	tileBBox := gs.BBoxToTileBBox(bounds, opts.MinZoom)
+	_ = tileBBox.IterateTiles(func(x, y int64) error {
+		tiles = append(tiles, geo.Tile{X: x, Y: y, Zoom: opts.MinZoom})
+		return nil
+	})
+	for zoom := opts.MinZoom; zoom <= opts.MaxZoom && len(tiles) > 0; zoom++ {
+		next := make([]geo.Tile, 0)
+		nextBBox := gs.BBoxToTileBBox(bounds, zoom+1)
+		for _, tile := range tiles {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			mr := &geo.MapRequest{
+				TileBBox:     geo.TileBBox{TileXMin: tile.X, TileXMax: tile.X, TileYMin: tile.Y, TileYMax: tile.Y},
+				Zoom:         zoom,
+				ClusterDepth: opts.ClusterDepth,
+				Layers:       opts.Layers,
+			}
+			fc := geo.NewFeatureCollection()
+			err := ds.LoadMapView(ctx, mr, fc)
+			if err != nil {
+				return nil, err
+			}
+			if len(fc.Features) == 0 {
+				continue
+			}
+			data, err := fc.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			err = w.WriteTile(ctx, zoom, tile.X, tile.Y, data)
+			if err != nil {
+				return nil, err
+			}
+			stats.Tiles++
+			stats.Features += int64(len(fc.Features))
+			for _, child := range []geo.Tile{
+				{X: 2 * tile.X, Y: 2 * tile.Y}, {X: 2*tile.X + 1, Y: 2 * tile.Y},
+				{X: 2 * tile.X, Y: 2*tile.Y + 1}, {X: 2*tile.X + 1, Y: 2*tile.Y + 1},
+			} {
+				if child.X >= nextBBox.TileXMin && child.X <= nextBBox.TileXMax && child.Y >= nextBBox.TileYMin && child.Y <= nextBBox.TileYMax {
+					child.Zoom = zoom + 1
+					next = append(next, child)
+				}
+			}
+		}
+		tiles = next
+	}
+	return stats, nil
+}
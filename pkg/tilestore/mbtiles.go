@@ -0,0 +1,179 @@
+package tilestore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	_ "modernc.org/sqlite"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MBTiles rows are numbered from south, see https://github.com/mapbox/mbtiles-spec
+const mbtilesSchema = `
+CREATE TABLE metadata (name TEXT, value TEXT);
+CREATE UNIQUE INDEX metadata_name ON metadata (name);
+CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB);
+CREATE UNIQUE INDEX tile_index ON tiles (zoom_level, tile_column, tile_row);
+`
+
+func tileRow(zoom, y int64) int64 {
+	return int64(1)<<zoom - 1 - y
+}
+
+type mbtilesWriter struct {
+	db   *sql.DB
+	tx   *sql.Tx
+	meta *Metadata
+}
+
+func createMBTiles(path string, meta *Metadata) (*mbtilesWriter, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(mbtilesSchema)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	// single transaction makes bulk insert fast
+	tx, err := db.Begin()
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &mbtilesWriter{db: db, tx: tx, meta: meta}, nil
+}
+
+func (w *mbtilesWriter) WriteTile(ctx context.Context, zoom, x, y int64, data []byte) error {
+	_, err := w.tx.ExecContext(ctx, "INSERT INTO tiles (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)",
+		zoom, x, tileRow(zoom, y), data)
+	return err
+}
+
+func (w *mbtilesWriter) Close() error {
+	m := w.meta
+	lat, lon := boundsCenter(m.Bounds)
+	rows := map[string]string{
+		"name":              m.Name,
+		"format":            m.Format,
+		"type":              "overlay",
+		"minzoom":           strconv.FormatInt(m.MinZoom, 10),
+		"maxzoom":           strconv.FormatInt(m.MaxZoom, 10),
+		"bounds":            fmt.Sprintf("%v,%v,%v,%v", m.Bounds.YMin, m.Bounds.XMin, m.Bounds.YMax, m.Bounds.XMax),
+		"center":            fmt.Sprintf("%v,%v,%d", lon, lat, m.MinZoom),
+		"geo_cluster_depth": strconv.FormatInt(m.ClusterDepth, 10),
+		"geo_layers":        strings.Join(m.Layers, ","),
+		"geo_fingerprint":   m.Fingerprint,
+	}
+	for name, value := range rows {
+		_, err := w.tx.Exec("INSERT INTO metadata (name, value) VALUES (?, ?)", name, value)
+		if err != nil {
+			_ = w.tx.Rollback()
+			_ = w.db.Close()
+			return err
+		}
+	}
+	err := w.tx.Commit()
+	if err != nil {
+		_ = w.db.Close()
+		return err
+	}
+	return w.db.Close()
+}
+
+type mbtilesReader struct {
+	db   *sql.DB
+	meta *Metadata
+}
+
+func openMBTiles(path string) (*mbtilesReader, error) {
+	// driver creates missing database file
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := readMBTilesMetadata(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("%s metadata: %w", path, err)
+	}
+	return &mbtilesReader{db: db, meta: meta}, nil
+}
+
+func readMBTilesMetadata(db *sql.DB) (*Metadata, error) {
+	rows, err := db.Query("SELECT name, value FROM metadata")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	values := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		err = rows.Scan(&name, &value)
+		if err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	meta := &Metadata{
+		Name:        values["name"],
+		Format:      values["format"],
+		Fingerprint: values["geo_fingerprint"],
+	}
+	if values["geo_layers"] != "" {
+		meta.Layers = strings.Split(values["geo_layers"], ",")
+	}
+	for key, dest := range map[string]*int64{"minzoom": &meta.MinZoom, "maxzoom": &meta.MaxZoom, "geo_cluster_depth": &meta.ClusterDepth} {
+		if values[key] == "" {
+			continue
+		}
+		*dest, err = strconv.ParseInt(values[key], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	if values["bounds"] != "" {
+		var b [4]float64
+		parts := strings.Split(values["bounds"], ",")
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("invalid bounds %q", values["bounds"])
+		}
+		for i, part := range parts {
+			b[i], err = strconv.ParseFloat(part, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bounds: %w", err)
+			}
+		}
+		meta.Bounds.YMin, meta.Bounds.XMin, meta.Bounds.YMax, meta.Bounds.XMax = b[0], b[1], b[2], b[3]
+	}
+	return meta, nil
+}
+
+func (r *mbtilesReader) Metadata() *Metadata {
+	return r.meta
+}
+
+func (r *mbtilesReader) ReadTile(ctx context.Context, zoom, x, y int64) ([]byte, error) {
+	var data []byte
+	err := r.db.QueryRowContext(ctx, "SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?",
+		zoom, x, tileRow(zoom, y)).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (r *mbtilesReader) Close() error {
+	return r.db.Close()
+}
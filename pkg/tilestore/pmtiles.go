@@ -0,0 +1,532 @@
+package tilestore
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// PMTiles version 3, see https://github.com/protomaps/PMTiles/blob/main/spec/v3/spec.md
+const (
+	pmtilesMagic      = "PMTiles"
+	pmtilesVersion    = 3
+	pmtilesHeaderSize = 127
+	// header and root directory must fit into first 16 KiB
+	pmtilesMaxRootSize = 16384 - pmtilesHeaderSize
+	pmtilesLeafSize    = 4096
+	// leaves of leaves are never written, so reader follows at most one leaf
+	pmtilesMaxDepth = 3
+)
+
+// compression and tile type codes of header
+const (
+	compressionNone = 1
+	compressionGzip = 2
+	tileTypeUnknown = 0
+)
+
+var errInvalidPMTiles = errors.New("invalid pmtiles archive")
+
+// pmtilesEntry addresses RunLength tiles starting at TileID with the same data,
+// entry with zero RunLength points to leaf directory
+type pmtilesEntry struct {
+	TileID    uint64
+	Offset    uint64
+	Length    uint64
+	RunLength uint64
+}
+
+// pmtilesMetadata is JSON metadata of archive, zooms and bounds are stored in header
+type pmtilesMetadata struct {
+	Name         string   `json:"name"`
+	Format       string   `json:"format"`
+	ClusterDepth int64    `json:"geo_cluster_depth"`
+	Layers       []string `json:"geo_layers"`
+	Fingerprint  string   `json:"geo_fingerprint"`
+}
+
+// zxyToTileID numbers tiles of all zooms along Hilbert curves of every zoom
+func zxyToTileID(zoom, x, y int64) uint64 {
+	id := (uint64(1)<<(2*uint64(zoom)) - 1) / 3
+	n := uint64(1) << uint64(zoom)
+	tx, ty := uint64(x), uint64(y)
+	for s := n / 2; s > 0; s /= 2 {
+		var rx, ry uint64
+		if tx&s > 0 {
+			rx = 1
+		}
+		if ty&s > 0 {
+			ry = 1
+		}
+		id += s * s * ((3 * rx) ^ ry)
+		if ry == 0 {
+			if rx == 1 {
+				tx = n - 1 - tx
+				ty = n - 1 - ty
+			}
+			tx, ty = ty, tx
+		}
+	}
+	return id
+}
+
+type pmtilesWriter struct {
+	path string
+	meta *Metadata
+	// data keeps unique tiles in order of writing until Close sorts them by tile id
+	data    *os.File
+	size    uint64
+	entries []pmtilesEntry
+	// offsets of written tiles by hash of their data
+	offsets     map[[sha256.Size]byte]uint64
+	maxRootSize int
+}
+
+func createPMTiles(path string, meta *Metadata) (*pmtilesWriter, error) {
+	data, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &pmtilesWriter{
+		path:        path,
+		meta:        meta,
+		data:        data,
+		offsets:     make(map[[sha256.Size]byte]uint64),
+		maxRootSize: pmtilesMaxRootSize,
+	}, nil
+}
+
+func (w *pmtilesWriter) WriteTile(ctx context.Context, zoom, x, y int64, data []byte) error {
+	compressed, err := gzipBytes(data)
+	if err != nil {
+		return err
+	}
+	entry := pmtilesEntry{TileID: zxyToTileID(zoom, x, y), Length: uint64(len(compressed)), RunLength: 1}
+	hash := sha256.Sum256(compressed)
+	offset, ok := w.offsets[hash]
+	if !ok {
+		_, err = w.data.Write(compressed)
+		if err != nil {
+			return err
+		}
+		offset = w.size
+		w.offsets[hash] = offset
+		w.size += entry.Length
+	}
+	entry.Offset = offset
+	w.entries = append(w.entries, entry)
+	return nil
+}
+
+func (w *pmtilesWriter) Close() error {
+	defer func() {
+		_ = w.data.Close()
+		_ = os.Remove(w.data.Name())
+	}()
+	err := w.write()
+	if err != nil {
+		_ = os.Remove(w.path)
+	}
+	return err
+}
+
+func (w *pmtilesWriter) write() error {
+	sort.Slice(w.entries, func(i, j int) bool { return w.entries[i].TileID < w.entries[j].TileID })
+	// tile data is rewritten in tile id order, so archive is clustered
+	moved := make(map[uint64]uint64, len(w.offsets))
+	unique := make([]pmtilesEntry, 0, len(w.offsets))
+	entries := make([]pmtilesEntry, 0, len(w.entries))
+	var tilesLength uint64
+	for _, entry := range w.entries {
+		offset, ok := moved[entry.Offset]
+		if !ok {
+			offset = tilesLength
+			moved[entry.Offset] = offset
+			unique = append(unique, entry)
+			tilesLength += entry.Length
+		}
+		entry.Offset = offset
+		last := len(entries) - 1
+		if last >= 0 && entries[last].Offset == offset && entries[last].TileID+entries[last].RunLength == entry.TileID {
+			entries[last].RunLength++
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	root, leaves, err := buildDirectories(entries, w.maxRootSize)
+	if err != nil {
+		return err
+	}
+	metadata, err := json.Marshal(&pmtilesMetadata{
+		Name:         w.meta.Name,
+		Format:       w.meta.Format,
+		ClusterDepth: w.meta.ClusterDepth,
+		Layers:       w.meta.Layers,
+		Fingerprint:  w.meta.Fingerprint,
+	})
+	if err != nil {
+		return err
+	}
+	metadata, err = gzipBytes(metadata)
+	if err != nil {
+		return err
+	}
+
+	var addressed uint64
+	for _, entry := range entries {
+		addressed += entry.RunLength
+	}
+	header := make([]byte, pmtilesHeaderSize)
+	copy(header, pmtilesMagic)
+	header[7] = pmtilesVersion
+	sections := []uint64{
+		pmtilesHeaderSize, uint64(len(root)),
+		pmtilesHeaderSize + uint64(len(root)), uint64(len(metadata)),
+		pmtilesHeaderSize + uint64(len(root)+len(metadata)), uint64(len(leaves)),
+		pmtilesHeaderSize + uint64(len(root)+len(metadata)+len(leaves)), tilesLength,
+		addressed, uint64(len(entries)), uint64(len(unique)),
+	}
+	for i, value := range sections {
+		binary.LittleEndian.PutUint64(header[8+8*i:], value)
+	}
+	header[96] = 1 // clustered
+	header[97] = compressionGzip
+	header[98] = compressionGzip
+	header[99] = tileTypeUnknown
+	header[100] = uint8(w.meta.MinZoom)
+	header[101] = uint8(w.meta.MaxZoom)
+	b := w.meta.Bounds
+	lat, lon := boundsCenter(b)
+	for i, value := range []float64{b.YMin, b.XMin, b.YMax, b.XMax} {
+		binary.LittleEndian.PutUint32(header[102+4*i:], uint32(int32(math.Round(value*1e7))))
+	}
+	header[118] = uint8(w.meta.MinZoom)
+	binary.LittleEndian.PutUint32(header[119:], uint32(int32(math.Round(lon*1e7))))
+	binary.LittleEndian.PutUint32(header[123:], uint32(int32(math.Round(lat*1e7))))
+
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	err = writePMTiles(f, w.data, [][]byte{header, root, metadata, leaves}, unique)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writePMTiles writes sections followed by tiles copied from data
+func writePMTiles(f *os.File, data *os.File, sections [][]byte, tiles []pmtilesEntry) error {
+	out := bufio.NewWriter(f)
+	for _, section := range sections {
+		_, err := out.Write(section)
+		if err != nil {
+			return err
+		}
+	}
+	for _, tile := range tiles {
+		_, err := io.Copy(out, io.NewSectionReader(data, int64(tile.Offset), int64(tile.Length)))
+		if err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// buildDirectories puts entries into root directory, or into leaves addressed by root if it is too big
+func buildDirectories(entries []pmtilesEntry, maxRootSize int) (root []byte, leaves []byte, err error) {
+	root, err = serializeDirectory(entries)
+	if err != nil || len(root) <= maxRootSize {
+		return root, nil, err
+	}
+	for leafSize := pmtilesLeafSize; ; leafSize *= 2 {
+		leaves = leaves[:0]
+		rootEntries := make([]pmtilesEntry, 0, len(entries)/leafSize+1)
+		for i := 0; i < len(entries); i += leafSize {
+			end := i + leafSize
+			if end > len(entries) {
+				end = len(entries)
+			}
+			leaf, err := serializeDirectory(entries[i:end])
+			if err != nil {
+				return nil, nil, err
+			}
+			rootEntries = append(rootEntries, pmtilesEntry{TileID: entries[i].TileID, Offset: uint64(len(leaves)), Length: uint64(len(leaf))})
+			leaves = append(leaves, leaf...)
+		}
+		root, err = serializeDirectory(rootEntries)
+		if err != nil || len(root) <= maxRootSize {
+			return root, leaves, err
+		}
+	}
+}
+
+// serializeDirectory writes columns of entries as varints, offset of entry following the previous one is 0
+func serializeDirectory(entries []pmtilesEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	varint := make([]byte, binary.MaxVarintLen64)
+	put := func(v uint64) {
+		buf.Write(varint[:binary.PutUvarint(varint, v)])
+	}
+	put(uint64(len(entries)))
+	var lastID uint64
+	for _, e := range entries {
+		put(e.TileID - lastID)
+		lastID = e.TileID
+	}
+	for _, e := range entries {
+		put(e.RunLength)
+	}
+	for _, e := range entries {
+		put(e.Length)
+	}
+	for i, e := range entries {
+		if i > 0 && e.Offset == entries[i-1].Offset+entries[i-1].Length {
+			put(0)
+		} else {
+			put(e.Offset + 1)
+		}
+	}
+	return gzipBytes(buf.Bytes())
+}
+
+func deserializeDirectory(data []byte) ([]pmtilesEntry, error) {
+	r := bytes.NewReader(data)
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	// every entry takes 4 bytes at least
+	if n > uint64(len(data))/4 {
+		return nil, errInvalidPMTiles
+	}
+	entries := make([]pmtilesEntry, n)
+	var lastID uint64
+	for i := range entries {
+		delta, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		lastID += delta
+		entries[i].TileID = lastID
+	}
+	for i := range entries {
+		entries[i].RunLength, err = binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := range entries {
+		entries[i].Length, err = binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := range entries {
+		offset, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if offset == 0 && i > 0 {
+			entries[i].Offset = entries[i-1].Offset + entries[i-1].Length
+		} else {
+			entries[i].Offset = offset - 1
+		}
+	}
+	return entries, nil
+}
+
+// findEntry returns entry of the last tile id not greater than id
+func findEntry(entries []pmtilesEntry, id uint64) (pmtilesEntry, bool) {
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].TileID > id })
+	if i == 0 {
+		return pmtilesEntry{}, false
+	}
+	return entries[i-1], true
+}
+
+type pmtilesReader struct {
+	f    *os.File
+	meta *Metadata
+	root []pmtilesEntry
+	// offsets of sections from header
+	leavesOffset        uint64
+	tilesOffset         uint64
+	internalCompression uint8
+	tileCompression     uint8
+	mu                  sync.Mutex
+	leaves              map[uint64][]pmtilesEntry
+}
+
+func openPMTiles(path string) (*pmtilesReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := readPMTiles(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+func readPMTiles(f *os.File) (*pmtilesReader, error) {
+	header := make([]byte, pmtilesHeaderSize)
+	_, err := f.ReadAt(header, 0)
+	if err != nil {
+		return nil, err
+	}
+	if string(header[:7]) != pmtilesMagic || header[7] != pmtilesVersion {
+		return nil, errInvalidPMTiles
+	}
+	u64 := func(i int) uint64 {
+		return binary.LittleEndian.Uint64(header[8+8*i:])
+	}
+	e7 := func(offset int) float64 {
+		return float64(int32(binary.LittleEndian.Uint32(header[offset:]))) / 1e7
+	}
+	r := &pmtilesReader{
+		f:                   f,
+		leavesOffset:        u64(4),
+		tilesOffset:         u64(6),
+		internalCompression: header[97],
+		tileCompression:     header[98],
+		leaves:              make(map[uint64][]pmtilesEntry),
+	}
+	root, err := r.readSection(u64(0), u64(1), r.internalCompression)
+	if err != nil {
+		return nil, err
+	}
+	r.root, err = deserializeDirectory(root)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := r.readSection(u64(2), u64(3), r.internalCompression)
+	if err != nil {
+		return nil, err
+	}
+	var pm pmtilesMetadata
+	if len(metadata) > 0 {
+		err = json.Unmarshal(metadata, &pm)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.meta = &Metadata{
+		Name:         pm.Name,
+		Format:       pm.Format,
+		MinZoom:      int64(header[100]),
+		MaxZoom:      int64(header[101]),
+		Bounds:       geo.BBox{XMin: e7(106), XMax: e7(114), YMin: e7(102), YMax: e7(110)},
+		ClusterDepth: pm.ClusterDepth,
+		Layers:       pm.Layers,
+		Fingerprint:  pm.Fingerprint,
+	}
+	return r, nil
+}
+
+func (r *pmtilesReader) readSection(offset, length uint64, compression uint8) ([]byte, error) {
+	data := make([]byte, length)
+	_, err := r.f.ReadAt(data, int64(offset))
+	if err != nil {
+		return nil, err
+	}
+	switch compression {
+	case compressionNone:
+		return data, nil
+	case compressionGzip:
+		return gunzipBytes(data)
+	}
+	return nil, fmt.Errorf("unsupported pmtiles compression %d", compression)
+}
+
+func (r *pmtilesReader) leaf(entry pmtilesEntry) ([]pmtilesEntry, error) {
+	r.mu.Lock()
+	entries, ok := r.leaves[entry.Offset]
+	r.mu.Unlock()
+	if ok {
+		return entries, nil
+	}
+	data, err := r.readSection(r.leavesOffset+entry.Offset, entry.Length, r.internalCompression)
+	if err != nil {
+		return nil, err
+	}
+	entries, err = deserializeDirectory(data)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.leaves[entry.Offset] = entries
+	r.mu.Unlock()
+	return entries, nil
+}
+
+func (r *pmtilesReader) Metadata() *Metadata {
+	return r.meta
+}
+
+func (r *pmtilesReader) ReadTile(ctx context.Context, zoom, x, y int64) ([]byte, error) {
+	id := zxyToTileID(zoom, x, y)
+	entries := r.root
+	for depth := 0; depth < pmtilesMaxDepth; depth++ {
+		entry, ok := findEntry(entries, id)
+		if !ok {
+			return nil, nil
+		}
+		if entry.RunLength > 0 {
+			if id >= entry.TileID+entry.RunLength {
+				return nil, nil
+			}
+			return r.readSection(r.tilesOffset+entry.Offset, entry.Length, r.tileCompression)
+		}
+		var err error
+		entries, err = r.leaf(entry)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, errInvalidPMTiles
+}
+
+func (r *pmtilesReader) Close() error {
+	return r.f.Close()
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipBytes(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
@@ -0,0 +1,77 @@
+// Package tilestore writes map tiles rendered by data source into MBTiles or PMTiles archives
+// and serves map requests from such archives without database.
+package tilestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GeoJSONFormat is media type of tiles, every tile is FeatureCollection of features of all exported layers.
+// It is the only format, Yandex ROM responses are served from tiles as is.
+const GeoJSONFormat = "application/geo+json"
+
+var ErrUnknownFormat = errors.New("unknown tile archive format, .mbtiles or .pmtiles expected")
+
+// Metadata describes tiles of archive
+type Metadata struct {
+	Name    string
+	Format  string
+	MinZoom int64
+	MaxZoom int64
+	// Bounds of exported area in lat,lon order
+	Bounds       geo.BBox
+	ClusterDepth int64
+	Layers       []string
+	// Fingerprint of geographic system config tiles were cut with
+	Fingerprint string
+}
+
+// Writer puts tiles into archive which becomes readable after Close
+type Writer interface {
+	WriteTile(ctx context.Context, zoom, x, y int64, data []byte) error
+	Close() error
+}
+
+// Reader returns tiles of archive, it is safe for concurrent use
+type Reader interface {
+	Metadata() *Metadata
+	// ReadTile returns nil data if archive has no such tile
+	ReadTile(ctx context.Context, zoom, x, y int64) ([]byte, error)
+	Close() error
+}
+
+// Create makes new archive of format chosen by file extension, existing file is never overwritten
+func Create(path string, meta *Metadata) (Writer, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("%s already exists", path)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mbtiles":
+		return createMBTiles(path, meta)
+	case ".pmtiles":
+		return createPMTiles(path, meta)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// Open opens archive of format chosen by file extension
+func Open(path string) (Reader, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mbtiles":
+		return openMBTiles(path)
+	case ".pmtiles":
+		return openPMTiles(path)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// boundsCenter returns center of bounds in lat,lon order
+func boundsCenter(b geo.BBox) (lat, lon float64) {
+	return (b.XMin + b.XMax) / 2, (b.YMin + b.YMax) / 2
+}
@@ -0,0 +1,191 @@
+package tilestore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ai-zelenin/geo-host/pkg/geo"
+	"github.com/ai-zelenin/geo-host/pkg/memds"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestTileStoreSuite(t *testing.T) {
+	suite.Run(t, new(TileStoreSuite))
+}
+
+type TileStoreSuite struct {
+	suite.Suite
+	gs  *geo.GeographicSystem
+	dir string
+}
+
+func (s *TileStoreSuite) SetupTest() {
+	s.gs = geo.NewGeographicSystem(geo.DefaultGeoSystemConfig)
+	s.dir = s.T().TempDir()
+}
+
+func (s *TileStoreSuite) metadata() *Metadata {
+	opts := &ExportOptions{MinZoom: 2, MaxZoom: 12, Bounds: geo.BBox{XMin: 55.5, XMax: 56, YMin: 37.3, YMax: 37.9}, ClusterDepth: 1}
+	return opts.Metadata("metro", s.gs)
+}
+
+func (s *TileStoreSuite) TestTileID() {
+	s.Equal(uint64(0), zxyToTileID(0, 0, 0))
+	s.Equal([]uint64{1, 2, 3, 4}, []uint64{zxyToTileID(1, 0, 0), zxyToTileID(1, 0, 1), zxyToTileID(1, 1, 1), zxyToTileID(1, 1, 0)})
+	s.Equal(uint64(5), zxyToTileID(2, 0, 0))
+	// ids of zoom follow ids of all previous zooms without gaps
+	seen := make(map[uint64]bool)
+	for x := int64(0); x < 8; x++ {
+		for y := int64(0); y < 8; y++ {
+			id := zxyToTileID(3, x, y)
+			s.True(id >= 21 && id < 85, id)
+			s.False(seen[id])
+			seen[id] = true
+		}
+	}
+}
+
+func (s *TileStoreSuite) TestRoundTrip() {
+	for _, name := range []string{"tiles.mbtiles", "tiles.pmtiles"} {
+		path := filepath.Join(s.dir, name)
+		w, err := Create(path, s.metadata())
+		s.Require().Nil(err)
+		// tiles with the same data are stored once
+		for x := int64(0); x < 64; x++ {
+			for y := int64(0); y < 64; y++ {
+				s.Require().Nil(w.WriteTile(context.Background(), 6, x, y, []byte(fmt.Sprintf("tile %d", (x+y)%5))))
+			}
+		}
+		s.Require().Nil(w.WriteTile(context.Background(), 2, 1, 3, []byte("first")))
+		s.Require().Nil(w.Close())
+		_, err = Create(path, s.metadata())
+		s.Error(err, name)
+
+		r, err := Open(path)
+		s.Require().Nil(err)
+		s.Equal(s.metadata(), r.Metadata(), name)
+		data, err := r.ReadTile(context.Background(), 6, 10, 7)
+		s.Nil(err)
+		s.Equal("tile 2", string(data), name)
+		data, err = r.ReadTile(context.Background(), 2, 1, 3)
+		s.Nil(err)
+		s.Equal("first", string(data), name)
+		data, err = r.ReadTile(context.Background(), 2, 1, 2)
+		s.Nil(err)
+		s.Nil(data, name)
+		s.Nil(r.Close())
+	}
+	_, err := Create(filepath.Join(s.dir, "tiles.zip"), s.metadata())
+	s.ErrorIs(err, ErrUnknownFormat)
+}
+
+func (s *TileStoreSuite) TestPMTilesLeafDirectories() {
+	path := filepath.Join(s.dir, "leaves.pmtiles")
+	w, err := createPMTiles(path, s.metadata())
+	s.Require().Nil(err)
+	w.maxRootSize = 64
+	for x := int64(0); x < 128; x++ {
+		for y := int64(0); y < 128; y++ {
+			s.Require().Nil(w.WriteTile(context.Background(), 7, x, y, []byte(fmt.Sprintf("%d/%d", x, y))))
+		}
+	}
+	s.Require().Nil(w.Close())
+
+	r, err := openPMTiles(path)
+	s.Require().Nil(err)
+	defer r.Close()
+	s.Len(r.root, 4)
+	for _, xy := range [][2]int64{{0, 0}, {127, 127}, {64, 3}, {5, 100}} {
+		data, err := r.ReadTile(context.Background(), 7, xy[0], xy[1])
+		s.Nil(err)
+		s.Equal(fmt.Sprintf("%d/%d", xy[0], xy[1]), string(data))
+	}
+	data, err := r.ReadTile(context.Background(), 8, 0, 0)
+	s.Nil(err)
+	s.Nil(data)
+}
+
+func (s *TileStoreSuite) TestExport() {
+	mapper := func(obj *memds.Cluster) map[string]interface{} {
+		return map[string]interface{}{"count": obj.Count}
+	}
+	ds := memds.NewMemoryDataSource(s.gs, mapper)
+	data, err := ioutil.ReadFile("../../metro.json")
+	s.Require().Nil(err)
+	objects := make([]*memds.GeoObject, 0)
+	s.Require().Nil(json.Unmarshal(data, &objects))
+	for _, object := range objects {
+		s.Require().Nil(ds.StoreGeoData(context.Background(), object))
+	}
+	ds.RegisterLayer("bus", mapper)
+	s.Require().Nil(ds.StoreLayerData(context.Background(), "bus", &memds.GeoObject{Lat: 55.75, Lon: 37.61}))
+
+	opts := &ExportOptions{MinZoom: 0, MaxZoom: 10, ClusterDepth: 2, Layers: []string{geo.DefaultLayer, "bus"}}
+	for _, name := range []string{"metro.mbtiles", "metro.pmtiles"} {
+		path := filepath.Join(s.dir, name)
+		w, err := Create(path, opts.Metadata("metro", s.gs))
+		s.Require().Nil(err)
+		stats, err := Export(context.Background(), ds, s.gs, w, opts)
+		s.Require().Nil(err)
+		s.Require().Nil(w.Close())
+		// every zoom has at least one tile
+		s.LessOrEqual(int64(11), stats.Tiles, name)
+
+		r, err := Open(path)
+		s.Require().Nil(err)
+		ads, err := NewArchiveDataSource(r, s.gs)
+		s.Require().Nil(err)
+		for _, layers := range []string{"", "bus", "default,bus"} {
+			mr, err := geo.ParseMapRequest("", "308,159,311,162", "9", "", "", "2", "", "", layers)
+			s.Require().Nil(err)
+			expected := geo.NewFeatureCollection()
+			s.Require().Nil(ds.LoadMapView(context.Background(), mr, expected))
+			fc := geo.NewFeatureCollection()
+			s.Require().Nil(ads.LoadMapView(context.Background(), mr, fc))
+			s.Equal(featureIDs(expected), featureIDs(fc), name, layers)
+		}
+
+		mr, err := geo.ParseMapRequest("", "0,0,1,1", "11", "", "", "", "", "", "")
+		s.Require().Nil(err)
+		fc := geo.NewFeatureCollection()
+		s.Nil(ads.LoadMapView(context.Background(), mr, fc))
+		s.Len(fc.Features, 0)
+		mr.Layers = []string{"tram"}
+		s.ErrorIs(ads.LoadMapView(context.Background(), mr, fc), geo.ErrUnknownLayer)
+		mr.Layers = nil
+		mr.Filter, _ = geo.ParsePropertyFilter("line:1")
+		s.ErrorIs(ads.LoadMapView(context.Background(), mr, fc), ErrArchiveUnsupported)
+		// server responds 400 to them
+		s.ErrorIs(ads.LoadNearby(context.Background(), &geo.NearbyRequest{}, fc), geo.ErrUnsupportedRequest)
+		_, err = ads.LoadClusterMembers(context.Background(), &geo.ClusterMembersRequest{}, fc)
+		s.ErrorIs(err, geo.ErrUnsupportedRequest)
+		s.Nil(ads.Close())
+	}
+}
+
+func (s *TileStoreSuite) TestFingerprintMismatch() {
+	path := filepath.Join(s.dir, "tiles.pmtiles")
+	w, err := Create(path, s.metadata())
+	s.Require().Nil(err)
+	s.Require().Nil(w.Close())
+	r, err := Open(path)
+	s.Require().Nil(err)
+	defer r.Close()
+	cfg := *geo.DefaultGeoSystemConfig
+	cfg.MaxZoom = 20
+	_, err = NewArchiveDataSource(r, geo.NewGeographicSystem(&cfg))
+	s.Error(err)
+}
+
+func featureIDs(fc *geo.FeatureCollection) []string {
+	ids := make([]string, 0, len(fc.Features))
+	for _, feature := range fc.Features {
+		ids = append(ids, feature.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}